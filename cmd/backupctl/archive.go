@@ -0,0 +1,375 @@
+package backupctl
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// databaseName is the database holding the data of all repositories
+const databaseName = "gcipher"
+
+// manifestVersion is the archive format written by Backup
+const manifestVersion = 1
+
+// Names of the files in an archive. Every collection is stored in collections/<name>.jsonl as one
+// MongoDB Extended JSON document per line.
+const (
+	manifestFile     = "manifest.json"
+	signatureFile    = "manifest.sig"
+	configFile       = "config.yml"
+	collectionPrefix = "collections/"
+	collectionSuffix = ".jsonl"
+)
+
+// Manifest lists the contents of an archive with their checksums
+type Manifest struct {
+	Version   int         `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	Database  string      `json:"database"`
+	Files     []FileEntry `json:"files"`
+}
+
+// FileEntry is a file of an archive, Collection and Documents are set for collection dumps
+type FileEntry struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	Collection string `json:"collection,omitempty"`
+	Documents  int    `json:"documents,omitempty"`
+}
+
+// Signature is the signature of the manifest by the CA key
+type Signature struct {
+	Algorithm   string `json:"algorithm"`
+	Certificate string `json:"certificate"`
+	Signature   []byte `json:"signature"`
+}
+
+// Backup writes a signed archive of all collections and the config file to path. The archive is
+// encrypted with the passphrase unless it is empty.
+func Backup(path, passphrase string) (*Manifest, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+	database := client.Database(databaseName)
+
+	names, err := collectionNames(database)
+	if err != nil {
+		return nil, err
+	}
+
+	// Never overwrite an existing backup
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := writeArchive(out, cfg, database, names, passphrase)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func writeArchive(out io.Writer, cfg *config.Config, database *mongo.Database, names []string, passphrase string) (*Manifest, error) {
+	var encrypter *encryptWriter
+	if passphrase != "" {
+		var err error
+		if encrypter, err = newEncryptWriter(out, passphrase); err != nil {
+			return nil, err
+		}
+		out = encrypter
+	}
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	manifest := &Manifest{Version: manifestVersion, CreatedAt: time.Now().UTC(), Database: databaseName}
+
+	for _, name := range names {
+		entry, err := writeCollection(tw, database.Collection(name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up collection %s: %v", name, err)
+		}
+		manifest.Files = append(manifest.Files, *entry)
+	}
+
+	if path, err := config.FindConfigFile(); err == nil {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %v", err)
+		}
+		if err := writeFile(tw, configFile, content); err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, FileEntry{Name: configFile, Size: int64(len(content)), SHA256: checksum(content)})
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signManifest(cfg, manifestBytes)
+	if err != nil {
+		return nil, err
+	}
+	signatureBytes, err := json.MarshalIndent(signature, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFile(tw, manifestFile, manifestBytes); err != nil {
+		return nil, err
+	}
+	if err := writeFile(tw, signatureFile, signatureBytes); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if encrypter != nil {
+		if err := encrypter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// collectionNames returns the collections of the database in a stable order.
+func collectionNames(database *mongo.Database) ([]string, error) {
+	names, err := database.ListCollectionNames(context.Background(), bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %v", err)
+	}
+
+	var result []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, "system.") {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// writeCollection dumps a collection to a temporary file first, tar needs the size up front.
+func writeCollection(tw *tar.Writer, collection *mongo.Collection) (*FileEntry, error) {
+	tmp, err := os.CreateTemp("", "gcipher-backup-*"+collectionSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	writer := bufio.NewWriter(io.MultiWriter(tmp, hasher))
+
+	cursor, err := collection.Find(context.Background(), bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	documents := 0
+	for cursor.Next(context.Background()) {
+		line, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return nil, err
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+		documents++
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	name := collectionPrefix + collection.Name() + collectionSuffix
+	if err := tw.WriteHeader(fileHeader(name, size)); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tw, tmp); err != nil {
+		return nil, err
+	}
+
+	return &FileEntry{
+		Name:       name,
+		Size:       size,
+		SHA256:     hex.EncodeToString(hasher.Sum(nil)),
+		Collection: collection.Name(),
+		Documents:  documents,
+	}, nil
+}
+
+func writeFile(tw *tar.Writer, name string, content []byte) error {
+	if err := tw.WriteHeader(fileHeader(name, int64(len(content)))); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+func fileHeader(name string, size int64) *tar.Header {
+	return &tar.Header{Name: name, Mode: 0600, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}
+}
+
+// signManifest signs the manifest with the CA key.
+func signManifest(cfg *config.Config, manifest []byte) (*Signature, error) {
+	signer, ok := cfg.CAKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("CA key of type %T cannot sign", cfg.CAKey)
+	}
+
+	algorithm, err := signatureAlgorithm(cfg.CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(manifest)
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign manifest: %v", err)
+	}
+
+	return &Signature{
+		Algorithm:   algorithm.String(),
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cfg.CACert.Raw})),
+		Signature:   signature,
+	}, nil
+}
+
+func signatureAlgorithm(cert *x509.Certificate) (x509.SignatureAlgorithm, error) {
+	switch cert.PublicKeyAlgorithm {
+	case x509.RSA:
+		return x509.SHA256WithRSA, nil
+	case x509.ECDSA:
+		return x509.ECDSAWithSHA256, nil
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported CA public key algorithm: %v", cert.PublicKeyAlgorithm)
+	}
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// archiveReader reads the files of an archive
+type archiveReader struct {
+	*tar.Reader
+	file      *os.File
+	encrypted bool
+}
+
+// openArchive opens an archive, decrypting it if necessary.
+func openArchive(path string) (*archiveReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := newArchiveReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open %s: %v", filepath.Base(path), err)
+	}
+	return archive, nil
+}
+
+func newArchiveReader(file *os.File) (*archiveReader, error) {
+	buffered := bufio.NewReader(file)
+	encrypted := isEncrypted(buffered)
+
+	var r io.Reader = buffered
+	if encrypted {
+		passphrase, err := archivePassphrase()
+		if err != nil {
+			return nil, err
+		}
+		if r, err = newDecryptReader(buffered, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil && encrypted {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("not a gcipher backup: %v", err)
+	}
+	return &archiveReader{Reader: tar.NewReader(gz), file: file, encrypted: encrypted}, nil
+}
+
+func (a *archiveReader) Close() error {
+	return a.file.Close()
+}
+
+// hashingReader computes the checksum of everything read through it
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+}
+
+func newHashingReader(r io.Reader) *hashingReader {
+	return &hashingReader{r: r, hash: sha256.New()}
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	h.size += int64(n)
+	return n, err
+}
+
+func (h *hashingReader) sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
@@ -0,0 +1,285 @@
+package backupctl
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/util"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// usageError is returned by commands called with missing arguments, it holds the usage line
+type usageError string
+
+func (e usageError) Error() string {
+	return "Usage: gcipher backupctl " + string(e)
+}
+
+// command is a backupctl subcommand
+type command struct {
+	name        string
+	description string
+	run         func(args []string, opts options) error
+}
+
+var commands = []command{
+	{"backup", "Write a signed archive of all data and the config file", RunBackup},
+	{"verify", "Check the signature, checksums and CRL consistency of an archive", RunVerify},
+	{"restore", "Restore an archive into an empty database", RunRestore},
+}
+
+// Execute runs the backupctl subcommand named by os.Args[2]. It exits with status 1 if the
+// command fails and with status 2 on usage errors.
+func Execute() {
+	if len(os.Args) < 3 {
+		printUsage()
+		os.Exit(exitUsage)
+	}
+
+	subcommand := os.Args[2]
+	for _, cmd := range commands {
+		if cmd.name != subcommand {
+			continue
+		}
+
+		args, opts, err := parseArgs(os.Args[3:])
+		if err == nil {
+			err = cmd.run(args, opts)
+		}
+
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintln(os.Stderr, usage.Error())
+			os.Exit(exitUsage)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", subcommand, err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "Unknown subcommand:", subcommand)
+	printUsage()
+	os.Exit(exitUsage)
+}
+
+func printUsage() {
+	fmt.Println("Usage: gcipher backupctl [command] [--json]")
+	fmt.Println("Available commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %s - %s\n", cmd.name, cmd.description)
+	}
+}
+
+// options are the flags accepted by the commands
+type options struct {
+	// json prints results as JSON for scripting
+	json bool
+	// encrypt protects a new archive with a passphrase
+	encrypt bool
+	// caCerts are the CA certificates archives are verified against instead of the configured
+	// generations, the flag is repeated for every generation
+	caCerts []string
+	// configOut is where restore writes the archived config file
+	configOut string
+}
+
+// parseArgs separates the flags from the positional arguments.
+func parseArgs(rawArgs []string) ([]string, options, error) {
+	var args []string
+	var opts options
+	for i := 0; i < len(rawArgs); i++ {
+		arg := rawArgs[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+
+		switch name {
+		case "--json":
+			opts.json = true
+		case "--encrypt":
+			opts.encrypt = true
+		case "--ca-cert", "--config-out":
+			if !hasValue {
+				if i+1 == len(rawArgs) {
+					return nil, opts, fmt.Errorf("%s needs a path", name)
+				}
+				i++
+				value = rawArgs[i]
+			}
+			if name == "--ca-cert" {
+				opts.caCerts = append(opts.caCerts, value)
+			} else {
+				opts.configOut = value
+			}
+		default:
+			args = append(args, arg)
+		}
+	}
+	return args, opts, nil
+}
+
+// RunBackup writes a new archive.
+func RunBackup(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("backup [archive] [--encrypt] [--json]")
+	}
+
+	passphrase := ""
+	if opts.encrypt {
+		var err error
+		if passphrase, err = readPassphrase(true); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := Backup(args[0], passphrase)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		return printJSON(manifest)
+	}
+
+	printManifest(manifest)
+	if passphrase == "" {
+		fmt.Println("\nThe archive is not encrypted, it contains password hashes and the config file.")
+	}
+	return nil
+}
+
+// RunVerify verifies an archive and exits with status 1 if it has consistency problems.
+func RunVerify(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("verify [archive] [--ca-cert path] [--json]")
+	}
+
+	trusted, err := trustedCA(opts)
+	if err != nil {
+		return err
+	}
+
+	result, err := Verify(args[0], trusted)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else {
+		printResult(result)
+	}
+
+	if len(result.Problems) > 0 {
+		return fmt.Errorf("archive has %d consistency problems", len(result.Problems))
+	}
+	return nil
+}
+
+// RunRestore restores an archive into an empty database.
+func RunRestore(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("restore [archive] [--ca-cert path] [--config-out path] [--json]")
+	}
+
+	trusted, err := trustedCA(opts)
+	if err != nil {
+		return err
+	}
+
+	result, err := Restore(args[0], trusted, opts.configOut)
+	if result != nil && len(result.Problems) > 0 && !opts.json {
+		printResult(result)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		return printJSON(result)
+	}
+
+	printResult(result)
+	fmt.Println("\nRestore completed.")
+	if opts.configOut != "" {
+		fmt.Println("Config file written to", opts.configOut)
+	}
+	return nil
+}
+
+// trustedCA returns the CA certificates the archive signature and CRLs are checked against,
+// the --ca-cert files or all configured generations of the signing CA.
+func trustedCA(opts options) ([]*x509.Certificate, error) {
+	if len(opts.caCerts) > 0 {
+		trusted := make([]*x509.Certificate, 0, len(opts.caCerts))
+		for _, path := range opts.caCerts {
+			cert, err := util.ParseCertificate(path)
+			if err != nil {
+				return nil, err
+			}
+			trusted = append(trusted, cert)
+		}
+		return trusted, nil
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	trusted := make([]*x509.Certificate, 0, len(cfg.CAGenerations))
+	for _, generation := range cfg.CAGenerations {
+		trusted = append(trusted, generation.Cert)
+	}
+	return trusted, nil
+}
+
+func printManifest(manifest *Manifest) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tDOCUMENTS\tSIZE\tSHA256")
+	for _, entry := range manifest.Files {
+		documents := "-"
+		if entry.Collection != "" {
+			documents = fmt.Sprint(entry.Documents)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", entry.Name, documents, entry.Size, entry.SHA256)
+	}
+	w.Flush()
+}
+
+func printResult(result *VerifyResult) {
+	printManifest(result.Manifest)
+
+	fmt.Printf("\nCreated: %s\n", result.Manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("Signed by: %s\n", result.SignedBy)
+	fmt.Printf("Encrypted: %t\n", result.Encrypted)
+
+	for _, warning := range result.Warnings {
+		fmt.Println("Warning:", warning)
+	}
+	for _, problem := range result.Problems {
+		fmt.Println("Problem:", problem)
+	}
+	if len(result.Problems) == 0 {
+		fmt.Println("Signature, checksums and CRL consistency OK")
+	}
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,247 @@
+package backupctl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+)
+
+// Encrypted archives start with encryptionMagic followed by the Argon2id parameters and salt.
+// The archive is then split into segments of segmentSize bytes that are sealed with AES-256-GCM,
+// the nonce holds the segment counter and a flag marking the final segment so that truncated or
+// reordered archives fail to decrypt.
+const (
+	encryptionMagic = "GCBKENC1"
+	segmentSize     = 64 * 1024
+	saltSize        = 16
+	headerSize      = len(encryptionMagic) + 4 + 4 + 1 + saltSize
+)
+
+// Argon2id parameters for new archives
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+)
+
+// passphraseEnv is the environment variable read before prompting for the archive passphrase
+const passphraseEnv = "GCIPHER_BACKUP_PASSPHRASE"
+
+// encryptWriter encrypts everything written to it, Close writes the final segment.
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint64
+}
+
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	header := make([]byte, 0, headerSize)
+	header = append(header, encryptionMagic...)
+	header = binary.BigEndian.AppendUint32(header, argonTime)
+	header = binary.BigEndian.AppendUint32(header, argonMemory)
+	header = append(header, argonThreads)
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	header = append(header, salt...)
+
+	aead, err := newAEAD(passphrase, argonTime, argonMemory, argonThreads, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, header: header}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	e.buf = append(e.buf, p...)
+	// Keep at least one byte back, the final segment is only known on Close
+	for len(e.buf) > segmentSize {
+		if err := e.seal(e.buf[:segmentSize], false); err != nil {
+			return 0, err
+		}
+		e.buf = e.buf[segmentSize:]
+	}
+	return len(p), nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(e.buf, true)
+}
+
+func (e *encryptWriter) seal(segment []byte, final bool) error {
+	sealed := e.aead.Seal(nil, segmentNonce(e.counter, final), segment, e.header)
+	e.counter++
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader decrypts an archive written by encryptWriter.
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	counter uint64
+	plain   []byte
+	done    bool
+}
+
+func newDecryptReader(r *bufio.Reader, passphrase string) (*decryptReader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header: %v", err)
+	}
+
+	offset := len(encryptionMagic)
+	time := binary.BigEndian.Uint32(header[offset:])
+	memory := binary.BigEndian.Uint32(header[offset+4:])
+	threads := header[offset+8]
+	salt := header[offset+9:]
+
+	// Refuse parameters that would exhaust the memory of the restoring host
+	if time == 0 || time > 16 || memory == 0 || memory > 1024*1024 || threads == 0 {
+		return nil, errors.New("invalid encryption parameters")
+	}
+
+	aead, err := newAEAD(passphrase, time, memory, threads, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead, header: header}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	segment := make([]byte, segmentSize+d.aead.Overhead())
+	n, err := io.ReadFull(d.r, segment)
+	final := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		final = true
+	case err != nil:
+		return err
+	default:
+		_, err := d.r.Peek(1)
+		final = err == io.EOF
+	}
+
+	plain, err := d.aead.Open(nil, segmentNonce(d.counter, final), segment[:n], d.header)
+	if err != nil {
+		return errors.New("failed to decrypt archive, wrong passphrase or corrupted archive")
+	}
+	d.counter++
+	d.plain = plain
+	d.done = final
+	return nil
+}
+
+func newAEAD(passphrase string, time, memory uint32, threads uint8, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), salt, time, memory, threads, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func segmentNonce(counter uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// isEncrypted reports whether the archive read by r is encrypted.
+func isEncrypted(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(encryptionMagic))
+	return err == nil && bytes.Equal(magic, []byte(encryptionMagic))
+}
+
+// passphrase is remembered so that restore, which reads the archive twice, only prompts once
+var passphrase string
+
+// archivePassphrase returns the passphrase of the archive being read.
+func archivePassphrase() (string, error) {
+	if passphrase == "" {
+		var err error
+		if passphrase, err = readPassphrase(false); err != nil {
+			return "", err
+		}
+	}
+	return passphrase, nil
+}
+
+// readPassphrase returns the archive passphrase from GCIPHER_BACKUP_PASSPHRASE or prompts for
+// it on the terminal, twice when it protects a new archive.
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no terminal to prompt for the passphrase, set %s", passphraseEnv)
+	}
+
+	passphrase, err := promptPassphrase(fd, "Backup passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("empty passphrase")
+	}
+
+	if confirm {
+		confirmation, err := promptPassphrase(fd, "Retype backup passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if passphrase != confirmation {
+			return "", errors.New("passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
+
+func promptPassphrase(fd int, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	return string(passphrase), nil
+}
@@ -0,0 +1,151 @@
+package backupctl
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"gcipher/internal/db"
+	"io"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// insertBatchSize is the number of documents inserted at once
+const insertBatchSize = 1000
+
+// Restore verifies an archive and restores its collections into the database, which must not
+// hold any of the archived collections yet. The archived config file is written to configOut if
+// it is set, the running config is never replaced.
+func Restore(path string, trusted []*x509.Certificate, configOut string) (*VerifyResult, error) {
+	result, err := Verify(path, trusted)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Problems) > 0 {
+		return result, errors.New("archive failed the consistency checks, nothing was restored")
+	}
+
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+	database := client.Database(databaseName)
+
+	entries := make(map[string]FileEntry)
+	for _, entry := range result.Manifest.Files {
+		entries[entry.Name] = entry
+		if entry.Collection == "" {
+			continue
+		}
+
+		count, err := database.Collection(entry.Collection).CountDocuments(context.Background(), bson.D{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to count documents of %s: %v", entry.Collection, err)
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("collection %s is not empty, restore needs an empty database", entry.Collection)
+		}
+	}
+
+	if configOut != "" {
+		if _, ok := entries[configFile]; !ok {
+			return nil, errors.New("archive holds no config file")
+		}
+	}
+
+	archive, err := openArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %v", err)
+		}
+
+		// The archive was verified, but it's read again and may have changed since
+		entry, ok := entries[header.Name]
+		if !ok {
+			continue
+		}
+		hashing := newHashingReader(archive)
+
+		if entry.Collection != "" {
+			if err := restoreCollection(hashing, database.Collection(entry.Collection)); err != nil {
+				return nil, fmt.Errorf("failed to restore %s, drop the database before retrying: %v", entry.Collection, err)
+			}
+		} else if entry.Name == configFile && configOut != "" {
+			if err := writeConfig(hashing, configOut); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := io.Copy(io.Discard, hashing); err != nil {
+			return nil, err
+		}
+		if hashing.sum() != entry.SHA256 {
+			return nil, fmt.Errorf("%s changed while restoring, drop the database before retrying", entry.Name)
+		}
+	}
+
+	for _, entry := range result.Manifest.Files {
+		if entry.Collection == "" {
+			continue
+		}
+		count, err := database.Collection(entry.Collection).CountDocuments(context.Background(), bson.D{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to count documents of %s: %v", entry.Collection, err)
+		}
+		if count != int64(entry.Documents) {
+			return nil, fmt.Errorf("collection %s holds %d documents after the restore, the archive has %d", entry.Collection, count, entry.Documents)
+		}
+	}
+
+	return result, nil
+}
+
+func restoreCollection(r io.Reader, collection *mongo.Collection) error {
+	var batch []interface{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := collection.InsertMany(context.Background(), batch)
+		batch = batch[:0]
+		return err
+	}
+
+	err := readDocuments(r, func(document bson.Raw) error {
+		batch = append(batch, document)
+		if len(batch) == insertBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// writeConfig writes the archived config file, an existing file is never overwritten.
+func writeConfig(r io.Reader, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create config file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	return nil
+}
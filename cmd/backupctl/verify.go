@@ -0,0 +1,347 @@
+package backupctl
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gcipher/internal/db/models"
+	"gcipher/internal/util"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// VerifyResult is the outcome of verifying an archive. Problems are inconsistencies between the
+// CRL and the certificate states, warnings are expected differences such as revocations newer
+// than the latest CRL.
+type VerifyResult struct {
+	Manifest  *Manifest `json:"manifest"`
+	SignedBy  string    `json:"signed_by"`
+	Encrypted bool      `json:"encrypted"`
+	Problems  []string  `json:"problems"`
+	Warnings  []string  `json:"warnings"`
+}
+
+// fileCheck is the size and checksum of a file read from an archive
+type fileCheck struct {
+	size      int64
+	sha256    string
+	documents int
+}
+
+// Verify checks the signature of the manifest against the trusted CA certificates, the
+// checksums and document counts of all files and the consistency of the CRLs with the
+// certificates. An error means the archive can't be trusted, consistency problems are reported
+// in the result.
+func Verify(path string, trusted []*x509.Certificate) (*VerifyResult, error) {
+	archive, err := openArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	var manifestBytes, signatureBytes []byte
+	files := make(map[string]fileCheck)
+	state := newConsistencyState()
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %v", err)
+		}
+
+		switch header.Name {
+		case manifestFile:
+			manifestBytes, err = io.ReadAll(archive)
+		case signatureFile:
+			signatureBytes, err = io.ReadAll(archive)
+		default:
+			if _, ok := files[header.Name]; ok {
+				return nil, fmt.Errorf("archive contains %s twice", header.Name)
+			}
+			var check *fileCheck
+			check, err = readFile(archive.Reader, header, state)
+			if check != nil {
+				files[header.Name] = *check
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", header.Name, err)
+		}
+	}
+
+	if manifestBytes == nil || signatureBytes == nil {
+		return nil, errors.New("archive has no signed manifest")
+	}
+
+	var signature Signature
+	if err := json.Unmarshal(signatureBytes, &signature); err != nil {
+		return nil, fmt.Errorf("invalid signature file: %v", err)
+	}
+	signer, err := verifySignature(manifestBytes, &signature, trusted)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", manifest.Version)
+	}
+
+	if err := checkFiles(&manifest, files); err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{
+		Manifest:  &manifest,
+		SignedBy:  signer.Subject.String(),
+		Encrypted: archive.encrypted,
+	}
+	state.check(trusted, result)
+	return result, nil
+}
+
+// readFile hashes a file of the archive. Collection dumps are parsed line by line, the
+// certificates and CRLs are kept for the consistency checks.
+func readFile(tr *tar.Reader, header *tar.Header, state *consistencyState) (*fileCheck, error) {
+	hashing := newHashingReader(tr)
+	documents := 0
+
+	if collection, ok := collectionOf(header.Name); ok {
+		err := readDocuments(hashing, func(document bson.Raw) error {
+			documents++
+			return state.add(collection, document)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := io.Copy(io.Discard, hashing); err != nil {
+		return nil, err
+	}
+	return &fileCheck{size: hashing.size, sha256: hashing.sum(), documents: documents}, nil
+}
+
+// collectionOf returns the collection dumped in the named file.
+func collectionOf(name string) (string, bool) {
+	if !strings.HasPrefix(name, collectionPrefix) || !strings.HasSuffix(name, collectionSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, collectionPrefix), collectionSuffix), true
+}
+
+// readDocuments calls fn for every Extended JSON document of a collection dump.
+func readDocuments(r io.Reader, fn func(bson.Raw) error) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		text, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(text)) > 0 {
+			var document bson.Raw
+			if err := bson.UnmarshalExtJSON(text, true, &document); err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+			if err := fn(document); err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// verifySignature checks the manifest signature and returns the trusted certificate that made
+// it. Any generation of the CA may have signed the archive.
+func verifySignature(manifest []byte, signature *Signature, trusted []*x509.Certificate) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(signature.Certificate))
+	if block == nil {
+		return nil, errors.New("signature has no certificate")
+	}
+	signer, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer certificate: %v", err)
+	}
+	if !slices.ContainsFunc(trusted, signer.Equal) {
+		return nil, fmt.Errorf("archive is signed by %s, which is not a trusted CA certificate", signer.Subject)
+	}
+
+	algorithm, err := signatureAlgorithm(signer)
+	if err != nil {
+		return nil, err
+	}
+	if signature.Algorithm != algorithm.String() {
+		return nil, fmt.Errorf("unexpected signature algorithm %s", signature.Algorithm)
+	}
+
+	if err := signer.CheckSignature(algorithm, manifest, signature.Signature); err != nil {
+		return nil, fmt.Errorf("invalid manifest signature: %v", err)
+	}
+	return signer, nil
+}
+
+// checkFiles compares the files of the archive with the manifest.
+func checkFiles(manifest *Manifest, files map[string]fileCheck) error {
+	listed := make(map[string]bool)
+	for _, entry := range manifest.Files {
+		listed[entry.Name] = true
+
+		check, ok := files[entry.Name]
+		if !ok {
+			return fmt.Errorf("%s is missing from the archive", entry.Name)
+		}
+		if check.size != entry.Size || check.sha256 != entry.SHA256 {
+			return fmt.Errorf("checksum mismatch for %s", entry.Name)
+		}
+		if entry.Collection != "" && check.documents != entry.Documents {
+			return fmt.Errorf("%s holds %d documents, the manifest lists %d", entry.Name, check.documents, entry.Documents)
+		}
+	}
+
+	for name := range files {
+		if !listed[name] {
+			return fmt.Errorf("%s is not listed in the manifest", name)
+		}
+	}
+	return nil
+}
+
+// consistencyState collects the certificates and CRLs of an archive
+type consistencyState struct {
+	certificates map[string]models.Certificate
+	crls         []models.CRL
+}
+
+func newConsistencyState() *consistencyState {
+	return &consistencyState{certificates: make(map[string]models.Certificate)}
+}
+
+func (s *consistencyState) add(collection string, document bson.Raw) error {
+	switch collection {
+	case "certificates":
+		var cert models.Certificate
+		if err := bson.Unmarshal(document, &cert); err != nil {
+			return err
+		}
+		// Certificates stored before the issuing generation was recorded are attributed by
+		// their authority key identifier, the PEM and PKCS#12 data isn't needed otherwise
+		if cert.IssuerKeyID == "" {
+			cert.IssuerKeyID = util.AuthorityKeyID(cert.CertificatePEM)
+		}
+		cert.CertificatePEM, cert.PKCS12 = nil, nil
+		s.certificates[cert.SerialNumber] = cert
+	case "crls":
+		var crl models.CRL
+		if err := bson.Unmarshal(document, &crl); err != nil {
+			return err
+		}
+		s.crls = append(s.crls, crl)
+	}
+	return nil
+}
+
+// check compares the latest CRL of every CA generation with the revocation state of the
+// certificates it signed.
+func (s *consistencyState) check(trusted []*x509.Certificate, result *VerifyResult) {
+	latest := make(map[string]*x509.RevocationList)
+	for _, crl := range s.crls {
+		list, err := x509.ParseRevocationList(crl.CRLBytes)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("invalid CRL: %v", err))
+			continue
+		}
+		keyID := hex.EncodeToString(list.AuthorityKeyId)
+		if current, ok := latest[keyID]; !ok || list.ThisUpdate.After(current.ThisUpdate) {
+			latest[keyID] = list
+		}
+	}
+
+	serials := make([]string, 0, len(s.certificates))
+	for serial := range s.certificates {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+
+	if len(latest) == 0 {
+		for _, serial := range serials {
+			if s.certificates[serial].RevokedAt != nil {
+				result.Warnings = append(result.Warnings, "archive holds revoked certificates but no CRL")
+				break
+			}
+		}
+		return
+	}
+
+	keyIDs := make([]string, 0, len(latest))
+	for keyID := range latest {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	listed := make(map[string]bool)
+	for _, keyID := range keyIDs {
+		crl := latest[keyID]
+		if !slices.ContainsFunc(trusted, func(cert *x509.Certificate) bool { return crl.CheckSignatureFrom(cert) == nil }) {
+			result.Problems = append(result.Problems, fmt.Sprintf("CRL of key %s is not signed by a trusted CA certificate", keyID))
+		}
+
+		for _, entry := range crl.RevokedCertificateEntries {
+			serial := fmt.Sprintf("%x", entry.SerialNumber)
+			listed[serial] = true
+
+			cert, ok := s.certificates[serial]
+			switch {
+			case !ok:
+				result.Problems = append(result.Problems, fmt.Sprintf("CRL lists %s, which is not in the certificates collection", serial))
+			case cert.RevokedAt == nil:
+				result.Problems = append(result.Problems, fmt.Sprintf("CRL lists %s, but the certificate is not revoked", serial))
+			case !entry.RevocationTime.Equal(cert.RevokedAt.Truncate(time.Second)):
+				result.Problems = append(result.Problems, fmt.Sprintf("CRL revocation date of %s is %s, the certificate was revoked at %s",
+					serial, entry.RevocationTime.UTC().Format(time.RFC3339), cert.RevokedAt.UTC().Format(time.RFC3339)))
+			case entry.ReasonCode != cert.RevocationReason:
+				result.Problems = append(result.Problems, fmt.Sprintf("CRL revocation reason of %s is %d, the certificate has %d",
+					serial, entry.ReasonCode, cert.RevocationReason))
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, serial := range serials {
+		cert := s.certificates[serial]
+		if cert.RevokedAt == nil || listed[serial] {
+			continue
+		}
+
+		// Generations stop publishing CRLs once all certificates they signed have expired
+		crl, ok := latest[cert.IssuerKeyID]
+		switch {
+		case !ok && cert.NotAfter.After(now):
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s is revoked, but there is no CRL of its issuer key %s", serial, cert.IssuerKeyID))
+		case !ok:
+		case cert.RevokedAt.Before(crl.ThisUpdate):
+			result.Problems = append(result.Problems, fmt.Sprintf("%s was revoked at %s but is missing from the CRL of %s",
+				serial, cert.RevokedAt.UTC().Format(time.RFC3339), crl.ThisUpdate.UTC().Format(time.RFC3339)))
+		default:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s was revoked after the latest CRL and will be listed in the next one", serial))
+		}
+	}
+}
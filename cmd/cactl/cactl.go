@@ -0,0 +1,97 @@
+package cactl
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Exit codes
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// usageError is returned by commands called with invalid arguments, it holds the usage line
+type usageError string
+
+func (e usageError) Error() string {
+	return "Usage: gcipher cactl " + string(e)
+}
+
+// command is a cactl subcommand
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"init-root", "Generate a key and a self-signed root CA certificate", InitRoot},
+	{"init-intermediate", "Generate a key and an intermediate CA certificate signed by the root", InitIntermediate},
+	{"rollover", "Generate a key and the certificate of the next generation of a CA", Rollover},
+	{"cross-sign", "Sign the key and subject of a CA certificate with another CA", CrossSign},
+	{"revoke", "Revoke a CA recorded in the database", RevokeCA},
+	{"export-crl-request", "Write a request for the next CRL of an offline CA", ExportCRLRequest},
+	{"request-intermediate", "Generate the key of an intermediate CA and write a request for an offline CA", RequestIntermediate},
+	{"sign-request", "Sign a CRL or intermediate request on the offline host, without a database", SignRequest},
+	{"import-signed", "Import a CRL or certificate signed on the offline host", ImportSigned},
+	{"list", "List the CAs recorded in the database", ListCAs},
+	{"verify", "Verify a certificate against the configured CAs and the revocation records", VerifyCertificate},
+	{"init-tsa", "Generate a key and a timestamping certificate signed by the CA", InitTSA},
+	{"verify-timestamp", "Verify an RFC 3161 timestamp and check that it matches a file or digest", VerifyTimestamp},
+}
+
+// Execute runs the cactl subcommand named by os.Args[2]. It exits with status 1 if the command
+// fails and with status 2 on usage errors.
+func Execute() {
+	if len(os.Args) < 3 {
+		printUsage()
+		os.Exit(exitUsage)
+	}
+
+	subcommand := os.Args[2]
+	for _, cmd := range commands {
+		if cmd.name != subcommand {
+			continue
+		}
+
+		err := cmd.run(os.Args[3:])
+
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintln(os.Stderr, usage.Error())
+			os.Exit(exitUsage)
+		}
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(exitUsage)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", subcommand, err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "Unknown subcommand:", subcommand)
+	printUsage()
+	os.Exit(exitUsage)
+}
+
+func printUsage() {
+	fmt.Println("Usage: gcipher cactl [command] [flags]")
+	fmt.Println("Available commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %s - %s\n", cmd.name, cmd.description)
+	}
+	fmt.Println("Run gcipher cactl [command] --help for the flags of a command")
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,416 @@
+package cactl
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"flag"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/util"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Default validity of new CA certificates in days
+const (
+	defaultRootDays         = 20 * 365
+	defaultIntermediateDays = 5 * 365
+)
+
+// listFlag collects comma separated values of a repeatable flag
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// caOptions are the flags shared by init-root and init-intermediate
+type caOptions struct {
+	commonName      string
+	organization    string
+	country         string
+	keyType         string
+	keySize         int
+	days            int
+	pathLen         int
+	certPath        string
+	keyPath         string
+	pkcs11Label     string
+	permittedDNS    listFlag
+	excludedDNS     listFlag
+	permittedIPs    listFlag
+	excludedIPs     listFlag
+	permittedEmails listFlag
+	excludedEmails  listFlag
+}
+
+func newFlagSet(name string, opts *caOptions, days, pathLen int, certPath, keyPath string) *flag.FlagSet {
+	fs := flag.NewFlagSet("gcipher cactl "+name, flag.ContinueOnError)
+	fs.StringVar(&opts.commonName, "cn", "", "common name of the CA (required)")
+	fs.StringVar(&opts.organization, "org", "", "organization of the CA")
+	fs.StringVar(&opts.country, "country", "", "two letter country code of the CA")
+	fs.StringVar(&opts.keyType, "key-type", "ecdsa", "key type, ecdsa or rsa")
+	fs.IntVar(&opts.keySize, "key-size", 0, "ECDSA curve size (256, 384 or 521, default 384) or RSA key size (3072 or 4096, default 4096)")
+	fs.IntVar(&opts.days, "days", days, "validity in days")
+	fs.IntVar(&opts.pathLen, "path-len", pathLen, "maximum number of CAs below this one, -1 for no limit")
+	fs.StringVar(&opts.certPath, "cert", certPath, "certificate file to write")
+	fs.StringVar(&opts.keyPath, "key", keyPath, "encrypted key file to write")
+	fs.StringVar(&opts.pkcs11Label, "pkcs11-label", "", "generate the key on the configured PKCS#11 token with this label instead of writing a key file")
+	fs.Var(&opts.permittedDNS, "permit-dns", "permitted DNS domains (repeatable, comma separated)")
+	fs.Var(&opts.excludedDNS, "exclude-dns", "excluded DNS domains")
+	fs.Var(&opts.permittedIPs, "permit-ip", "permitted IP ranges in CIDR notation")
+	fs.Var(&opts.excludedIPs, "exclude-ip", "excluded IP ranges in CIDR notation")
+	fs.Var(&opts.permittedEmails, "permit-email", "permitted email addresses or domains")
+	fs.Var(&opts.excludedEmails, "exclude-email", "excluded email addresses or domains")
+	return fs
+}
+
+// InitRoot creates a self-signed root CA.
+func InitRoot(args []string) error {
+	cfg, err := config.GetConfigWithoutCA()
+	if err != nil {
+		return err
+	}
+
+	var opts caOptions
+	fs := newFlagSet("init-root", &opts, defaultRootDays, -1, cfg.CACertPath, cfg.CAKeyPath)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.commonName == "" {
+		return usageError("init-root --cn [common name] [flags]")
+	}
+
+	template, err := newTemplate(&opts)
+	if err != nil {
+		return err
+	}
+
+	return createCA(cfg, &opts, template, models.CATypeRoot, 1, nil, nil)
+}
+
+// InitIntermediate creates an intermediate CA signed by the root. The root is read from the
+// configured CA certificate and key unless flags name others.
+func InitIntermediate(args []string) error {
+	cfg, err := config.GetConfigWithoutCA()
+	if err != nil {
+		return err
+	}
+
+	var opts caOptions
+	fs := newFlagSet("init-intermediate", &opts, defaultIntermediateDays, 0, "intermediate.crt", "intermediate.key")
+	issuerCertPath := fs.String("issuer-cert", cfg.CACertPath, "certificate of the issuing CA")
+	issuerKeyPath := fs.String("issuer-key", cfg.CAKeyPath, "key file of the issuing CA")
+	issuerPKCS11Label := fs.String("issuer-pkcs11-label", cfg.CAKeyPKCS11Label, "label of the issuing CA key on the PKCS#11 token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.commonName == "" {
+		return usageError("init-intermediate --cn [common name] [flags]")
+	}
+
+	issuer, err := util.ParseCertificate(*issuerCertPath)
+	if err != nil {
+		return err
+	}
+
+	template, err := newTemplate(&opts)
+	if err != nil {
+		return err
+	}
+	if err := checkIssuer(issuer, template); err != nil {
+		return err
+	}
+
+	// Check the outputs before the issuer key is unlocked
+	if err := checkOutputs(&opts); err != nil {
+		return err
+	}
+
+	issuerKey, err := loadIssuerKey(cfg, *issuerKeyPath, *issuerPKCS11Label, configuredPassphrase(cfg, *issuerKeyPath))
+	if err != nil {
+		return err
+	}
+
+	return createCA(cfg, &opts, template, models.CATypeIntermediate, 1, issuer, issuerKey)
+}
+
+// newTemplate builds the CA certificate template from the flags.
+func newTemplate(opts *caOptions) (*x509.Certificate, error) {
+	if opts.days <= 0 {
+		return nil, fmt.Errorf("--days must be positive")
+	}
+	if opts.pathLen < -1 {
+		return nil, fmt.Errorf("--path-len must be -1 or more")
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	subject := pkix.Name{CommonName: opts.commonName}
+	if opts.organization != "" {
+		subject.Organization = []string{opts.organization}
+	}
+	if opts.country != "" {
+		subject.Country = []string{opts.country}
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:            serialNumber,
+		Subject:                 subject,
+		NotBefore:               now,
+		NotAfter:                now.AddDate(0, 0, opts.days),
+		KeyUsage:                x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid:   true,
+		IsCA:                    true,
+		MaxPathLen:              opts.pathLen,
+		MaxPathLenZero:          opts.pathLen == 0,
+		PermittedDNSDomains:     opts.permittedDNS,
+		ExcludedDNSDomains:      opts.excludedDNS,
+		PermittedEmailAddresses: opts.permittedEmails,
+		ExcludedEmailAddresses:  opts.excludedEmails,
+	}
+
+	if template.PermittedIPRanges, err = parseIPRanges(opts.permittedIPs); err != nil {
+		return nil, err
+	}
+	if template.ExcludedIPRanges, err = parseIPRanges(opts.excludedIPs); err != nil {
+		return nil, err
+	}
+
+	// RFC 5280 requires name constraints to be critical
+	template.PermittedDNSDomainsCritical = len(opts.permittedDNS)+len(opts.excludedDNS)+len(opts.permittedIPs)+
+		len(opts.excludedIPs)+len(opts.permittedEmails)+len(opts.excludedEmails) > 0
+
+	return template, nil
+}
+
+// newSerialNumber returns a random positive serial number of at most 20 octets.
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 159))
+}
+
+func parseIPRanges(values []string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, value := range values {
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range %s: %v", value, err)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+// checkIssuer verifies that the issuer may sign the intermediate.
+func checkIssuer(issuer, template *x509.Certificate) error {
+	if !issuer.IsCA || issuer.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("%s is not allowed to sign certificates", issuer.Subject)
+	}
+
+	if issuer.MaxPathLenZero {
+		return fmt.Errorf("the path length constraint of %s doesn't allow intermediate CAs", issuer.Subject)
+	}
+	if issuer.MaxPathLen > 0 && (template.MaxPathLen < 0 || template.MaxPathLen >= issuer.MaxPathLen) {
+		return fmt.Errorf("--path-len must be less than %d, the path length constraint of %s", issuer.MaxPathLen, issuer.Subject)
+	}
+
+	if template.NotAfter.After(issuer.NotAfter) {
+		return fmt.Errorf("requested validity exceeds the validity of %s, which ends on %s", issuer.Subject, issuer.NotAfter.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// checkOutputs fails if the certificate or key file exists already.
+func checkOutputs(opts *caOptions) error {
+	paths := []string{opts.certPath}
+	if opts.pkcs11Label == "" {
+		paths = append(paths, opts.keyPath)
+	}
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// createCA generates the key, signs the certificate with the issuer (self-signed if there is
+// none), writes both and records the CA in the database.
+func createCA(cfg *config.Config, opts *caOptions, template *x509.Certificate, caType string, generation int, issuer *x509.Certificate, issuerKey crypto.Signer) error {
+	if err := checkOutputs(opts); err != nil {
+		return err
+	}
+
+	// Fail before any key is generated if the CA can't be recorded
+	repo, err := connectCARepository()
+	if err != nil {
+		return err
+	}
+
+	key, err := generateKey(cfg, opts.keyType, opts.keySize, opts.pkcs11Label)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	selfSigned := issuer == nil
+	if selfSigned {
+		issuer, issuerKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	if !selfSigned {
+		// Catches an issuer key that doesn't belong to the issuer certificate
+		if err := cert.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("issuer key doesn't match the issuer certificate: %v", err)
+		}
+	}
+
+	ca := models.CA{
+		SerialNumber:   fmt.Sprintf("%x", cert.SerialNumber),
+		Type:           caType,
+		Subject:        cert.Subject.String(),
+		SubjectKeyID:   util.KeyID(cert),
+		Generation:     generation,
+		CertificatePEM: pemEncode(der),
+		MaxPathLen:     opts.pathLen,
+		NotBefore:      cert.NotBefore,
+		NotAfter:       cert.NotAfter,
+		CreatedAt:      time.Now(),
+	}
+	if !selfSigned {
+		ca.IssuerSerialNumber = fmt.Sprintf("%x", issuer.SerialNumber)
+	}
+
+	if ca.KeyStorage, ca.KeyReference, err = storeKey(cfg, opts, key); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(opts.certPath, ca.CertificatePEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %v", err)
+	}
+
+	if err := repo.Insert(ca); err != nil {
+		return fmt.Errorf("certificate and key were created, but recording the CA in the database failed: %v", err)
+	}
+
+	printCA(cert, &ca, opts)
+	return nil
+}
+
+// storeKey writes the key file unless the key was generated on the PKCS#11 token, and returns
+// where the key is stored.
+func storeKey(cfg *config.Config, opts *caOptions, key crypto.Signer) (string, string, error) {
+	if opts.pkcs11Label != "" {
+		return models.KeyStoragePKCS11, opts.pkcs11Label, nil
+	}
+
+	if err := writeKeyFile(cfg, opts.keyPath, key); err != nil {
+		return "", "", err
+	}
+	path, err := filepath.Abs(opts.keyPath)
+	if err != nil {
+		return "", "", err
+	}
+	return models.KeyStorageFile, path, nil
+}
+
+// connectCARepository returns the CA repository after checking that the database is reachable.
+func connectCARepository() (*repositories.CARepository, error) {
+	repo, err := repositories.NewCARepository()
+	if err != nil {
+		return nil, err
+	}
+	if err := pingDatabase(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// pingDatabase checks that the database is reachable, so commands fail before keys are created.
+func pingDatabase() error {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return err
+	}
+	if err := client.Ping(context.Background(), readpref.Primary()); err != nil {
+		return fmt.Errorf("failed to connect to the database: %v", err)
+	}
+	return nil
+}
+
+func printCA(cert *x509.Certificate, ca *models.CA, opts *caOptions) {
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	fmt.Printf("Created %s CA %s\n", ca.Type, ca.Subject)
+	fmt.Printf("Serial number: %s\n", ca.SerialNumber)
+	fmt.Printf("Generation: %d\n", ca.Generation)
+	fmt.Printf("SHA-256 fingerprint: %X\n", fingerprint)
+	fmt.Printf("Valid until: %s\n", cert.NotAfter.Format(time.DateOnly))
+	fmt.Println()
+
+	certPath, _ := filepath.Abs(opts.certPath)
+	prefix := "ca"
+	if ca.Type == models.CATypeIntermediate {
+		prefix = "intermediate"
+	}
+
+	if ca.Generation > 1 {
+		// A rollover adds a generation next to the configured signing CA
+		fmt.Println("Configuration, add to the existing ca_generations:")
+		fmt.Println("ca_generations:")
+		fmt.Printf("  - cert_path: %s\n", certPath)
+		if ca.KeyStorage == models.KeyStoragePKCS11 {
+			fmt.Printf("    key_pkcs11_label: %s\n", ca.KeyReference)
+		} else {
+			fmt.Printf("    key_path: %s\n", ca.KeyReference)
+			fmt.Println("    key_passphrase: the passphrase of the key file")
+		}
+		return
+	}
+
+	fmt.Println("Configuration:")
+	fmt.Printf("%s_cert_path: %s\n", prefix, certPath)
+	if ca.KeyStorage == models.KeyStoragePKCS11 {
+		fmt.Printf("%s_key_pkcs11_label: %s\n", prefix, ca.KeyReference)
+	} else {
+		fmt.Printf("%s_key_path: %s\n", prefix, ca.KeyReference)
+		fmt.Printf("%s_key_passphrase: the passphrase of the key file\n", prefix)
+	}
+}
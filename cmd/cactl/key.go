@@ -0,0 +1,209 @@
+package cactl
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/user"
+	"gcipher/internal/util"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// newKeyPassphraseEnv is the environment variable read before prompting for the passphrase of
+// a new key file, issuerKeyPassphraseEnv the one for the key of the issuing CA
+const (
+	newKeyPassphraseEnv    = "GCIPHER_NEW_KEY_PASSPHRASE"
+	issuerKeyPassphraseEnv = "GCIPHER_ISSUER_KEY_PASSPHRASE"
+)
+
+// generateKey creates the CA key on the PKCS#11 token if a label is given, in memory otherwise.
+func generateKey(cfg *config.Config, keyType string, keySize int, pkcs11Label string) (crypto.Signer, error) {
+	curve, bits, err := keyParameters(keyType, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	if pkcs11Label == "" {
+		if curve != nil {
+			return ecdsa.GenerateKey(curve, rand.Reader)
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	}
+
+	token, err := cfg.PKCS11()
+	if err != nil {
+		return nil, err
+	}
+	return util.GeneratePKCS11Key(token, pkcs11Label, curve, bits)
+}
+
+// keyParameters returns the curve of ECDSA keys or the size of RSA keys, a size of 0 selects
+// the default.
+func keyParameters(keyType string, keySize int) (elliptic.Curve, int, error) {
+	switch keyType {
+	case "ecdsa":
+		switch keySize {
+		case 256:
+			return elliptic.P256(), 0, nil
+		case 0, 384:
+			return elliptic.P384(), 0, nil
+		case 521:
+			return elliptic.P521(), 0, nil
+		default:
+			return nil, 0, fmt.Errorf("unsupported ECDSA key size %d, use 256, 384 or 521", keySize)
+		}
+	case "rsa":
+		switch keySize {
+		case 0:
+			return nil, 4096, nil
+		case 3072, 4096:
+			return nil, keySize, nil
+		default:
+			return nil, 0, fmt.Errorf("unsupported RSA key size %d, use 3072 or 4096", keySize)
+		}
+	default:
+		return nil, 0, fmt.Errorf("unsupported key type %s, use ecdsa or rsa", keyType)
+	}
+}
+
+// keyTypeOf returns the key type and size of a public key in the form of the --key-type and
+// --key-size flags.
+func keyTypeOf(publicKey crypto.PublicKey) (string, int) {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return "ecdsa", key.Curve.Params().BitSize
+	case *rsa.PublicKey:
+		return "rsa", key.N.BitLen()
+	default:
+		return "", 0
+	}
+}
+
+// configuredPassphrase returns the passphrase configured for a key file of the signing CA or
+// one of its generations, or an empty string if the file isn't configured.
+func configuredPassphrase(cfg *config.Config, keyPath string) string {
+	if keyPath == cfg.CAKeyPath {
+		return cfg.CAKeyPassphrase
+	}
+	for _, generation := range cfg.CAGenerationConfigs {
+		if keyPath == generation.KeyPath {
+			return generation.KeyPassphrase
+		}
+	}
+	return ""
+}
+
+// loadIssuerKey loads the key of the issuing CA from the PKCS#11 token or a key file. The
+// configured passphrase is used for encrypted key files, if there is none it is asked for.
+func loadIssuerKey(cfg *config.Config, keyPath, pkcs11Label, passphrase string) (crypto.Signer, error) {
+	if pkcs11Label != "" {
+		token, err := cfg.PKCS11()
+		if err != nil {
+			return nil, err
+		}
+		return util.FindPKCS11Key(token, pkcs11Label)
+	}
+
+	content, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issuer key: %v", err)
+	}
+
+	if block, _ := pem.Decode(content); block != nil && block.Type == "ENCRYPTED PRIVATE KEY" && passphrase == "" {
+		if passphrase, err = readPassphrase(issuerKeyPassphraseEnv, "Issuer key passphrase: ", false); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := util.ParseKeyFromBytes(content, []byte(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issuer key: %v", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("issuer key of type %T cannot sign", key)
+	}
+	return signer, nil
+}
+
+// writeKeyFile writes the key encrypted with a new passphrase. Existing files are never
+// overwritten.
+func writeKeyFile(cfg *config.Config, path string, key crypto.Signer) error {
+	passphrase, err := readPassphrase(newKeyPassphraseEnv, "New key passphrase: ", true)
+	if err != nil {
+		return err
+	}
+	if err := user.CheckPasswordPolicy(cfg, "", passphrase, cfg.KeygenMinPasswordLength); err != nil {
+		return err
+	}
+
+	encoded, err := util.MarshalEncryptedKey(key, []byte(passphrase))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(encoded); err != nil {
+		return fmt.Errorf("failed to write key file: %v", err)
+	}
+	return nil
+}
+
+// readPassphrase returns the passphrase from the environment variable or prompts for it on the
+// terminal, twice if confirm is set. Without a terminal the first line of stdin is used.
+func readPassphrase(env, prompt string, confirm bool) (string, error) {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read passphrase from stdin, set %s: %v", env, err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	passphrase, err := promptPassphrase(fd, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	if confirm {
+		confirmation, err := promptPassphrase(fd, "Retype "+strings.ToLower(prompt[:1])+prompt[1:])
+		if err != nil {
+			return "", err
+		}
+		if passphrase != confirmation {
+			return "", errors.New("passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
+
+func promptPassphrase(fd int, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	return string(passphrase), nil
+}
@@ -0,0 +1,79 @@
+package cactl
+
+import (
+	"encoding/pem"
+	"fmt"
+	"gcipher/internal/db/repositories"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// caOutput is the JSON representation of a CA
+type caOutput struct {
+	SerialNumber       string     `json:"serial_number"`
+	Type               string     `json:"type"`
+	Subject            string     `json:"subject"`
+	SubjectKeyID       string     `json:"subject_key_id"`
+	Generation         int        `json:"generation"`
+	IssuerSerialNumber string     `json:"issuer_serial_number,omitempty"`
+	KeyStorage         string     `json:"key_storage"`
+	KeyReference       string     `json:"key_reference"`
+	MaxPathLen         int        `json:"max_path_len"`
+	NotBefore          time.Time  `json:"not_before"`
+	NotAfter           time.Time  `json:"not_after"`
+	RevokedAt          *time.Time `json:"revoked_at,omitempty"`
+	CertificatePEM     string     `json:"certificate_pem"`
+}
+
+// ListCAs prints the CAs recorded in the database.
+func ListCAs(args []string) error {
+	asJSON := len(args) > 0 && args[0] == "--json"
+
+	repo, err := repositories.NewCARepository()
+	if err != nil {
+		return err
+	}
+
+	cas, err := repo.FindAll()
+	if err != nil {
+		return fmt.Errorf("failed to list CAs: %v", err)
+	}
+
+	if asJSON {
+		output := make([]caOutput, 0, len(cas))
+		for _, ca := range cas {
+			output = append(output, caOutput{
+				SerialNumber:       ca.SerialNumber,
+				Type:               ca.Type,
+				Subject:            ca.Subject,
+				SubjectKeyID:       ca.SubjectKeyID,
+				Generation:         ca.Generation,
+				IssuerSerialNumber: ca.IssuerSerialNumber,
+				KeyStorage:         ca.KeyStorage,
+				KeyReference:       ca.KeyReference,
+				MaxPathLen:         ca.MaxPathLen,
+				NotBefore:          ca.NotBefore,
+				NotAfter:           ca.NotAfter,
+				RevokedAt:          ca.RevokedAt,
+				CertificatePEM:     string(ca.CertificatePEM),
+			})
+		}
+		return printJSON(output)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tGEN\tSUBJECT\tSERIAL\tNOT AFTER\tREVOKED\tKEY")
+	for _, ca := range cas {
+		revoked := "-"
+		if ca.RevokedAt != nil {
+			revoked = ca.RevokedAt.Format(time.DateOnly)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s:%s\n", ca.Type, ca.Generation, ca.Subject, ca.SerialNumber, ca.NotAfter.Format(time.DateOnly), revoked, ca.KeyStorage, ca.KeyReference)
+	}
+	return w.Flush()
+}
+
+func pemEncode(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,662 @@
+package cactl
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/util"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Types of signing requests for an offline CA
+const (
+	requestTypeCRL          = "crl"
+	requestTypeIntermediate = "intermediate"
+)
+
+const signingRequestVersion = 1
+
+// defaultOfflineCRLDays is the default time until the NextUpdate of CRLs signed offline
+const defaultOfflineCRLDays = 90
+
+// signingRequest is exported on the online host and signed with the key of an offline CA. It
+// holds everything the offline host needs, so signing works without a database.
+type signingRequest struct {
+	Version   int       `json:"version"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	// IssuerCertificate is the PEM certificate of the offline CA, the signing host checks it
+	// against its own copy
+	IssuerCertificate string `json:"issuer_certificate"`
+
+	// CRL requests
+	CRLNumber      string         `json:"crl_number,omitempty"`
+	NextUpdateDays int            `json:"next_update_days,omitempty"`
+	Revoked        []revokedEntry `json:"revoked,omitempty"`
+
+	// Intermediate requests, the CSR proves possession of the key generated on the online host
+	CSR             string   `json:"csr,omitempty"`
+	Days            int      `json:"days,omitempty"`
+	PathLen         int      `json:"path_len,omitempty"`
+	PermittedDNS    []string `json:"permitted_dns,omitempty"`
+	ExcludedDNS     []string `json:"excluded_dns,omitempty"`
+	PermittedIPs    []string `json:"permitted_ips,omitempty"`
+	ExcludedIPs     []string `json:"excluded_ips,omitempty"`
+	PermittedEmails []string `json:"permitted_emails,omitempty"`
+	ExcludedEmails  []string `json:"excluded_emails,omitempty"`
+	// CertPath, KeyStorage and KeyReference tell the import where to write the certificate
+	// and where the key is
+	CertPath     string `json:"cert_path,omitempty"`
+	KeyStorage   string `json:"key_storage,omitempty"`
+	KeyReference string `json:"key_reference,omitempty"`
+}
+
+// revokedEntry is a revoked CA to be listed on the CRL
+type revokedEntry struct {
+	SerialNumber string    `json:"serial_number"`
+	Subject      string    `json:"subject"`
+	RevokedAt    time.Time `json:"revoked_at"`
+	Reason       int       `json:"reason,omitempty"`
+}
+
+// ExportCRLRequest writes a request for the next CRL of an offline CA, listing the CAs it
+// issued that were revoked with the revoke command.
+func ExportCRLRequest(args []string) error {
+	fs := flag.NewFlagSet("gcipher cactl export-crl-request", flag.ContinueOnError)
+	issuerCertPath := fs.String("issuer-cert", "", "certificate of the offline CA (required)")
+	days := fs.Int("days", defaultOfflineCRLDays, "days until the NextUpdate of the CRL")
+	outPath := fs.String("out", "", "request file to write (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *issuerCertPath == "" || *outPath == "" {
+		return usageError("export-crl-request --issuer-cert [file] --out [file] [--days n]")
+	}
+	if *days <= 0 {
+		return fmt.Errorf("--days must be positive")
+	}
+
+	issuer, err := util.ParseCertificate(*issuerCertPath)
+	if err != nil {
+		return err
+	}
+	if err := checkOffline(issuer); err != nil {
+		return err
+	}
+
+	repo, err := connectCARepository()
+	if err != nil {
+		return err
+	}
+	revoked, err := repo.FindRevokedByIssuer(fmt.Sprintf("%x", issuer.SerialNumber))
+	if err != nil {
+		return fmt.Errorf("failed to list revoked CAs: %v", err)
+	}
+
+	number, err := nextOfflineCRLNumber(issuer)
+	if err != nil {
+		return err
+	}
+
+	request := newSigningRequest(requestTypeCRL, issuer)
+	request.CRLNumber = number.String()
+	request.NextUpdateDays = *days
+	request.Revoked = []revokedEntry{}
+	for _, ca := range revoked {
+		request.Revoked = append(request.Revoked, revokedEntry{
+			SerialNumber: ca.SerialNumber,
+			Subject:      ca.Subject,
+			RevokedAt:    *ca.RevokedAt,
+			Reason:       ca.RevocationReason,
+		})
+	}
+
+	if err := writeSigningRequest(*outPath, request); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote request for CRL number %s of %s listing %d revoked CAs to %s\n", request.CRLNumber, issuer.Subject, len(request.Revoked), *outPath)
+	fmt.Println("Sign it on the offline host with: gcipher cactl sign-request --request [file] --issuer-cert [file] --issuer-key [file] --out [file]")
+	return nil
+}
+
+// RequestIntermediate generates the key of an intermediate CA on the online host and writes a
+// request for its certificate to be signed by an offline CA.
+func RequestIntermediate(args []string) error {
+	cfg, err := config.GetConfigWithoutCA()
+	if err != nil {
+		return err
+	}
+
+	var opts caOptions
+	fs := newFlagSet("request-intermediate", &opts, defaultIntermediateDays, 0, "intermediate.crt", "intermediate.key")
+	issuerCertPath := fs.String("issuer-cert", "", "certificate of the offline CA (required)")
+	outPath := fs.String("out", "", "request file to write (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.commonName == "" || *issuerCertPath == "" || *outPath == "" {
+		return usageError("request-intermediate --cn [common name] --issuer-cert [file] --out [file] [flags]")
+	}
+
+	issuer, err := util.ParseCertificate(*issuerCertPath)
+	if err != nil {
+		return err
+	}
+
+	template, err := newTemplate(&opts)
+	if err != nil {
+		return err
+	}
+	if err := checkIssuer(issuer, template); err != nil {
+		return err
+	}
+	if err := checkOutputs(&opts); err != nil {
+		return err
+	}
+	if _, err := os.Stat(*outPath); err == nil {
+		return fmt.Errorf("%s already exists", *outPath)
+	}
+
+	key, err := generateKey(cfg, opts.keyType, opts.keySize, opts.pkcs11Label)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: template.Subject}, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CSR: %v", err)
+	}
+
+	request := newSigningRequest(requestTypeIntermediate, issuer)
+	request.CSR = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	request.Days = opts.days
+	request.PathLen = opts.pathLen
+	request.PermittedDNS, request.ExcludedDNS = opts.permittedDNS, opts.excludedDNS
+	request.PermittedIPs, request.ExcludedIPs = opts.permittedIPs, opts.excludedIPs
+	request.PermittedEmails, request.ExcludedEmails = opts.permittedEmails, opts.excludedEmails
+	if request.CertPath, err = filepath.Abs(opts.certPath); err != nil {
+		return err
+	}
+
+	if request.KeyStorage, request.KeyReference, err = storeKey(cfg, &opts, key); err != nil {
+		return err
+	}
+
+	if err := writeSigningRequest(*outPath, request); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote request for intermediate CA %s to %s\n", template.Subject, *outPath)
+	fmt.Println("Sign it on the offline host with: gcipher cactl sign-request --request [file] --issuer-cert [file] --issuer-key [file] --out [file]")
+	return nil
+}
+
+// SignRequest signs a CRL or intermediate request with the key of the offline CA. It doesn't
+// need a database, only the request, the CA certificate and the key.
+func SignRequest(args []string) error {
+	cfg, err := config.GetConfigWithoutCA()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("gcipher cactl sign-request", flag.ContinueOnError)
+	requestPath := fs.String("request", "", "request file exported on the online host (required)")
+	issuerCertPath := fs.String("issuer-cert", "", "certificate of the offline CA (required)")
+	issuerKeyPath := fs.String("issuer-key", "", "key file of the offline CA")
+	issuerPKCS11Label := fs.String("issuer-pkcs11-label", "", "label of the offline CA key on the PKCS#11 token")
+	outPath := fs.String("out", "", "file to write the signed CRL or certificate to (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *requestPath == "" || *issuerCertPath == "" || *outPath == "" || (*issuerKeyPath == "" && *issuerPKCS11Label == "") {
+		return usageError("sign-request --request [file] --issuer-cert [file] --issuer-key [file] | --issuer-pkcs11-label [label] --out [file]")
+	}
+
+	request, issuer, err := readSigningRequest(*requestPath)
+	if err != nil {
+		return err
+	}
+
+	// The request names the CA it expects, it must be the one whose key is used here
+	offline, err := util.ParseCertificate(*issuerCertPath)
+	if err != nil {
+		return err
+	}
+	if !offline.Equal(issuer) {
+		return fmt.Errorf("request is for %s (key %s), not for %s (key %s)", issuer.Subject, util.KeyID(issuer), offline.Subject, util.KeyID(offline))
+	}
+
+	if _, err := os.Stat(*outPath); err == nil {
+		return fmt.Errorf("%s already exists", *outPath)
+	}
+
+	loadKey := func() (crypto.Signer, error) {
+		return loadIssuerKey(cfg, *issuerKeyPath, *issuerPKCS11Label, configuredPassphrase(cfg, *issuerKeyPath))
+	}
+
+	var block *pem.Block
+	switch request.Type {
+	case requestTypeCRL:
+		block, err = signCRLRequest(request, issuer, loadKey)
+	case requestTypeIntermediate:
+		block, err = signIntermediateRequest(request, issuer, loadKey)
+	default:
+		err = fmt.Errorf("unsupported request type %s", request.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(*outPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", *outPath, err)
+	}
+	defer file.Close()
+	if err := pem.Encode(file, block); err != nil {
+		return fmt.Errorf("failed to write %s: %v", *outPath, err)
+	}
+
+	fmt.Printf("Wrote signed %s to %s\n", request.Type, *outPath)
+	fmt.Println("Import it on the online host with: gcipher cactl import-signed --request [file] --signed [file]")
+	return nil
+}
+
+// signCRLRequest shows the revoked CAs of the request and signs the CRL.
+func signCRLRequest(request *signingRequest, issuer *x509.Certificate, loadKey func() (crypto.Signer, error)) (*pem.Block, error) {
+	template, err := crlTemplate(request)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("CRL number %s of %s, next update in %d days\n", request.CRLNumber, issuer.Subject, request.NextUpdateDays)
+	for _, entry := range request.Revoked {
+		fmt.Printf("  revoked %s %s at %s, reason %d\n", entry.SerialNumber, entry.Subject, entry.RevokedAt.Format(time.RFC3339), entry.Reason)
+	}
+
+	key, err := loadKey()
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, issuer, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL: %v", err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CRL: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("issuer key doesn't match the issuer certificate: %v", err)
+	}
+	return &pem.Block{Type: "X509 CRL", Bytes: der}, nil
+}
+
+// signIntermediateRequest shows the requested intermediate CA and signs its certificate.
+func signIntermediateRequest(request *signingRequest, issuer *x509.Certificate, loadKey func() (crypto.Signer, error)) (*pem.Block, error) {
+	template, csr, err := intermediateTemplate(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIssuer(issuer, template); err != nil {
+		return nil, err
+	}
+
+	publicKeyType, publicKeySize := keyTypeOf(csr.PublicKey)
+	fmt.Printf("Intermediate CA %s signed by %s\n", template.Subject, issuer.Subject)
+	fmt.Printf("  key: %s %d, valid until %s, path length %d\n", publicKeyType, publicKeySize, template.NotAfter.Format(time.DateOnly), request.PathLen)
+	for _, constraint := range [][]string{request.PermittedDNS, request.PermittedIPs, request.PermittedEmails} {
+		for _, name := range constraint {
+			fmt.Printf("  permitted: %s\n", name)
+		}
+	}
+	for _, constraint := range [][]string{request.ExcludedDNS, request.ExcludedIPs, request.ExcludedEmails} {
+		for _, name := range constraint {
+			fmt.Printf("  excluded: %s\n", name)
+		}
+	}
+
+	key, err := loadKey()
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, csr.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	if err := cert.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("issuer key doesn't match the issuer certificate: %v", err)
+	}
+	return &pem.Block{Type: "CERTIFICATE", Bytes: der}, nil
+}
+
+// ImportSigned checks a CRL or certificate signed on the offline host against its request and
+// stores it. CRLs are served by /public/ca/intermediate/crl/{keyid} with the key ID of the
+// offline CA, intermediate certificates are written to the path chosen when the request was
+// made and recorded like the ones created by init-intermediate.
+func ImportSigned(args []string) error {
+	fs := flag.NewFlagSet("gcipher cactl import-signed", flag.ContinueOnError)
+	requestPath := fs.String("request", "", "request file the artefact was signed for (required)")
+	signedPath := fs.String("signed", "", "signed CRL or certificate (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *requestPath == "" || *signedPath == "" {
+		return usageError("import-signed --request [file] --signed [file]")
+	}
+
+	request, issuer, err := readSigningRequest(*requestPath)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(*signedPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", *signedPath, err)
+	}
+	der := content
+	if block, _ := pem.Decode(content); block != nil {
+		der = block.Bytes
+	}
+
+	switch request.Type {
+	case requestTypeCRL:
+		return importCRL(request, issuer, der)
+	case requestTypeIntermediate:
+		return importIntermediate(request, issuer, der)
+	default:
+		return fmt.Errorf("unsupported request type %s", request.Type)
+	}
+}
+
+func importCRL(request *signingRequest, issuer *x509.Certificate, der []byte) error {
+	if err := checkOffline(issuer); err != nil {
+		return err
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return fmt.Errorf("invalid CRL: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("CRL is not signed by %s: %v", issuer.Subject, err)
+	}
+
+	if crl.Number == nil || crl.Number.String() != request.CRLNumber {
+		return fmt.Errorf("CRL number %v doesn't match the requested number %s", crl.Number, request.CRLNumber)
+	}
+	listed := make([]string, 0, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		listed = append(listed, fmt.Sprintf("%x", entry.SerialNumber))
+	}
+	for _, entry := range request.Revoked {
+		if !slices.Contains(listed, entry.SerialNumber) {
+			return fmt.Errorf("CRL doesn't list the requested revocation of %s", entry.SerialNumber)
+		}
+	}
+	if len(listed) != len(request.Revoked) {
+		return fmt.Errorf("CRL lists %d certificates, the request %d", len(listed), len(request.Revoked))
+	}
+
+	// A CRL signed for an older request must not replace a newer one
+	number, err := nextOfflineCRLNumber(issuer)
+	if err != nil {
+		return err
+	}
+	if crl.Number.Cmp(number) < 0 {
+		return fmt.Errorf("a CRL with number %s or higher was imported already", crl.Number)
+	}
+
+	crlRepo, err := repositories.NewCRLRepository()
+	if err != nil {
+		return err
+	}
+	keyID := util.KeyID(issuer)
+	if err := crlRepo.InsertOrUpdate(*models.NewCRL(keyID, der)); err != nil {
+		return fmt.Errorf("failed to store CRL: %v", err)
+	}
+
+	fmt.Printf("Imported CRL number %s of %s, next update due %s\n", crl.Number, issuer.Subject, crl.NextUpdate.Format(time.RFC3339))
+	fmt.Printf("Served at /public/ca/intermediate/crl/%s\n", keyID)
+	return nil
+}
+
+func importIntermediate(request *signingRequest, issuer *x509.Certificate, der []byte) error {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("invalid certificate: %v", err)
+	}
+	if err := cert.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("certificate is not signed by %s: %v", issuer.Subject, err)
+	}
+
+	template, csr, err := intermediateTemplate(request)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(cert.RawSubjectPublicKeyInfo, csr.RawSubjectPublicKeyInfo) {
+		return errors.New("certificate doesn't certify the key of the request")
+	}
+	if !bytes.Equal(cert.RawSubject, csr.RawSubject) || !cert.IsCA || cert.MaxPathLen != template.MaxPathLen {
+		return errors.New("certificate doesn't match the subject and constraints of the request")
+	}
+
+	repo, err := connectCARepository()
+	if err != nil {
+		return err
+	}
+
+	opts := caOptions{certPath: request.CertPath}
+	if _, err := os.Stat(opts.certPath); err == nil {
+		return fmt.Errorf("%s already exists", opts.certPath)
+	}
+
+	ca := models.CA{
+		SerialNumber:       fmt.Sprintf("%x", cert.SerialNumber),
+		Type:               models.CATypeIntermediate,
+		Subject:            cert.Subject.String(),
+		SubjectKeyID:       util.KeyID(cert),
+		Generation:         1,
+		IssuerSerialNumber: fmt.Sprintf("%x", issuer.SerialNumber),
+		CertificatePEM:     pemEncode(der),
+		KeyStorage:         request.KeyStorage,
+		KeyReference:       request.KeyReference,
+		MaxPathLen:         request.PathLen,
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		CreatedAt:          time.Now(),
+	}
+
+	file, err := os.OpenFile(opts.certPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate file: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(ca.CertificatePEM); err != nil {
+		return fmt.Errorf("failed to write certificate: %v", err)
+	}
+
+	if err := repo.Insert(ca); err != nil {
+		return fmt.Errorf("certificate was written, but recording the CA in the database failed: %v", err)
+	}
+
+	printCA(cert, &ca, &opts)
+	return nil
+}
+
+func newSigningRequest(requestType string, issuer *x509.Certificate) *signingRequest {
+	return &signingRequest{
+		Version:           signingRequestVersion,
+		Type:              requestType,
+		CreatedAt:         time.Now().UTC(),
+		IssuerCertificate: string(pemEncode(issuer.Raw)),
+	}
+}
+
+func writeSigningRequest(path string, request *signingRequest) error {
+	content, err := json.MarshalIndent(request, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create request file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		return fmt.Errorf("failed to write request file: %v", err)
+	}
+	return nil
+}
+
+// readSigningRequest reads a request file and the certificate of the CA it is addressed to.
+func readSigningRequest(path string) (*signingRequest, *x509.Certificate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read request: %v", err)
+	}
+
+	var request signingRequest
+	if err := json.Unmarshal(content, &request); err != nil {
+		return nil, nil, fmt.Errorf("invalid request: %v", err)
+	}
+	if request.Version != signingRequestVersion {
+		return nil, nil, fmt.Errorf("unsupported request version %d", request.Version)
+	}
+
+	issuer, err := util.ParseCertificateFromBytes([]byte(request.IssuerCertificate))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid issuer certificate in request: %v", err)
+	}
+	return &request, issuer, nil
+}
+
+func crlTemplate(request *signingRequest) (*x509.RevocationList, error) {
+	number, ok := new(big.Int).SetString(request.CRLNumber, 10)
+	if !ok || number.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid CRL number %s", request.CRLNumber)
+	}
+	if request.NextUpdateDays <= 0 {
+		return nil, fmt.Errorf("invalid next update of %d days", request.NextUpdateDays)
+	}
+
+	now := time.Now()
+	template := &x509.RevocationList{
+		Number:                    number,
+		ThisUpdate:                now,
+		NextUpdate:                now.AddDate(0, 0, request.NextUpdateDays),
+		RevokedCertificateEntries: []x509.RevocationListEntry{},
+	}
+	for _, entry := range request.Revoked {
+		serialNumber, ok := new(big.Int).SetString(entry.SerialNumber, 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid serial number %s", entry.SerialNumber)
+		}
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   serialNumber,
+			RevocationTime: entry.RevokedAt,
+			ReasonCode:     entry.Reason,
+		})
+	}
+	return template, nil
+}
+
+// intermediateTemplate builds the certificate template of an intermediate request, the subject
+// is taken from the CSR after checking its signature.
+func intermediateTemplate(request *signingRequest) (*x509.Certificate, *x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(request.CSR))
+	if block == nil {
+		return nil, nil, errors.New("request has no CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSR: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("invalid CSR signature: %v", err)
+	}
+
+	template, err := newTemplate(&caOptions{
+		days:            request.Days,
+		pathLen:         request.PathLen,
+		permittedDNS:    request.PermittedDNS,
+		excludedDNS:     request.ExcludedDNS,
+		permittedIPs:    request.PermittedIPs,
+		excludedIPs:     request.ExcludedIPs,
+		permittedEmails: request.PermittedEmails,
+		excludedEmails:  request.ExcludedEmails,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// The raw subject keeps the encoding of the CSR, the import compares it byte for byte
+	template.Subject = csr.Subject
+	template.RawSubject = csr.RawSubject
+	return template, csr, nil
+}
+
+// checkOffline fails if the server generates the CRLs of the CA itself because its key is
+// configured as a generation of the signing CA.
+func checkOffline(issuer *x509.Certificate) error {
+	cfg, err := config.GetConfigWithoutCA()
+	if err != nil {
+		return err
+	}
+
+	paths := []string{cfg.CACertPath}
+	for _, generation := range cfg.CAGenerationConfigs {
+		paths = append(paths, generation.CertPath)
+	}
+	for _, path := range paths {
+		if cert, err := util.ParseCertificate(path); err == nil && util.KeyID(cert) == util.KeyID(issuer) {
+			return fmt.Errorf("%s is configured as signing CA, its CRLs are generated by the server", issuer.Subject)
+		}
+	}
+	return nil
+}
+
+// nextOfflineCRLNumber returns the number following the one of the latest imported CRL of the
+// offline CA.
+func nextOfflineCRLNumber(issuer *x509.Certificate) (*big.Int, error) {
+	crlRepo, err := repositories.NewCRLRepository()
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := crlRepo.FindByIssuer(util.KeyID(issuer))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return big.NewInt(1), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the latest CRL: %v", err)
+	}
+
+	crl, err := x509.ParseRevocationList(latest.CRLBytes)
+	if err != nil || crl.Number == nil {
+		return big.NewInt(1), nil
+	}
+	return new(big.Int).Add(crl.Number, big.NewInt(1)), nil
+}
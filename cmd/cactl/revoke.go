@@ -0,0 +1,67 @@
+package cactl
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// revocationReasons maps the --reason names to RFC 5280 CRLReason codes
+var revocationReasons = map[string]int{
+	"unspecified":          0,
+	"keycompromise":        1,
+	"cacompromise":         2,
+	"affiliationchanged":   3,
+	"superseded":           4,
+	"cessationofoperation": 5,
+}
+
+// RevokeCA marks a CA recorded in the database as revoked. Its issuer lists it on the next
+// CRL, for an offline root that is the next CRL exported with export-crl-request.
+func RevokeCA(args []string) error {
+	fs := flag.NewFlagSet("gcipher cactl revoke", flag.ContinueOnError)
+	serialNumber := fs.String("serial", "", "hex serial number of the CA certificate (required)")
+	reasonName := fs.String("reason", "unspecified", "unspecified, keyCompromise, cACompromise, affiliationChanged, superseded or cessationOfOperation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *serialNumber == "" {
+		return usageError("revoke --serial [hex] [--reason name]")
+	}
+
+	reason, ok := revocationReasons[strings.ToLower(*reasonName)]
+	if !ok {
+		return fmt.Errorf("unknown revocation reason %s", *reasonName)
+	}
+
+	repo, err := connectCARepository()
+	if err != nil {
+		return err
+	}
+
+	serial := strings.ToLower(strings.TrimPrefix(*serialNumber, "0x"))
+	ca, err := repo.FindBySerialNumber(serial)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("no CA with serial number %s", serial)
+	}
+	if err != nil {
+		return err
+	}
+	if ca.IssuerSerialNumber == "" {
+		return fmt.Errorf("%s is a root CA, remove it from the trust stores instead", ca.Subject)
+	}
+	if ca.RevokedAt != nil {
+		return fmt.Errorf("%s was already revoked at %s", ca.Subject, ca.RevokedAt.Format(time.RFC3339))
+	}
+
+	if err := repo.Revoke(serial, time.Now().UTC().Truncate(time.Second), reason); err != nil {
+		return fmt.Errorf("failed to revoke CA: %v", err)
+	}
+
+	fmt.Printf("Revoked %s CA %s\n", ca.Type, ca.Subject)
+	return nil
+}
@@ -0,0 +1,338 @@
+package cactl
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/util"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Rollover creates the next generation of a CA: a new key and a certificate with the subject
+// and constraints of the current generation. Self-signed CAs sign the new certificate with
+// the new key, other CAs need the key of their issuer.
+func Rollover(args []string) error {
+	cfg, err := config.GetConfigWithoutCA()
+	if err != nil {
+		return err
+	}
+
+	var opts caOptions
+	fs := flag.NewFlagSet("gcipher cactl rollover", flag.ContinueOnError)
+	currentPath := fs.String("current", cfg.CACertPath, "certificate of the current generation")
+	fs.StringVar(&opts.certPath, "cert", "", "certificate file to write (required)")
+	fs.StringVar(&opts.keyPath, "key", "", "encrypted key file to write, required without --pkcs11-label")
+	fs.StringVar(&opts.pkcs11Label, "pkcs11-label", "", "generate the key on the configured PKCS#11 token with this label instead of writing a key file")
+	fs.StringVar(&opts.keyType, "key-type", "", "key type, ecdsa or rsa, defaults to the type of the current key")
+	fs.IntVar(&opts.keySize, "key-size", 0, "key size, defaults to the size of the current key if --key-type isn't set")
+	fs.IntVar(&opts.days, "days", 0, "validity in days, defaults to the validity of the current certificate")
+	issuerCertPath := fs.String("issuer-cert", "", "certificate of the issuing CA, required unless the current certificate is self-signed")
+	issuerKeyPath := fs.String("issuer-key", "", "key file of the issuing CA")
+	issuerPKCS11Label := fs.String("issuer-pkcs11-label", "", "label of the issuing CA key on the PKCS#11 token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.certPath == "" || (opts.keyPath == "" && opts.pkcs11Label == "") {
+		return usageError("rollover --cert [file] --key [file] | --pkcs11-label [label] [flags]")
+	}
+
+	current, err := util.ParseCertificate(*currentPath)
+	if err != nil {
+		return err
+	}
+	if !current.IsCA {
+		return fmt.Errorf("%s is not a CA certificate", current.Subject)
+	}
+
+	if opts.keyType == "" {
+		opts.keyType, opts.keySize = keyTypeOf(current.PublicKey)
+	}
+	if opts.days == 0 {
+		opts.days = int(current.NotAfter.Sub(current.NotBefore).Hours() / 24)
+	}
+	opts.pathLen = current.MaxPathLen
+
+	template, err := rolloverTemplate(current, opts.days)
+	if err != nil {
+		return err
+	}
+
+	caType := models.CATypeRoot
+	var issuer *x509.Certificate
+	selfSigned := isSelfSigned(current)
+	if !selfSigned {
+		if *issuerCertPath == "" || (*issuerKeyPath == "" && *issuerPKCS11Label == "") {
+			return usageError("rollover --cert [file] --key [file] --issuer-cert [file] --issuer-key [file] | --issuer-pkcs11-label [label] [flags]")
+		}
+		caType = models.CATypeIntermediate
+		if issuer, err = util.ParseCertificate(*issuerCertPath); err != nil {
+			return err
+		}
+		if err := checkIssuer(issuer, template); err != nil {
+			return err
+		}
+	}
+
+	if err := checkOutputs(&opts); err != nil {
+		return err
+	}
+
+	generation, err := nextGeneration(current)
+	if err != nil {
+		return err
+	}
+
+	var issuerKey crypto.Signer
+	if !selfSigned {
+		if issuerKey, err = loadIssuerKey(cfg, *issuerKeyPath, *issuerPKCS11Label, configuredPassphrase(cfg, *issuerKeyPath)); err != nil {
+			return err
+		}
+	}
+
+	if err := createCA(cfg, &opts, template, caType, generation, issuer, issuerKey); err != nil {
+		return err
+	}
+
+	if selfSigned {
+		// Clients that only trust one of the roots need a path to the other one
+		fmt.Println()
+		fmt.Println("Cross-sign the generations, then add both files to ca_cross_cert_paths:")
+		fmt.Printf("gcipher cactl cross-sign --cert %s --issuer-cert %s --issuer-key [current key] --out [file]\n", opts.certPath, *currentPath)
+		fmt.Printf("gcipher cactl cross-sign --cert %s --issuer-cert %s %s --out [file]\n", *currentPath, opts.certPath, keyFlag(&opts))
+	}
+	return nil
+}
+
+// rolloverTemplate copies the subject, key usage and constraints of the current generation.
+// The subject key identifier is derived from the new key.
+func rolloverTemplate(current *x509.Certificate, days int) (*x509.Certificate, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("--days must be positive")
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := copyCAExtensions(current)
+	template.SerialNumber = serialNumber
+	template.Subject = current.Subject
+	template.NotBefore = now
+	template.NotAfter = now.AddDate(0, 0, days)
+	return template, nil
+}
+
+// copyCAExtensions returns a template with the key usage, basic constraints and name
+// constraints of a CA certificate.
+func copyCAExtensions(cert *x509.Certificate) *x509.Certificate {
+	return &x509.Certificate{
+		KeyUsage:                    cert.KeyUsage,
+		ExtKeyUsage:                 cert.ExtKeyUsage,
+		BasicConstraintsValid:       true,
+		IsCA:                        true,
+		MaxPathLen:                  cert.MaxPathLen,
+		MaxPathLenZero:              cert.MaxPathLenZero,
+		PermittedDNSDomainsCritical: cert.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         cert.PermittedDNSDomains,
+		ExcludedDNSDomains:          cert.ExcludedDNSDomains,
+		PermittedIPRanges:           cert.PermittedIPRanges,
+		ExcludedIPRanges:            cert.ExcludedIPRanges,
+		PermittedEmailAddresses:     cert.PermittedEmailAddresses,
+		ExcludedEmailAddresses:      cert.ExcludedEmailAddresses,
+		PermittedURIDomains:         cert.PermittedURIDomains,
+		ExcludedURIDomains:          cert.ExcludedURIDomains,
+	}
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// nextGeneration returns the generation following the one recorded for the certificate. CAs
+// that weren't created with cactl count as the first generation.
+func nextGeneration(current *x509.Certificate) (int, error) {
+	repo, err := connectCARepository()
+	if err != nil {
+		return 0, err
+	}
+
+	ca, err := repo.FindBySerialNumber(fmt.Sprintf("%x", current.SerialNumber))
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && ca.Generation == 0) {
+		return 2, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up the current generation: %v", err)
+	}
+	return ca.Generation + 1, nil
+}
+
+func keyFlag(opts *caOptions) string {
+	if opts.pkcs11Label != "" {
+		return "--issuer-pkcs11-label " + opts.pkcs11Label
+	}
+	return "--issuer-key " + opts.keyPath
+}
+
+// CrossSign certifies the key and subject of a CA certificate with another CA. During a root
+// rollover the new root is cross-signed with the old one and the old root with the new one,
+// so clients trusting either root can build a path to certificates of both.
+func CrossSign(args []string) error {
+	cfg, err := config.GetConfigWithoutCA()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("gcipher cactl cross-sign", flag.ContinueOnError)
+	subjectPath := fs.String("cert", "", "CA certificate to cross-sign (required)")
+	issuerCertPath := fs.String("issuer-cert", "", "certificate of the signing CA (required)")
+	issuerKeyPath := fs.String("issuer-key", "", "key file of the signing CA")
+	issuerPKCS11Label := fs.String("issuer-pkcs11-label", "", "label of the signing CA key on the PKCS#11 token")
+	outPath := fs.String("out", "", "certificate file to write (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *subjectPath == "" || *issuerCertPath == "" || *outPath == "" || (*issuerKeyPath == "" && *issuerPKCS11Label == "") {
+		return usageError("cross-sign --cert [file] --issuer-cert [file] --issuer-key [file] | --issuer-pkcs11-label [label] --out [file]")
+	}
+
+	subject, err := util.ParseCertificate(*subjectPath)
+	if err != nil {
+		return err
+	}
+	issuer, err := util.ParseCertificate(*issuerCertPath)
+	if err != nil {
+		return err
+	}
+	if !subject.IsCA {
+		return fmt.Errorf("%s is not a CA certificate", subject.Subject)
+	}
+	if bytes.Equal(subject.RawSubjectPublicKeyInfo, issuer.RawSubjectPublicKeyInfo) {
+		return fmt.Errorf("%s and the issuer share the same key", *subjectPath)
+	}
+
+	template, err := crossSignTemplate(subject, issuer)
+	if err != nil {
+		return err
+	}
+	if err := checkIssuer(issuer, template); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*outPath); err == nil {
+		return fmt.Errorf("%s already exists", *outPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	repo, err := connectCARepository()
+	if err != nil {
+		return err
+	}
+
+	issuerKey, err := loadIssuerKey(cfg, *issuerKeyPath, *issuerPKCS11Label, configuredPassphrase(cfg, *issuerKeyPath))
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, subject.PublicKey, issuerKey)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	if err := cert.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("issuer key doesn't match the issuer certificate: %v", err)
+	}
+
+	ca := models.CA{
+		SerialNumber:       fmt.Sprintf("%x", cert.SerialNumber),
+		Type:               models.CATypeCrossSigned,
+		Subject:            cert.Subject.String(),
+		SubjectKeyID:       util.KeyID(cert),
+		IssuerSerialNumber: fmt.Sprintf("%x", issuer.SerialNumber),
+		CertificatePEM:     pemEncode(der),
+		MaxPathLen:         cert.MaxPathLen,
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		CreatedAt:          time.Now(),
+	}
+
+	// The cross-signed certificate shares the key of the CA it was issued for
+	if subjectCA, err := repo.FindBySerialNumber(fmt.Sprintf("%x", subject.SerialNumber)); err == nil {
+		ca.Generation = subjectCA.Generation
+		ca.KeyStorage = subjectCA.KeyStorage
+		ca.KeyReference = subjectCA.KeyReference
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("failed to look up %s: %v", subject.Subject, err)
+	}
+
+	file, err := os.OpenFile(*outPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate file: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(ca.CertificatePEM); err != nil {
+		return fmt.Errorf("failed to write certificate: %v", err)
+	}
+
+	if err := repo.Insert(ca); err != nil {
+		return fmt.Errorf("certificate was created, but recording it in the database failed: %v", err)
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	certPath, _ := filepath.Abs(*outPath)
+
+	fmt.Printf("Cross-signed %s with %s\n", ca.Subject, issuer.Subject)
+	fmt.Printf("Serial number: %s\n", ca.SerialNumber)
+	fmt.Printf("SHA-256 fingerprint: %X\n", fingerprint)
+	fmt.Printf("Valid until: %s\n", cert.NotAfter.Format(time.DateOnly))
+	fmt.Println()
+	fmt.Println("Configuration, add to the existing ca_cross_cert_paths:")
+	fmt.Println("ca_cross_cert_paths:")
+	fmt.Printf("  - %s\n", certPath)
+	return nil
+}
+
+// crossSignTemplate copies the subject, key identifier and constraints of the CA certificate.
+// The validity ends with the subject or the issuer, whichever expires first.
+func crossSignTemplate(subject, issuer *x509.Certificate) (*x509.Certificate, error) {
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := subject.NotAfter
+	if issuer.NotAfter.Before(notAfter) {
+		notAfter = issuer.NotAfter
+	}
+	if !notAfter.After(now) {
+		return nil, fmt.Errorf("%s or the issuer has expired", subject.Subject)
+	}
+
+	template := copyCAExtensions(subject)
+	template.SerialNumber = serialNumber
+	template.Subject = subject.Subject
+	template.SubjectKeyId = subject.SubjectKeyId
+	// Only set by crypto/x509 if issuer and subject names differ, which they don't when the
+	// generations of a root are cross-signed
+	template.AuthorityKeyId = issuer.SubjectKeyId
+	template.NotBefore = now
+	template.NotAfter = notAfter
+	return template, nil
+}
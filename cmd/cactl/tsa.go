@@ -0,0 +1,316 @@
+package cactl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"gcipher/internal/certificate"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/tsa"
+	"gcipher/internal/util"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultTSADays is the default validity of TSA certificates. Tokens stay verifiable after it
+// ends, a shorter validity limits how long a compromised key can issue timestamps.
+const defaultTSADays = 3 * 365
+
+var (
+	oidExtKeyUsage       = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidTimeStamping      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+	errTimestampMismatch = errors.New("timestamp was not issued for this data")
+)
+
+// InitTSA issues the timestamping certificate of the TSA, signed by the configured CA unless
+// flags name another issuer, and records it with the issued certificates.
+func InitTSA(args []string) error {
+	cfg, err := config.GetConfigWithoutCA()
+	if err != nil {
+		return err
+	}
+
+	var opts caOptions
+	fs := flag.NewFlagSet("gcipher cactl init-tsa", flag.ContinueOnError)
+	fs.StringVar(&opts.commonName, "cn", "", "common name of the TSA (required)")
+	fs.StringVar(&opts.organization, "org", "", "organization of the TSA")
+	fs.StringVar(&opts.country, "country", "", "two letter country code of the TSA")
+	fs.StringVar(&opts.keyType, "key-type", "ecdsa", "key type, ecdsa or rsa")
+	fs.IntVar(&opts.keySize, "key-size", 0, "ECDSA curve size (256, 384 or 521, default 384) or RSA key size (3072 or 4096, default 4096)")
+	fs.IntVar(&opts.days, "days", defaultTSADays, "validity in days")
+	fs.StringVar(&opts.certPath, "cert", "tsa.crt", "certificate file to write")
+	fs.StringVar(&opts.keyPath, "key", "tsa.key", "encrypted key file to write")
+	fs.StringVar(&opts.pkcs11Label, "pkcs11-label", "", "generate the key on the configured PKCS#11 token with this label instead of writing a key file")
+	owner := fs.String("owner", "", "user the certificate is recorded for (required)")
+	issuerCertPath := fs.String("issuer-cert", cfg.CACertPath, "certificate of the issuing CA")
+	issuerKeyPath := fs.String("issuer-key", cfg.CAKeyPath, "key file of the issuing CA")
+	issuerPKCS11Label := fs.String("issuer-pkcs11-label", cfg.CAKeyPKCS11Label, "label of the issuing CA key on the PKCS#11 token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.commonName == "" || *owner == "" {
+		return usageError("init-tsa --cn [common name] --owner [username] [flags]")
+	}
+
+	issuer, err := util.ParseCertificate(*issuerCertPath)
+	if err != nil {
+		return err
+	}
+	template, err := newTSATemplate(&opts)
+	if err != nil {
+		return err
+	}
+	if !issuer.IsCA || issuer.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("%s is not allowed to sign certificates", issuer.Subject)
+	}
+	if template.NotAfter.After(issuer.NotAfter) {
+		return fmt.Errorf("requested validity exceeds the validity of %s, which ends on %s", issuer.Subject, issuer.NotAfter.Format(time.DateOnly))
+	}
+	if err := checkOutputs(&opts); err != nil {
+		return err
+	}
+
+	// Fail before any key is generated if the certificate can't be recorded
+	if err := pingDatabase(); err != nil {
+		return err
+	}
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return err
+	}
+	if _, err := userRepo.FindByUsername(*owner); errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("user %s doesn't exist", *owner)
+	} else if err != nil {
+		return err
+	}
+	certRepo, err := repositories.NewCertificateRepository()
+	if err != nil {
+		return err
+	}
+
+	issuerKey, err := loadIssuerKey(cfg, *issuerKeyPath, *issuerPKCS11Label, configuredPassphrase(cfg, *issuerKeyPath))
+	if err != nil {
+		return err
+	}
+
+	key, err := generateKey(cfg, opts.keyType, opts.keySize, opts.pkcs11Label)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	if err := cert.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("issuer key doesn't match the issuer certificate: %v", err)
+	}
+
+	keyStorage, keyReference, err := storeKey(cfg, &opts, key)
+	if err != nil {
+		return err
+	}
+
+	record := models.NewCertificate(fmt.Sprintf("%x", cert.SerialNumber), pemEncode(der), *owner)
+	record.IssuedAt = cert.NotBefore
+	record.NotAfter = cert.NotAfter
+	record.IssuerKeyID = util.KeyID(issuer)
+
+	if err := os.WriteFile(opts.certPath, record.CertificatePEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %v", err)
+	}
+
+	if err := certRepo.Insert(*record); err != nil {
+		return fmt.Errorf("certificate and key were created, but recording the certificate in the database failed: %v", err)
+	}
+
+	printTSA(cert, record, &opts, keyStorage, keyReference)
+	return nil
+}
+
+// newTSATemplate builds the TSA certificate template. RFC 3161 requires timeStamping to be the
+// only extended key usage and the extension to be critical, x509 always writes it non-critical,
+// so it is added as an extra extension.
+func newTSATemplate(opts *caOptions) (*x509.Certificate, error) {
+	if opts.days <= 0 {
+		return nil, fmt.Errorf("--days must be positive")
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	extKeyUsage, err := asn1.Marshal([]asn1.ObjectIdentifier{oidTimeStamping})
+	if err != nil {
+		return nil, err
+	}
+
+	subject := pkix.Name{CommonName: opts.commonName}
+	if opts.organization != "" {
+		subject.Organization = []string{opts.organization}
+	}
+	if opts.country != "" {
+		subject.Country = []string{opts.country}
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		NotBefore:             now,
+		NotAfter:              now.AddDate(0, 0, opts.days),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: oidExtKeyUsage, Critical: true, Value: extKeyUsage}},
+	}, nil
+}
+
+func printTSA(cert *x509.Certificate, record *models.Certificate, opts *caOptions, keyStorage, keyReference string) {
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	fmt.Printf("Created TSA certificate %s\n", cert.Subject)
+	fmt.Printf("Serial number: %s\n", record.SerialNumber)
+	fmt.Printf("SHA-256 fingerprint: %X\n", fingerprint)
+	fmt.Printf("Valid until: %s\n", cert.NotAfter.Format(time.DateOnly))
+	fmt.Println()
+
+	certPath, _ := filepath.Abs(opts.certPath)
+	fmt.Println("Configuration:")
+	fmt.Printf("tsa_cert_path: %s\n", certPath)
+	if keyStorage == models.KeyStoragePKCS11 {
+		fmt.Printf("tsa_key_pkcs11_label: %s\n", keyReference)
+	} else {
+		fmt.Printf("tsa_key_path: %s\n", keyReference)
+		fmt.Println("tsa_key_passphrase: the passphrase of the key file")
+	}
+	fmt.Println("tsa_policy: the OID of your timestamping policy")
+}
+
+// VerifyTimestamp verifies a timestamp response or token and checks that it was issued for the
+// data. The TSA certificate has to chain to the configured CAs, or to the CA certificates given
+// with --ca-cert, which don't need a config.
+func VerifyTimestamp(args []string) error {
+	fs := flag.NewFlagSet("gcipher cactl verify-timestamp", flag.ContinueOnError)
+	dataPath := fs.String("data", "", "file the timestamp was requested for")
+	digestHex := fs.String("digest", "", "hex encoded digest the timestamp was requested for, instead of --data")
+	isToken := fs.Bool("token", false, "the file is a bare timestamp token instead of a timestamp response")
+	var caCertPaths, certPaths listFlag
+	fs.Var(&caCertPaths, "ca-cert", "trusted CA certificate files (repeatable, comma separated), defaults to the configured CAs")
+	fs.Var(&certPaths, "tsa-cert", "TSA and intermediate certificate files, if the token doesn't include them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || (*dataPath == "") == (*digestHex == "") {
+		return usageError("verify-timestamp --data [file] | --digest [hex] [--token] [--ca-cert file] [--tsa-cert file] [response file]")
+	}
+
+	der, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read timestamp: %v", err)
+	}
+	if !*isToken {
+		if der, err = tsa.ParseResponse(der); err != nil {
+			return err
+		}
+	}
+
+	roots, intermediates, err := timestampTrustAnchors(caCertPaths)
+	if err != nil {
+		return err
+	}
+	var certs []*x509.Certificate
+	for _, path := range certPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read certificate: %v", err)
+		}
+		parsed, err := certificate.ParseCertificates(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		certs = append(certs, parsed...)
+	}
+
+	token, err := tsa.VerifyToken(der, roots, intermediates, certs)
+	if err != nil {
+		return err
+	}
+
+	if *dataPath != "" {
+		file, err := os.Open(*dataPath)
+		if err != nil {
+			return fmt.Errorf("failed to read data: %v", err)
+		}
+		defer file.Close()
+		matches, err := token.Matches(file)
+		if err != nil {
+			return fmt.Errorf("failed to read data: %v", err)
+		}
+		if !matches {
+			return errTimestampMismatch
+		}
+	} else {
+		digest, err := hex.DecodeString(*digestHex)
+		if err != nil {
+			return fmt.Errorf("invalid --digest: %v", err)
+		}
+		if !bytes.Equal(digest, token.HashedMessage) {
+			return errTimestampMismatch
+		}
+	}
+
+	fmt.Printf("Time:          %s (accuracy %s)\n", token.GenTime.Format(time.RFC3339), token.Accuracy)
+	fmt.Printf("Serial number: %s\n", token.SerialNumber)
+	fmt.Printf("Policy:        %s\n", token.Policy)
+	fmt.Printf("Hash:          %s\n", token.HashAlgorithm)
+	fmt.Printf("TSA:           %s\n", token.Signer.Subject)
+	for _, ca := range token.Chain {
+		fmt.Printf("Chain:         %s\n", ca.Subject)
+	}
+	fmt.Println("Timestamp is valid")
+	return nil
+}
+
+// timestampTrustAnchors reads the CA certificates to verify timestamps with, the configured
+// CAs if no files are given.
+func timestampTrustAnchors(paths []string) (roots, intermediates *x509.CertPool, err error) {
+	if len(paths) == 0 {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load config: %v", err)
+		}
+		roots, intermediates = cfg.TrustAnchors()
+		return roots, intermediates, nil
+	}
+
+	var cas []*x509.Certificate
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		certs, err := certificate.ParseCertificates(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		cas = append(cas, certs...)
+	}
+	roots, intermediates = config.TrustPools(cas)
+	return roots, intermediates, nil
+}
@@ -0,0 +1,89 @@
+package cactl
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gcipher/internal/certificate"
+	"gcipher/internal/config"
+	"gcipher/internal/db/repositories"
+	"os"
+	"strings"
+)
+
+// errNotValid is returned by verify if a check failed, so the command exits with status 1
+var errNotValid = errors.New("certificate is not valid")
+
+// VerifyCertificate prints gcipher's verdict on a certificate file: the chain to the configured
+// CAs, validity, revocation status and optionally purpose and name.
+func VerifyCertificate(args []string) error {
+	fs := flag.NewFlagSet("gcipher cactl verify", flag.ContinueOnError)
+	purpose := fs.String("purpose", "", "server, client, smime, codesigning or timestamping")
+	name := fs.String("name", "", "DNS name, IP address or email address the certificate must be valid for")
+	asJSON := fs.Bool("json", false, "print the verdict as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("verify [--purpose type] [--name name] [--json] [certificate file]")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %v", err)
+	}
+	certs, err := certificate.ParseCertificates(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+	certRepo, err := repositories.NewCertificateRepository()
+	if err != nil {
+		return err
+	}
+	caRepo, err := repositories.NewCARepository()
+	if err != nil {
+		return err
+	}
+
+	result, err := certificate.VerifyCertificate(cfg, certRepo, caRepo, certs[0], certificate.VerifyOptions{
+		Purpose:       *purpose,
+		Name:          *name,
+		Intermediates: certs[1:],
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Subject:       %s\n", result.Subject)
+		fmt.Printf("Issuer:        %s\n", result.Issuer)
+		fmt.Printf("Serial number: %s\n", result.SerialNumber)
+		for _, subject := range result.Chain {
+			fmt.Printf("Chain:         %s\n", subject)
+		}
+		for _, check := range result.Checks {
+			verdict := "ok"
+			if !check.Passed {
+				verdict = "FAILED: " + strings.Join(check.Reasons, "; ")
+			}
+			fmt.Printf("%-14s %s\n", check.Check+":", verdict)
+		}
+	}
+
+	if !result.Valid {
+		return errNotValid
+	}
+	if !*asJSON {
+		fmt.Println("Certificate is valid")
+	}
+	return nil
+}
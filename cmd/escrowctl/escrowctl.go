@@ -0,0 +1,152 @@
+package escrowctl
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gcipher/internal/escrow"
+	"os"
+	"strconv"
+)
+
+// Exit codes
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// usageError is returned by commands called with missing or invalid arguments, it holds the usage line
+type usageError string
+
+func (e usageError) Error() string {
+	return "Usage: gcipher escrowctl " + string(e)
+}
+
+// command is an escrowctl subcommand
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"init-kek", "Generate a key encryption key for kek key escrow", InitKEK},
+	{"init-shamir", "Generate an escrow keypair and split its private key into shares", InitShamir},
+}
+
+// Execute runs the escrowctl subcommand named by os.Args[2]. It exits with status 1 if the
+// command fails and with status 2 on usage errors.
+func Execute() {
+	if len(os.Args) < 3 {
+		printUsage()
+		os.Exit(exitUsage)
+	}
+
+	subcommand := os.Args[2]
+	for _, cmd := range commands {
+		if cmd.name != subcommand {
+			continue
+		}
+
+		err := cmd.run(os.Args[3:])
+
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintln(os.Stderr, usage.Error())
+			os.Exit(exitUsage)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", subcommand, err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "Unknown subcommand:", subcommand)
+	printUsage()
+	os.Exit(exitUsage)
+}
+
+func printUsage() {
+	fmt.Println("Usage: gcipher escrowctl [command]")
+	fmt.Println("Available commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %s - %s\n", cmd.name, cmd.description)
+	}
+}
+
+// InitKEK writes a new random 256-bit key encryption key to the given file.
+func InitKEK(args []string) error {
+	if len(args) < 1 {
+		return usageError("init-kek [path]")
+	}
+
+	path := args[0]
+
+	kek := make([]byte, 32)
+	if _, err := rand.Read(kek); err != nil {
+		return fmt.Errorf("failed to generate KEK: %v", err)
+	}
+
+	// Never overwrite an existing KEK, keys escrowed with it would become unrecoverable
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create KEK file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintln(file, hex.EncodeToString(kek)); err != nil {
+		return fmt.Errorf("failed to write KEK file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write KEK file: %v", err)
+	}
+
+	fmt.Printf("KEK created at %s, set key_escrow_mode to kek and key_escrow_kek_path to its path\n", path)
+	return nil
+}
+
+// InitShamir generates the escrow keypair and prints the public key and the shares of the
+// private key. The private key itself is never stored, every share must be handed to a different admin.
+func InitShamir(args []string) error {
+	const usage = usageError("init-shamir [shares] [threshold]")
+	if len(args) < 2 {
+		return usage
+	}
+
+	parts, err := strconv.Atoi(args[0])
+	if err != nil {
+		return usage
+	}
+
+	threshold, err := strconv.Atoi(args[1])
+	if err != nil {
+		return usage
+	}
+
+	if threshold < 2 || parts < threshold || parts > 255 {
+		return errors.New("the threshold must be at least 2 and at most the number of shares, which is at most 255")
+	}
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate escrow keypair: %v", err)
+	}
+
+	shares, err := escrow.Split(key.Bytes(), parts, threshold)
+	if err != nil {
+		return fmt.Errorf("failed to split escrow key: %v", err)
+	}
+
+	fmt.Println("key_escrow_mode: shamir")
+	fmt.Println("key_escrow_public_key:", base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()))
+	fmt.Println("key_escrow_shamir_threshold:", threshold)
+	fmt.Println()
+	for i, share := range shares {
+		fmt.Printf("Share %d: %s\n", i+1, base64.StdEncoding.EncodeToString(share))
+	}
+	return nil
+}
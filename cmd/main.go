@@ -2,6 +2,10 @@ package main
 
 import (
 	"fmt"
+	"gcipher/cmd/backupctl"
+	"gcipher/cmd/cactl"
+	"gcipher/cmd/escrowctl"
+	"gcipher/cmd/migratectl"
 	"gcipher/cmd/userctl"
 	"gcipher/internal/server"
 	"os"
@@ -9,11 +13,8 @@ import (
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: gcipher [command]")
-		fmt.Println("Available commands:")
-		fmt.Println("  server - Start the server")
-		fmt.Println("  userctl - User management")
-		return
+		printUsage()
+		os.Exit(2)
 	}
 
 	command := os.Args[1]
@@ -22,7 +23,28 @@ func main() {
 		server.StartServer()
 	case "userctl":
 		userctl.Execute()
+	case "escrowctl":
+		escrowctl.Execute()
+	case "migratectl":
+		migratectl.Execute()
+	case "backupctl":
+		backupctl.Execute()
+	case "cactl":
+		cactl.Execute()
 	default:
-		fmt.Println("Unknown command:", command)
+		fmt.Fprintln(os.Stderr, "Unknown command:", command)
+		printUsage()
+		os.Exit(2)
 	}
 }
+
+func printUsage() {
+	fmt.Println("Usage: gcipher [command]")
+	fmt.Println("Available commands:")
+	fmt.Println("  server - Start the server")
+	fmt.Println("  userctl - User management")
+	fmt.Println("  escrowctl - Key escrow setup")
+	fmt.Println("  migratectl - Certificate migration")
+	fmt.Println("  backupctl - Backup and restore")
+	fmt.Println("  cactl - CA setup")
+}
@@ -1,57 +1,212 @@
 package migratectl
 
 import (
+	"bytes"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"gcipher/internal/db/models"
 	"gcipher/internal/db/repositories"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// MigrateCerts migrates certificates from a given directory into the database.
-// The "username" parameter specifies the owner of the certificates.
-func MigrateCerts(dir string, username string) error {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return err
+// File statuses of the migration report
+const (
+	StatusImported = "imported"
+	StatusSkipped  = "skipped"
+	StatusFailed   = "failed"
+)
+
+// Report summarizes a migration
+type Report struct {
+	DryRun               bool         `json:"dry_run"`
+	Files                []FileResult `json:"files"`
+	FilesImported        int          `json:"files_imported"`
+	FilesSkipped         int          `json:"files_skipped"`
+	FilesFailed          int          `json:"files_failed"`
+	CertificatesImported int          `json:"certificates_imported"`
+	CertificatesSkipped  int          `json:"certificates_skipped"`
+	CertificatesFailed   int          `json:"certificates_failed"`
+}
+
+// FileResult is the outcome of migrating one file. A file is imported if at least one
+// certificate was imported, skipped if it held nothing new and failed on any error. Database
+// imports report failed entries in Failed and Notes instead of aborting.
+type FileResult struct {
+	Path     string   `json:"path"`
+	Status   string   `json:"status"`
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Failed   int      `json:"failed"`
+	Notes    []string `json:"notes,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (r *Report) add(result FileResult) {
+	switch {
+	case result.Error != "" || result.Failed > 0:
+		result.Status = StatusFailed
+		r.FilesFailed++
+	case result.Imported > 0:
+		result.Status = StatusImported
+		r.FilesImported++
+	default:
+		result.Status = StatusSkipped
+		r.FilesSkipped++
 	}
 
-	for _, file := range files {
-		// Skip directories and hidden files
-		if file.IsDir() || file.Name()[0] == '.' {
-			continue
-		}
+	r.CertificatesImported += result.Imported
+	r.CertificatesSkipped += result.Skipped
+	r.CertificatesFailed += result.Failed
+	r.Files = append(r.Files, result)
+}
+
+// MigrateCerts migrates the certificates of a file or, recursively, of a directory into the
+// database. The "username" parameter specifies the owner of the certificates. Files that can't
+// be read or parsed are reported as failed without aborting the migration. With dryRun set,
+// nothing is written to the database.
+func MigrateCerts(path string, username string, dryRun bool) (*Report, error) {
+	store, err := newCertStore(dryRun)
+	if err != nil {
+		return nil, err
+	}
 
-		certFile := filepath.Join(dir, file.Name())
-		certPEMBytes, err := os.ReadFile(certFile)
+	report := &Report{DryRun: dryRun}
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
 		if err != nil {
-			return err
+			report.add(FileResult{Path: file, Error: err.Error()})
+			return nil
 		}
 
-		// Decode the PEM file
-		block, _ := pem.Decode(certPEMBytes)
-		if block == nil || block.Type != "CERTIFICATE" {
-			continue
+		// Skip hidden files and directories, but not the path given explicitly
+		if file != path && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		report.add(migrateFile(store, file, username))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
 
-		// Parse the certificate to extract the serial number
-		cert, err := x509.ParseCertificate(block.Bytes)
+// migrateFile imports all certificates of a file.
+func migrateFile(store *certStore, file, username string) FileResult {
+	result := FileResult{Path: file}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(certs) == 0 {
+		result.Notes = append(result.Notes, "no certificates found")
+		return result
+	}
+
+	for _, cert := range certs {
+		imported, note, err := store.add(cert, newCertificateRecord(cert, username))
 		if err != nil {
-			return err
+			result.Error = err.Error()
+			return result
+		}
+		if imported {
+			result.Imported++
+		} else {
+			result.Skipped++
+			result.Notes = append(result.Notes, note)
 		}
+	}
 
-		serialNumber := cert.SerialNumber.String()
+	return result
+}
 
-		// Create a new Certificate model
-		certModel := models.NewCertificate(serialNumber, certPEMBytes, username)
+// newCertificateRecord creates the database record of a migrated certificate.
+func newCertificateRecord(cert *x509.Certificate, username string) *models.Certificate {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
 
-		// Insert the certificate into the database
-		err = repositories.GetCertificateRepository().Insert(*certModel)
-		if err != nil {
-			return err
+	record := models.NewCertificate(serialOf(cert), certPEM, username)
+	record.IssuedAt = cert.NotBefore
+	record.NotAfter = cert.NotAfter
+	record.IssuerKeyID = hex.EncodeToString(cert.AuthorityKeyId)
+	return record
+}
+
+// serialOf returns the serial number in the lowercase hex representation used by gcipher
+func serialOf(cert *x509.Certificate) string {
+	return fmt.Sprintf("%x", cert.SerialNumber)
+}
+
+// certStore inserts migrated certificates, detecting duplicates within the migration and
+// certificates already stored
+type certStore struct {
+	repo   *repositories.CertificateRepository
+	dryRun bool
+	seen   map[string][]byte
+}
+
+func newCertStore(dryRun bool) (*certStore, error) {
+	repo, err := repositories.NewCertificateRepository()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize certificate repository: %v", err)
+	}
+	return &certStore{repo: repo, dryRun: dryRun, seen: make(map[string][]byte)}, nil
+}
+
+// add stores the record of a certificate unless it is known already. It reports whether the
+// certificate was imported and otherwise why it was skipped. A different certificate with the
+// same serial number is an error.
+func (s *certStore) add(cert *x509.Certificate, record *models.Certificate) (bool, string, error) {
+	serial := record.SerialNumber
+
+	if raw, ok := s.seen[serial]; ok {
+		if !bytes.Equal(raw, cert.Raw) {
+			return false, "", fmt.Errorf("serial number %s is used by different certificates", serial)
+		}
+		return false, fmt.Sprintf("%s: duplicate within the migration", serial), nil
+	}
+
+	existing, err := s.repo.FindBySerialNumber(serial)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return false, "", fmt.Errorf("failed to look up serial number %s: %v", serial, err)
+	}
+	if existing != nil {
+		block, _ := pem.Decode(existing.CertificatePEM)
+		if block == nil || !bytes.Equal(block.Bytes, cert.Raw) {
+			return false, "", fmt.Errorf("serial number %s is already used by a different certificate", serial)
+		}
+		s.seen[serial] = cert.Raw
+		return false, fmt.Sprintf("%s: already in the database", serial), nil
+	}
+
+	if !s.dryRun {
+		if err := s.repo.Insert(*record); err != nil {
+			return false, "", fmt.Errorf("failed to store certificate %s: %v", serial, err)
 		}
 	}
 
-	return nil
+	s.seen[serial] = cert.Raw
+	return true, "", nil
 }
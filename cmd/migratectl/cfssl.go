@@ -0,0 +1,149 @@
+package migratectl
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// cfsslTimeLayouts are the formats in which the SQLite driver of cfssl stores timestamps
+var cfsslTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+}
+
+// ImportCFSSL imports the certificates table of a cfssl SQLite certificate database.
+func ImportCFSSL(dbPath, username string, dryRun bool) (*Report, error) {
+	store, err := newCertStore(dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	result := FileResult{Path: dbPath}
+	entries, err := readCFSSLDatabase(dbPath, &result)
+	if err != nil {
+		return nil, err
+	}
+	importEntries(store, &result, username, entries)
+
+	report := &Report{DryRun: dryRun}
+	report.add(result)
+	return report, nil
+}
+
+func readCFSSLDatabase(dbPath string, result *FileResult) ([]importEntry, error) {
+	database, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	rows, err := database.Query("SELECT serial_number, status, reason, revoked_at, pem FROM certificates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query certificates: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []importEntry
+	for rows.Next() {
+		var serial, status, certPEM string
+		var reason sql.NullInt64
+		var revokedAt any
+		if err := rows.Scan(&serial, &status, &reason, &revokedAt, &certPEM); err != nil {
+			return nil, fmt.Errorf("failed to read certificate row: %v", err)
+		}
+
+		location := "serial " + serial
+		entry, err := parseCFSSLRow(status, reason, revokedAt, certPEM)
+		if err != nil {
+			entryFailed(result, location, err)
+			continue
+		}
+		entry.location = location
+		entries = append(entries, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read certificates: %v", err)
+	}
+
+	return entries, nil
+}
+
+func parseCFSSLRow(status string, reason sql.NullInt64, revokedAt any, certPEM string) (*importEntry, error) {
+	certs, err := parseCertificates([]byte(certPEM))
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) != 1 {
+		return nil, fmt.Errorf("expected one certificate, found %d", len(certs))
+	}
+
+	entry := &importEntry{cert: certs[0]}
+
+	switch status {
+	case "good":
+	case "revoked":
+		if reason.Valid {
+			entry.reason = int(reason.Int64)
+		}
+		if err := validateReason(entry.reason); err != nil {
+			return nil, err
+		}
+
+		entry.revokedAt, err = parseCFSSLTime(revokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid revoked_at: %v", err)
+		}
+		entry.revoked = true
+	default:
+		return nil, fmt.Errorf("unknown status %q", status)
+	}
+
+	return entry, nil
+}
+
+// parseCFSSLTime converts the revoked_at column, which depending on the driver that wrote it is a
+// timestamp or its text representation.
+func parseCFSSLTime(value any) (time.Time, error) {
+	var text string
+	switch v := value.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return time.Time{}, fmt.Errorf("no revocation date")
+		}
+		return v, nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	case nil:
+		return time.Time{}, fmt.Errorf("no revocation date")
+	default:
+		return time.Time{}, fmt.Errorf("unexpected type %T", value)
+	}
+
+	// Timestamps formatted by time.Time.String may carry the monotonic clock reading
+	text = strings.TrimSpace(text)
+	if i := strings.Index(text, " m="); i >= 0 {
+		text = text[:i]
+	}
+
+	for _, layout := range cfsslTimeLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			if t.IsZero() || t.Year() <= 1 {
+				return time.Time{}, fmt.Errorf("no revocation date")
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", text)
+}
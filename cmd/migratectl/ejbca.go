@@ -0,0 +1,146 @@
+package migratectl
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EJBCA certificate status codes of the CertificateData table
+const (
+	ejbcaStatusRevoked  = 40
+	ejbcaStatusArchived = 60
+)
+
+// ejbcaNotRevoked is the revocationReason of certificates that aren't revoked
+const ejbcaNotRevoked = -1
+
+// ImportEJBCA imports a CSV export of the EJBCA CertificateData table. The export needs a header
+// row and the columns base64Cert, status, revocationDate (milliseconds since the epoch) and
+// revocationReason, e.g. exported with
+// "SELECT base64Cert, status, revocationDate, revocationReason FROM CertificateData".
+func ImportEJBCA(csvPath, username string, dryRun bool) (*Report, error) {
+	store, err := newCertStore(dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	result := FileResult{Path: csvPath}
+	entries, err := readEJBCAExport(csvPath, &result)
+	if err != nil {
+		return nil, err
+	}
+	importEntries(store, &result, username, entries)
+
+	report := &Report{DryRun: dryRun}
+	report.add(result)
+	return report, nil
+}
+
+func readEJBCAExport(csvPath string, result *FileResult) ([]importEntry, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"base64cert", "status", "revocationdate", "revocationreason"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %s", name)
+		}
+	}
+
+	var entries []importEntry
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		location := fmt.Sprintf("row %d", row)
+		if err != nil {
+			entryFailed(result, location, err)
+			continue
+		}
+
+		entry, err := parseEJBCARecord(record, columns)
+		if err != nil {
+			entryFailed(result, location, err)
+			continue
+		}
+		entry.location = location + " (" + serialOf(entry.cert) + ")"
+		entries = append(entries, *entry)
+	}
+
+	return entries, nil
+}
+
+func parseEJBCARecord(record []string, columns map[string]int) (*importEntry, error) {
+	field := func(name string) string {
+		if i := columns[name]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	// Certificates stored in the Base64CertData table leave the column empty
+	encoded := field("base64cert")
+	if encoded == "" {
+		return nil, fmt.Errorf("empty base64Cert, export the certificate from Base64CertData")
+	}
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64Cert: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	status, err := strconv.Atoi(field("status"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid status %q", field("status"))
+	}
+	reason, err := strconv.Atoi(field("revocationreason"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid revocationReason %q", field("revocationreason"))
+	}
+
+	entry := &importEntry{cert: cert}
+
+	// Archived certificates keep their revocation reason after they expired
+	if (status == ejbcaStatusRevoked || status == ejbcaStatusArchived) && reason != ejbcaNotRevoked && reason != reasonRemoveFromCRL {
+		if err := validateReason(reason); err != nil {
+			return nil, err
+		}
+
+		millis, err := strconv.ParseInt(field("revocationdate"), 10, 64)
+		if err != nil || millis <= 0 {
+			return nil, fmt.Errorf("invalid revocationDate %q", field("revocationdate"))
+		}
+
+		entry.revoked = true
+		entry.revokedAt = time.UnixMilli(millis)
+		entry.reason = reason
+	}
+
+	return entry, nil
+}
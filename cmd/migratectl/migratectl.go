@@ -1,36 +1,138 @@
 package migratectl
 
 import (
-	"fmt" // import the package containing the MigrateCerts function
+	"encoding/json"
+	"fmt"
 	"os"
+	"text/tabwriter"
 )
 
 func Execute() {
 	if len(os.Args) < 3 {
-		fmt.Println("Usage: gcipher migratectl [command]")
+		fmt.Println("Usage: gcipher migratectl [command] [--dry-run] [--json]")
 		fmt.Println("Available commands:")
-		fmt.Println("  migrate-certs [path-to-certs-directory] [username] - Migrate certificates to the database")
-		return
+		fmt.Println("  migrate-certs [path] [username] - Migrate certificates from a file or directory to the database")
+		fmt.Println("  import-openssl [index.txt] [certs-dir] [username] [crl] - Import an OpenSSL CA database with its revocations and last CRL")
+		fmt.Println("  import-ejbca [export.csv] [username] - Import a CSV export of the EJBCA CertificateData table")
+		fmt.Println("  import-cfssl [certs.db] [username] - Import a cfssl SQLite certificate database")
+		os.Exit(2)
 	}
 
+	args, dryRun, asJSON := parseArgs(os.Args[3:])
+
 	subcommand := os.Args[2]
 	switch subcommand {
 	case "migrate-certs":
-		if len(os.Args) < 5 {
-			fmt.Println("Usage: gcipher migratectl migrate-certs [path-to-certs-directory] [username]")
-			return
+		if len(args) < 2 {
+			fmt.Println("Usage: gcipher migratectl migrate-certs [path] [username] [--dry-run] [--json]")
+			os.Exit(2)
+		}
+
+		report, err := MigrateCerts(args[0], args[1], dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", subcommand, err)
+			os.Exit(1)
+		}
+		finish(report, asJSON)
+
+	case "import-openssl":
+		if len(args) < 3 {
+			fmt.Println("Usage: gcipher migratectl import-openssl [index.txt] [certs-dir] [username] [crl] [--dry-run] [--json]")
+			os.Exit(2)
+		}
+
+		crlPath := ""
+		if len(args) > 3 {
+			crlPath = args[3]
 		}
 
-		certsPath := os.Args[3]
-		username := os.Args[4]
+		report, err := ImportOpenSSL(args[0], args[1], crlPath, args[2], dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", subcommand, err)
+			os.Exit(1)
+		}
+		finish(report, asJSON)
 
-		if err := MigrateCerts(certsPath, username); err != nil {
-			fmt.Println("Migration failed:", err)
-		} else {
-			fmt.Println("Migration succeeded.")
+	case "import-ejbca":
+		if len(args) < 2 {
+			fmt.Println("Usage: gcipher migratectl import-ejbca [export.csv] [username] [--dry-run] [--json]")
+			os.Exit(2)
 		}
 
+		report, err := ImportEJBCA(args[0], args[1], dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", subcommand, err)
+			os.Exit(1)
+		}
+		finish(report, asJSON)
+
+	case "import-cfssl":
+		if len(args) < 2 {
+			fmt.Println("Usage: gcipher migratectl import-cfssl [certs.db] [username] [--dry-run] [--json]")
+			os.Exit(2)
+		}
+
+		report, err := ImportCFSSL(args[0], args[1], dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", subcommand, err)
+			os.Exit(1)
+		}
+		finish(report, asJSON)
+
 	default:
 		fmt.Println("Unknown subcommand:", subcommand)
+		os.Exit(2)
+	}
+}
+
+// parseArgs separates the flags from the positional arguments.
+func parseArgs(rawArgs []string) (args []string, dryRun bool, asJSON bool) {
+	for _, arg := range rawArgs {
+		switch arg {
+		case "--dry-run":
+			dryRun = true
+		case "--json":
+			asJSON = true
+		default:
+			args = append(args, arg)
+		}
+	}
+	return args, dryRun, asJSON
+}
+
+// finish prints the report and exits with status 1 if any file failed.
+func finish(report *Report, asJSON bool) {
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printReport(report)
+	}
+
+	if report.FilesFailed > 0 {
+		os.Exit(1)
+	}
+}
+
+func printReport(report *Report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tIMPORTED\tSKIPPED\tFAILED\tFILE\tDETAILS")
+	for _, file := range report.Files {
+		details := file.Error
+		if details == "" && len(file.Notes) > 0 {
+			details = file.Notes[0]
+			if len(file.Notes) > 1 {
+				details += fmt.Sprintf(" (and %d more)", len(file.Notes)-1)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", file.Status, file.Imported, file.Skipped, file.Failed, file.Path, details)
+	}
+	w.Flush()
+
+	if report.DryRun {
+		fmt.Println("\nDry run, nothing was written to the database.")
 	}
+	fmt.Printf("\nFiles: %d imported, %d skipped, %d failed\n", report.FilesImported, report.FilesSkipped, report.FilesFailed)
+	fmt.Printf("Certificates: %d imported, %d skipped, %d failed\n", report.CertificatesImported, report.CertificatesSkipped, report.CertificatesFailed)
 }
@@ -0,0 +1,266 @@
+package migratectl
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// opensslReasons maps the reason names of "openssl ca -crl_reason" to RFC 5280 codes. The
+// *Time variants carry the date of the key compromise, which is kept as invalidity date.
+var opensslReasons = map[string]int{
+	"unspecified":          reasonUnspecified,
+	"keycompromise":        reasonKeyCompromise,
+	"cacompromise":         reasonCACompromise,
+	"affiliationchanged":   3,
+	"superseded":           4,
+	"cessationofoperation": 5,
+	"certificatehold":      reasonCertificateHold,
+	"privilegewithdrawn":   9,
+	"aacompromise":         reasonAACompromise,
+	"holdinstruction":      reasonCertificateHold,
+	"keytime":              reasonKeyCompromise,
+	"cakeytime":            reasonCACompromise,
+}
+
+// ImportOpenSSL imports the certificates listed in an OpenSSL CA database (index.txt). The
+// certificates are read from certsDir, where "openssl ca" stores them as <SERIAL>.pem. If crlPath
+// is set, the last CRL of the OpenSSL CA is stored as well, so the CRL numbers continue from it.
+func ImportOpenSSL(indexPath, certsDir, crlPath, username string, dryRun bool) (*Report, error) {
+	store, err := newCertStore(dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	result := FileResult{Path: indexPath}
+	entries, err := readOpenSSLIndex(indexPath, certsDir, &result)
+	if err != nil {
+		return nil, err
+	}
+	importEntries(store, &result, username, entries)
+
+	if crlPath != "" {
+		note, err := importOpenSSLCRL(crlPath, dryRun)
+		if err != nil {
+			result.Error = fmt.Sprintf("%s: %v", crlPath, err)
+		} else {
+			result.Notes = append(result.Notes, note)
+		}
+	}
+
+	report := &Report{DryRun: dryRun}
+	report.add(result)
+	return report, nil
+}
+
+// importOpenSSLCRL stores the last CRL of the OpenSSL CA as the CRL of the CA generation that
+// signed it, unless a CRL with the same or a higher number is stored already. The next CRL
+// gcipher publishes for the generation continues from its number.
+func importOpenSSLCRL(path string, dryRun bool) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse CRL: %v", err)
+	}
+	if crl.Number == nil {
+		return "", fmt.Errorf("CRL has no CRL number")
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return "", err
+	}
+
+	keyID := ""
+	for _, generation := range cfg.CAGenerations {
+		if crl.CheckSignatureFrom(generation.Cert) == nil {
+			keyID = util.KeyID(generation.Cert)
+			break
+		}
+	}
+	if keyID == "" {
+		return "", fmt.Errorf("CRL isn't signed by a configured CA generation")
+	}
+
+	crlRepo, err := repositories.NewCRLRepository()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize CRL repository: %v", err)
+	}
+
+	existing, err := crlRepo.FindByIssuer(keyID)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", fmt.Errorf("failed to look up the stored CRL: %v", err)
+	}
+	if err == nil {
+		stored, err := x509.ParseRevocationList(existing.CRLBytes)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse the stored CRL: %v", err)
+		}
+		if stored.Number != nil && stored.Number.Cmp(crl.Number) >= 0 {
+			return fmt.Sprintf("CRL number %s not imported, CRL number %s is stored already", crl.Number, stored.Number), nil
+		}
+	}
+
+	if !dryRun {
+		if err := crlRepo.InsertOrUpdate(*models.NewCRL(keyID, der)); err != nil {
+			return "", fmt.Errorf("failed to store CRL: %v", err)
+		}
+	}
+	return fmt.Sprintf("CRL number %s imported, the next CRL continues from it", crl.Number), nil
+}
+
+// readOpenSSLIndex parses the tab separated index lines: status (V, R or E), expiry date,
+// revocation date with optional reason, hex serial number, file name and subject.
+func readOpenSSLIndex(indexPath, certsDir string, result *FileResult) ([]importEntry, error) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []importEntry
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		location := fmt.Sprintf("line %d", lineNumber)
+		entry, err := parseOpenSSLIndexLine(line, certsDir)
+		if err != nil {
+			entryFailed(result, location, err)
+			continue
+		}
+		entry.location = location + " (" + serialOf(entry.cert) + ")"
+		entries = append(entries, *entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+func parseOpenSSLIndexLine(line, certsDir string) (*importEntry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("expected 6 tab separated fields, got %d", len(fields))
+	}
+	status, revocation, serial, fileName := fields[0], fields[2], fields[3], fields[4]
+
+	entry := &importEntry{}
+	switch status {
+	case "V", "E":
+	case "R":
+		entry.revoked = true
+		revokedAt, reason, invalidityDate, err := parseOpenSSLRevocation(revocation)
+		if err != nil {
+			return nil, err
+		}
+		entry.revokedAt = revokedAt
+		entry.reason = reason
+		entry.invalidityDate = invalidityDate
+	default:
+		return nil, fmt.Errorf("unknown status %q", status)
+	}
+
+	cert, err := findOpenSSLCertificate(certsDir, serial, fileName)
+	if err != nil {
+		return nil, err
+	}
+	entry.cert = cert
+
+	return entry, nil
+}
+
+// parseOpenSSLRevocation parses "date[,reason[,extra]]". The extra field of the keyTime and
+// CAkeyTime reasons is returned as invalidity date, the one of holdInstruction is ignored.
+func parseOpenSSLRevocation(field string) (time.Time, int, *time.Time, error) {
+	parts := strings.Split(field, ",")
+
+	revokedAt, err := parseASN1Time(parts[0])
+	if err != nil {
+		return time.Time{}, 0, nil, fmt.Errorf("invalid revocation date %q: %v", parts[0], err)
+	}
+
+	reason := reasonUnspecified
+	if len(parts) > 1 {
+		var ok bool
+		if reason, ok = opensslReasons[strings.ToLower(parts[1])]; !ok {
+			return time.Time{}, 0, nil, fmt.Errorf("unknown revocation reason %q", parts[1])
+		}
+	}
+
+	var invalidityDate *time.Time
+	if len(parts) > 2 && strings.HasSuffix(strings.ToLower(parts[1]), "keytime") {
+		date, err := parseASN1Time(parts[2])
+		if err != nil {
+			return time.Time{}, 0, nil, fmt.Errorf("invalid compromise date %q: %v", parts[2], err)
+		}
+		invalidityDate = &date
+	}
+
+	return revokedAt, reason, invalidityDate, nil
+}
+
+// parseASN1Time parses the UTCTime (YYMMDDHHMMSSZ) and GeneralizedTime (YYYYMMDDHHMMSSZ)
+// representations used in index files.
+func parseASN1Time(value string) (time.Time, error) {
+	if len(value) == len("060102150405Z") {
+		return time.Parse("060102150405Z", value)
+	}
+	return time.Parse("20060102150405Z", value)
+}
+
+// findOpenSSLCertificate reads the certificate with the given serial number from certsDir.
+func findOpenSSLCertificate(certsDir, serial, fileName string) (*x509.Certificate, error) {
+	candidates := []string{serial + ".pem", strings.ToLower(serial) + ".pem"}
+	if fileName != "" && fileName != "unknown" {
+		candidates = append([]string{fileName}, candidates...)
+	}
+
+	for _, candidate := range candidates {
+		path := candidate
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(certsDir, candidate)
+		}
+
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		certs, err := parseCertificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, cert := range certs {
+			if strings.EqualFold(fmt.Sprintf("%0*x", len(serial), cert.SerialNumber), serial) {
+				return cert, nil
+			}
+		}
+		return nil, fmt.Errorf("%s doesn't contain a certificate with serial number %s", path, serial)
+	}
+
+	return nil, fmt.Errorf("certificate file for serial number %s not found in %s", serial, certsDir)
+}
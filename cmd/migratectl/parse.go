@@ -0,0 +1,64 @@
+package migratectl
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gcipher/internal/format"
+)
+
+// parseCertificates returns all certificates of a PEM file, a DER encoded certificate or a
+// PEM or DER encoded PKCS#7 bundle. PEM blocks holding anything else, e.g. keys, are ignored.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN ")) {
+		return parseDER(data)
+	}
+
+	var certs []*x509.Certificate
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE", "X509 CERTIFICATE", "TRUSTED CERTIFICATE":
+			// OpenSSL trusted certificates append auxiliary trust settings after the certificate
+			var raw asn1.RawValue
+			if _, err := asn1.Unmarshal(block.Bytes, &raw); err != nil {
+				return nil, fmt.Errorf("failed to parse certificate: %v", err)
+			}
+			cert, err := x509.ParseCertificate(raw.FullBytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate: %v", err)
+			}
+			certs = append(certs, cert)
+		case "PKCS7", "CERTIFICATE CHAIN":
+			bundle, err := format.DecodePKCS7(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, bundle...)
+		}
+	}
+
+	return certs, nil
+}
+
+// parseDER parses a DER encoded certificate or PKCS#7 bundle.
+func parseDER(data []byte) ([]*x509.Certificate, error) {
+	if cert, err := x509.ParseCertificate(data); err == nil {
+		return []*x509.Certificate{cert}, nil
+	}
+
+	certs, err := format.DecodePKCS7(data)
+	if err != nil {
+		return nil, errors.New("neither a PEM file, a DER encoded certificate nor a PKCS#7 bundle")
+	}
+	return certs, nil
+}
@@ -0,0 +1,79 @@
+package migratectl
+
+import (
+	"crypto/x509"
+	"fmt"
+	"gcipher/internal/db/models"
+	"time"
+)
+
+// RFC 5280 CRLReason codes
+const (
+	reasonUnspecified     = 0
+	reasonKeyCompromise   = 1
+	reasonCACompromise    = 2
+	reasonCertificateHold = 6
+	reasonRemoveFromCRL   = 8
+	reasonAACompromise    = 10
+)
+
+// importEntry is a certificate read from a CA database, with its revocation state
+type importEntry struct {
+	// location identifies the entry in reports, e.g. the line of an index file
+	location string
+	cert     *x509.Certificate
+	revoked  bool
+	// revokedAt and reason are the original revocation date and RFC 5280 reason code
+	revokedAt time.Time
+	reason    int
+	// invalidityDate is the date the key was compromised, if known
+	invalidityDate *time.Time
+}
+
+// newRecord creates the database record of an imported entry.
+func (e *importEntry) newRecord(username string) *models.Certificate {
+	record := newCertificateRecord(e.cert, username)
+	if e.revoked {
+		revokedAt := e.revokedAt.UTC()
+		record.RevokedAt = &revokedAt
+		record.RevocationReason = e.reason
+		if e.invalidityDate != nil {
+			invalidityDate := e.invalidityDate.UTC()
+			record.InvalidityDate = &invalidityDate
+		}
+	}
+	return record
+}
+
+// validateReason checks that a reason code can appear on a CRL.
+func validateReason(reason int) error {
+	if reason < reasonUnspecified || reason > reasonAACompromise || reason == 7 || reason == reasonRemoveFromCRL {
+		return fmt.Errorf("invalid revocation reason %d", reason)
+	}
+	return nil
+}
+
+// importEntries stores the entries of a CA database, recording the outcome of every entry in result.
+func importEntries(store *certStore, result *FileResult, username string, entries []importEntry) {
+	for i := range entries {
+		entry := &entries[i]
+
+		imported, note, err := store.add(entry.cert, entry.newRecord(username))
+		switch {
+		case err != nil:
+			result.Failed++
+			result.Notes = append(result.Notes, fmt.Sprintf("%s: %v", entry.location, err))
+		case imported:
+			result.Imported++
+		default:
+			result.Skipped++
+			result.Notes = append(result.Notes, fmt.Sprintf("%s: %s", entry.location, note))
+		}
+	}
+}
+
+// entryFailed records an entry that couldn't be read.
+func entryFailed(result *FileResult, location string, err error) {
+	result.Failed++
+	result.Notes = append(result.Notes, fmt.Sprintf("%s: %v", location, err))
+}
@@ -0,0 +1,57 @@
+package userctl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// readNewPassword reads a new password. On a terminal it prompts twice without echo, otherwise
+// the first line of stdin is used so passwords can be piped in by scripts.
+func readNewPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read password from stdin: %v", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	password, err := promptPassword(fd, "New password: ")
+	if err != nil {
+		return "", err
+	}
+
+	confirmation, err := promptPassword(fd, "Retype new password: ")
+	if err != nil {
+		return "", err
+	}
+
+	if password != confirmation {
+		return "", errors.New("passwords don't match")
+	}
+	return password, nil
+}
+
+func promptPassword(fd int, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %v", err)
+	}
+	return string(password), nil
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,129 @@
+package userctl
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/user"
+	"gcipher/internal/util"
+	"os"
+)
+
+// ChangePassword sets a new password for a user and lifts a lockout. The password is prompted
+// for, or read from stdin when it isn't a terminal.
+func ChangePassword(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("passwd [username]")
+	}
+
+	username := args[0]
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+
+	if err := checkPassword(username, password); err != nil {
+		return err
+	}
+
+	if err := setPassword(username, password); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Password of %s changed\n", username)
+	return nil
+}
+
+// ResetPassword replaces the password of a user by a random one, prints it once and lifts a lockout.
+func ResetPassword(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("reset-password [username]")
+	}
+
+	username := args[0]
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("error generating password: %v", err)
+	}
+	password := base64.RawURLEncoding.EncodeToString(b)
+
+	// Random passwords can't be breached, skip the policy check
+	if err := setPassword(username, password); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Password of %s reset, it will not be shown again\n", username)
+	if opts.json {
+		return printJSON(map[string]string{"username": username, "password": password})
+	}
+	fmt.Println(password)
+	return nil
+}
+
+// UnlockUser lifts the lockout of a user after too many failed logins.
+func UnlockUser(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("unlock [username]")
+	}
+
+	username := args[0]
+
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	if _, err := userRepo.FindByUsername(username); err != nil {
+		return fmt.Errorf("user %s not found: %v", username, err)
+	}
+
+	if err := userRepo.ResetFailedLogins(username); err != nil {
+		return fmt.Errorf("error unlocking user: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "User %s unlocked\n", username)
+	return nil
+}
+
+// checkPassword checks a new password against the configured password policy.
+func checkPassword(username, password string) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %v", err)
+	}
+
+	if err := user.CheckPasswordPolicy(cfg, username, password, cfg.PasswordMinLength); err != nil {
+		return fmt.Errorf("password rejected: %v", err)
+	}
+
+	return nil
+}
+
+// setPassword stores the hash of a new password and lifts a lockout of the user.
+func setPassword(username, password string) error {
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	if _, err := userRepo.FindByUsername(username); err != nil {
+		return fmt.Errorf("user %s not found: %v", username, err)
+	}
+
+	hashedPassword, err := util.GenerateFromPassword(password)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %v", err)
+	}
+
+	if err := userRepo.UpdatePassword(username, hashedPassword); err != nil {
+		return fmt.Errorf("error updating password: %v", err)
+	}
+
+	if err := userRepo.ResetFailedLogins(username); err != nil {
+		return fmt.Errorf("error unlocking user: %v", err)
+	}
+
+	return nil
+}
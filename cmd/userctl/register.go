@@ -10,51 +10,55 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func RegisterUser() {
-	if len(os.Args) < 5 {
-		fmt.Println("Usage: gcipher userctl register [username] [password]")
-		return
+// RegisterUser registers a new user with the user role. The password is prompted for, or read
+// from stdin when it isn't a terminal.
+func RegisterUser(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("register [username]")
 	}
 
-	username := os.Args[3]
-	password := os.Args[4]
+	username := args[0]
 
 	userRepo, err := repositories.NewUserRepository()
 	if err != nil {
-		fmt.Println("Failed to initialize user repository:", err)
-		return
+		return fmt.Errorf("failed to initialize user repository: %v", err)
 	}
 
 	// Check if the username already exists
 	existingUser, err := userRepo.FindByUsername(username)
 	if err != nil && err != mongo.ErrNoDocuments {
-		fmt.Println("Error checking username:", err)
-		return
+		return fmt.Errorf("error checking username: %v", err)
 	}
 
 	if existingUser != nil {
-		fmt.Println("Username already exists.")
-		return
+		return fmt.Errorf("username %s already exists", username)
+	}
+
+	var password string
+	if len(args) > 1 {
+		// Kept for existing scripts, the password ends up in the shell history
+		fmt.Fprintln(os.Stderr, "Warning: passing the password as argument is deprecated, enter it when prompted or pipe it to stdin")
+		password = args[1]
+	} else if password, err = readNewPassword(); err != nil {
+		return err
+	}
+
+	if err := checkPassword(username, password); err != nil {
+		return err
 	}
 
 	// Hash the password
 	hashedPassword, err := util.GenerateFromPassword(password)
 	if err != nil {
-		fmt.Println("Error hashing password:", err)
-		return
+		return fmt.Errorf("error hashing password: %v", err)
 	}
 
 	// Create and insert the user record
-	newUser := models.User{
-		Username: username,
-		Password: hashedPassword,
-	}
-
-	err = userRepo.Insert(newUser)
+	err = userRepo.Insert(*models.NewUser(username, hashedPassword))
 	if err != nil {
-		fmt.Println("Error registering user:", err)
-		return
+		return fmt.Errorf("error registering user: %v", err)
 	}
 
-	fmt.Println("User registered successfully.")
+	fmt.Fprintf(os.Stderr, "User %s registered successfully\n", username)
+	return nil
 }
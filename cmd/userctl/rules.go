@@ -0,0 +1,244 @@
+package userctl
+
+import (
+	"fmt"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/user"
+	"os"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AddRule grants a user the right to issue certificates for the names matching a pattern.
+func AddRule(args []string, opts options) error {
+	if len(args) < 3 {
+		return usageError("add-rule [username] [dns|ip|email] [pattern]")
+	}
+
+	rule, err := user.ParseNameRule(args[1], args[2])
+	if err != nil {
+		return err
+	}
+
+	err = updateUser(args[0], func(u *models.User) {
+		if !slices.Contains(u.NameRules, rule) {
+			u.NameRules = append(u.NameRules, rule)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Name rule %s %s added to user %s\n", rule.Type, rule.Pattern, args[0])
+	return nil
+}
+
+// RemoveRule removes a name rule from a user.
+func RemoveRule(args []string, opts options) error {
+	if len(args) < 3 {
+		return usageError("remove-rule [username] [dns|ip|email] [pattern]")
+	}
+
+	rule, err := user.ParseNameRule(args[1], args[2])
+	if err != nil {
+		return err
+	}
+
+	err = updateUser(args[0], func(u *models.User) {
+		u.NameRules = slices.DeleteFunc(u.NameRules, func(r models.NameRule) bool { return r == rule })
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Name rule %s %s removed from user %s\n", rule.Type, rule.Pattern, args[0])
+	return nil
+}
+
+// AddGroupRule grants all members of a group the right to issue certificates for the names
+// matching a pattern. The group is created if it doesn't exist.
+func AddGroupRule(args []string, opts options) error {
+	if len(args) < 3 {
+		return usageError("add-group-rule [group] [dns|ip|email] [pattern]")
+	}
+
+	rule, err := user.ParseNameRule(args[1], args[2])
+	if err != nil {
+		return err
+	}
+
+	err = updateGroup(args[0], true, func(g *models.Group) {
+		if !slices.Contains(g.NameRules, rule) {
+			g.NameRules = append(g.NameRules, rule)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Name rule %s %s added to group %s\n", rule.Type, rule.Pattern, args[0])
+	return nil
+}
+
+// RemoveGroupRule removes a name rule from a group.
+func RemoveGroupRule(args []string, opts options) error {
+	if len(args) < 3 {
+		return usageError("remove-group-rule [group] [dns|ip|email] [pattern]")
+	}
+
+	rule, err := user.ParseNameRule(args[1], args[2])
+	if err != nil {
+		return err
+	}
+
+	err = updateGroup(args[0], false, func(g *models.Group) {
+		g.NameRules = slices.DeleteFunc(g.NameRules, func(r models.NameRule) bool { return r == rule })
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Name rule %s %s removed from group %s\n", rule.Type, rule.Pattern, args[0])
+	return nil
+}
+
+// JoinGroup adds a user to a group.
+func JoinGroup(args []string, opts options) error {
+	if len(args) < 2 {
+		return usageError("join-group [username] [group]")
+	}
+
+	group := args[1]
+	err := updateUser(args[0], func(u *models.User) {
+		if !slices.Contains(u.Groups, group) {
+			u.Groups = append(u.Groups, group)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "User %s added to group %s\n", args[0], group)
+	return nil
+}
+
+// LeaveGroup removes a user from a group.
+func LeaveGroup(args []string, opts options) error {
+	if len(args) < 2 {
+		return usageError("leave-group [username] [group]")
+	}
+
+	group := args[1]
+	err := updateUser(args[0], func(u *models.User) {
+		u.Groups = slices.DeleteFunc(u.Groups, func(g string) bool { return g == group })
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "User %s removed from group %s\n", args[0], group)
+	return nil
+}
+
+// ruleOutput is a name rule as printed by list-rules, group is empty for the user's own rules
+type ruleOutput struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+	Group   string `json:"group,omitempty"`
+}
+
+// ListRules prints the name rules of a user including those inherited from groups.
+func ListRules(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("list-rules [username]")
+	}
+
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	groupRepo, err := repositories.NewGroupRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize group repository: %v", err)
+	}
+
+	u, err := userRepo.FindByUsername(args[0])
+	if err != nil {
+		return fmt.Errorf("user %s not found: %v", args[0], err)
+	}
+
+	rules := []ruleOutput{}
+	for _, rule := range u.NameRules {
+		rules = append(rules, ruleOutput{Type: rule.Type, Pattern: rule.Pattern})
+	}
+
+	groups, err := groupRepo.FindByNames(u.Groups)
+	if err != nil {
+		return fmt.Errorf("failed to load groups: %v", err)
+	}
+	for _, group := range groups {
+		for _, rule := range group.NameRules {
+			rules = append(rules, ruleOutput{Type: rule.Type, Pattern: rule.Pattern, Group: group.Name})
+		}
+	}
+
+	if opts.json {
+		return printJSON(rules)
+	}
+
+	for _, rule := range rules {
+		source := "user"
+		if rule.Group != "" {
+			source = "group " + rule.Group
+		}
+		fmt.Printf("%-6s %-40s %s\n", rule.Type, rule.Pattern, source)
+	}
+	return nil
+}
+
+// updateUser loads a user, applies update and stores the result.
+func updateUser(username string, update func(*models.User)) error {
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	u, err := userRepo.FindByUsername(username)
+	if err != nil {
+		return fmt.Errorf("user %s not found: %v", username, err)
+	}
+
+	update(u)
+
+	if err := userRepo.Update(*u); err != nil {
+		return fmt.Errorf("error updating user %s: %v", username, err)
+	}
+
+	return nil
+}
+
+// updateGroup loads a group, applies update and stores the result. Missing groups are created if create is set.
+func updateGroup(name string, create bool, update func(*models.Group)) error {
+	groupRepo, err := repositories.NewGroupRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize group repository: %v", err)
+	}
+
+	group, err := groupRepo.FindByName(name)
+	if err == mongo.ErrNoDocuments && create {
+		group = models.NewGroup(name)
+	} else if err != nil {
+		return fmt.Errorf("group %s not found: %v", name, err)
+	}
+
+	update(group)
+
+	if err := groupRepo.Save(*group); err != nil {
+		return fmt.Errorf("error updating group %s: %v", name, err)
+	}
+
+	return nil
+}
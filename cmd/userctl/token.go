@@ -0,0 +1,88 @@
+package userctl
+
+import (
+	"fmt"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/util"
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CreateToken creates a new API token for a user and prints it once.
+func CreateToken(args []string, opts options) error {
+	if len(args) < 2 {
+		return usageError("create-token [username] [token-name]")
+	}
+
+	username := args[0]
+	name := args[1]
+
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	tokenRepo, err := repositories.NewAPITokenRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize API token repository: %v", err)
+	}
+
+	if _, err := userRepo.FindByUsername(username); err != nil {
+		return fmt.Errorf("user %s not found: %v", username, err)
+	}
+
+	// Token names are unique per user so they can be deleted by name
+	existingToken, err := tokenRepo.FindByUsernameAndName(username, name)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return fmt.Errorf("error checking token name: %v", err)
+	}
+
+	if existingToken != nil {
+		return fmt.Errorf("token name %s already exists for user %s", name, username)
+	}
+
+	token, tokenHash, err := util.GenerateToken()
+	if err != nil {
+		return fmt.Errorf("error generating token: %v", err)
+	}
+
+	err = tokenRepo.Insert(*models.NewAPIToken(name, username, tokenHash))
+	if err != nil {
+		return fmt.Errorf("error storing token: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "API token %s created for user %s, it will not be shown again\n", name, username)
+	if opts.json {
+		return printJSON(map[string]string{"username": username, "name": name, "token": token})
+	}
+	fmt.Println(token)
+	return nil
+}
+
+// DeleteToken deletes an API token of a user by name.
+func DeleteToken(args []string, opts options) error {
+	if len(args) < 2 {
+		return usageError("delete-token [username] [token-name]")
+	}
+
+	username := args[0]
+	name := args[1]
+
+	tokenRepo, err := repositories.NewAPITokenRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize API token repository: %v", err)
+	}
+
+	if _, err := tokenRepo.FindByUsernameAndName(username, name); err != nil {
+		return fmt.Errorf("token %s of user %s not found: %v", name, username, err)
+	}
+
+	if err := tokenRepo.Delete(username, name); err != nil {
+		return fmt.Errorf("error deleting token: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "API token %s of user %s deleted\n", name, username)
+	return nil
+}
@@ -1,23 +1,112 @@
 package userctl
 
 import (
+	"errors"
 	"fmt"
 	"os"
 )
 
+// Exit codes
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// usageError is returned by commands called with missing arguments, it holds the usage line
+type usageError string
+
+func (e usageError) Error() string {
+	return "Usage: gcipher userctl " + string(e)
+}
+
+// command is a userctl subcommand
+type command struct {
+	name        string
+	description string
+	run         func(args []string, opts options) error
+}
+
+var commands = []command{
+	{"register", "Register a new user", RegisterUser},
+	{"list", "List all users", ListUsers},
+	{"show", "Show a user", ShowUser},
+	{"delete", "Delete a user and the user's API tokens", DeleteUser},
+	{"disable", "Disable a user", DisableUser},
+	{"enable", "Enable a disabled user", EnableUser},
+	{"set-role", "Change the role of a user", SetRole},
+	{"passwd", "Change the password of a user", ChangePassword},
+	{"reset-password", "Replace the password of a user by a random one", ResetPassword},
+	{"unlock", "Unlock a user locked after too many failed logins", UnlockUser},
+	{"create-token", "Create an API token for a user", CreateToken},
+	{"delete-token", "Delete an API token of a user", DeleteToken},
+	{"add-rule", "Allow a user to issue certificates for names", AddRule},
+	{"remove-rule", "Remove a name rule of a user", RemoveRule},
+	{"list-rules", "List the name rules of a user and the user's groups", ListRules},
+	{"add-group-rule", "Allow a group to issue certificates for names", AddGroupRule},
+	{"remove-group-rule", "Remove a name rule of a group", RemoveGroupRule},
+	{"join-group", "Add a user to a group", JoinGroup},
+	{"leave-group", "Remove a user from a group", LeaveGroup},
+}
+
+// Execute runs the userctl subcommand named by os.Args[2]. It exits with status 1 if the command
+// fails and with status 2 on usage errors.
 func Execute() {
 	if len(os.Args) < 3 {
-		fmt.Println("Usage: gcipher userctl [command]")
-		fmt.Println("Available commands:")
-		fmt.Println("  register - Register a new user")
-		return
+		printUsage()
+		os.Exit(exitUsage)
 	}
 
 	subcommand := os.Args[2]
-	switch subcommand {
-	case "register":
-		RegisterUser()
-	default:
-		fmt.Println("Unknown subcommand:", subcommand)
+	for _, cmd := range commands {
+		if cmd.name != subcommand {
+			continue
+		}
+
+		args, opts := parseArgs(os.Args[3:])
+		err := cmd.run(args, opts)
+
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintln(os.Stderr, usage.Error())
+			os.Exit(exitUsage)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", subcommand, err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "Unknown subcommand:", subcommand)
+	printUsage()
+	os.Exit(exitUsage)
+}
+
+func printUsage() {
+	fmt.Println("Usage: gcipher userctl [command] [--json]")
+	fmt.Println("Available commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %s - %s\n", cmd.name, cmd.description)
+	}
+}
+
+// options are the flags accepted by all commands
+type options struct {
+	// json prints results as JSON for scripting
+	json bool
+}
+
+// parseArgs separates the flags from the positional arguments.
+func parseArgs(rawArgs []string) ([]string, options) {
+	var args []string
+	var opts options
+	for _, arg := range rawArgs {
+		switch arg {
+		case "--json":
+			opts.json = true
+		default:
+			args = append(args, arg)
+		}
 	}
+	return args, opts
 }
@@ -0,0 +1,231 @@
+package userctl
+
+import (
+	"fmt"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// userOutput is a user as printed by list and show, the password hash is never included
+type userOutput struct {
+	Username     string            `json:"username"`
+	Role         string            `json:"role"`
+	Disabled     bool              `json:"disabled"`
+	Locked       bool              `json:"locked"`
+	LockedUntil  *time.Time        `json:"locked_until,omitempty"`
+	FailedLogins int               `json:"failed_logins"`
+	Groups       []string          `json:"groups"`
+	NameRules    []models.NameRule `json:"name_rules"`
+}
+
+func newUserOutput(u *models.User) userOutput {
+	role := u.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+
+	output := userOutput{
+		Username:     u.Username,
+		Role:         role,
+		Disabled:     u.Disabled,
+		Locked:       u.IsLocked(time.Now()),
+		FailedLogins: u.FailedLogins,
+		Groups:       append([]string{}, u.Groups...),
+		NameRules:    append([]models.NameRule{}, u.NameRules...),
+	}
+	if output.Locked {
+		output.LockedUntil = u.LockedUntil
+	}
+	return output
+}
+
+// status summarizes whether the user can log in
+func (u userOutput) status() string {
+	switch {
+	case u.Disabled:
+		return "disabled"
+	case u.Locked:
+		return "locked"
+	default:
+		return "active"
+	}
+}
+
+// ListUsers prints all users.
+func ListUsers(args []string, opts options) error {
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	users, err := userRepo.FindAll()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %v", err)
+	}
+
+	outputs := make([]userOutput, 0, len(users))
+	for i := range users {
+		outputs = append(outputs, newUserOutput(&users[i]))
+	}
+
+	if opts.json {
+		return printJSON(outputs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tROLE\tSTATUS\tGROUPS")
+	for _, u := range outputs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", u.Username, u.Role, u.status(), strings.Join(u.Groups, ","))
+	}
+	return w.Flush()
+}
+
+// ShowUser prints the details of a user.
+func ShowUser(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("show [username]")
+	}
+
+	u, err := findUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	output := newUserOutput(u)
+	if opts.json {
+		return printJSON(output)
+	}
+
+	fmt.Printf("Username:      %s\n", output.Username)
+	fmt.Printf("Role:          %s\n", output.Role)
+	fmt.Printf("Status:        %s\n", output.status())
+	if output.LockedUntil != nil {
+		fmt.Printf("Locked until:  %s\n", output.LockedUntil.Format(time.RFC3339))
+	}
+	fmt.Printf("Failed logins: %d\n", output.FailedLogins)
+	fmt.Printf("Groups:        %s\n", strings.Join(output.Groups, ", "))
+	fmt.Println("Name rules:")
+	for _, rule := range output.NameRules {
+		fmt.Printf("  %-6s %s\n", rule.Type, rule.Pattern)
+	}
+	return nil
+}
+
+// DeleteUser deletes a user and the user's API tokens. Certificates issued to the user are kept.
+func DeleteUser(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("delete [username]")
+	}
+
+	username := args[0]
+	if _, err := findUser(username); err != nil {
+		return err
+	}
+
+	tokenRepo, err := repositories.NewAPITokenRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize API token repository: %v", err)
+	}
+
+	// Delete the tokens first so a failure leaves no usable credentials behind
+	if err := tokenRepo.DeleteByUsername(username); err != nil {
+		return fmt.Errorf("error deleting API tokens: %v", err)
+	}
+
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	if err := userRepo.Delete(username); err != nil {
+		return fmt.Errorf("error deleting user: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "User %s deleted\n", username)
+	return nil
+}
+
+// DisableUser prevents a user from authenticating with any credential.
+func DisableUser(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("disable [username]")
+	}
+	return setDisabled(args[0], true)
+}
+
+// EnableUser enables a disabled user.
+func EnableUser(args []string, opts options) error {
+	if len(args) < 1 {
+		return usageError("enable [username]")
+	}
+	return setDisabled(args[0], false)
+}
+
+// SetRole changes the role of a user.
+func SetRole(args []string, opts options) error {
+	if len(args) < 2 {
+		return usageError("set-role [username] [user|admin]")
+	}
+
+	username := args[0]
+	role := args[1]
+	if !models.IsValidRole(role) {
+		return fmt.Errorf("unknown role %s, expected %s or %s", role, models.RoleUser, models.RoleAdmin)
+	}
+
+	if _, err := findUser(username); err != nil {
+		return err
+	}
+
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	if err := userRepo.SetRole(username, role); err != nil {
+		return fmt.Errorf("error changing role: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Role of %s changed to %s\n", username, role)
+	return nil
+}
+
+func setDisabled(username string, disabled bool) error {
+	if _, err := findUser(username); err != nil {
+		return err
+	}
+
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	if err := userRepo.SetDisabled(username, disabled); err != nil {
+		return fmt.Errorf("error updating user: %v", err)
+	}
+
+	if disabled {
+		fmt.Fprintf(os.Stderr, "User %s disabled\n", username)
+	} else {
+		fmt.Fprintf(os.Stderr, "User %s enabled\n", username)
+	}
+	return nil
+}
+
+// findUser loads a user, failing with a readable error if it doesn't exist.
+func findUser(username string) (*models.User, error) {
+	userRepo, err := repositories.NewUserRepository()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize user repository: %v", err)
+	}
+
+	u, err := userRepo.FindByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("user %s not found: %v", username, err)
+	}
+	return u, nil
+}
@@ -0,0 +1,235 @@
+package certificate
+
+import (
+	"context"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/server/api"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RequestExpiryInterval is the interval at which stale pending requests are expired
+const RequestExpiryInterval = time.Hour
+
+// StartRequestExpiry periodically expires pending requests nobody decided on in time.
+func StartRequestExpiry() {
+	go func() {
+		for {
+			expired, err := repositories.GetIssuanceRequestRepository().ExpirePending(time.Now())
+			if err != nil {
+				slog.Error("Failed to expire pending certificate requests", "error", err)
+			} else if expired > 0 {
+				slog.Info("Expired pending certificate requests", "count", expired)
+			}
+			time.Sleep(RequestExpiryInterval)
+		}
+	}()
+}
+
+// SubmitCertificateRequest issues a certificate like IssueCertificate unless the request needs
+// the approval of an operator. In that case the request is stored as pending and returned instead.
+func SubmitCertificateRequest(ctx context.Context, owner *models.User, data api.RequestData) (*models.Certificate, *models.IssuanceRequest, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, "Couldn't read config", err)
+	}
+
+	profile := profileFor(data.Type)
+	csr, err := parseCSR(cfg, data.CSR, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dnsNames, err := subjectDNSNames(profile, csr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Requests for names the owner can't issue for are refused before they reach an operator
+	if err := authorizeNames(cfg, owner, csr, dnsNames); err != nil {
+		return nil, nil, err
+	}
+	if err := checkProfile(cfg.CAChain(), owner, profile, csr, dnsNames, data); err != nil {
+		return nil, nil, err
+	}
+
+	reasons := approvalReasons(cfg, profile.name, dnsNames, lifetimeOf(cfg, data))
+	if len(reasons) == 0 {
+		cert, err := IssueCertificate(ctx, owner, data)
+		return cert, nil, err
+	}
+
+	if err := checkQuota(ctx, cfg, owner); err != nil {
+		return nil, nil, err
+	}
+
+	request := models.NewIssuanceRequest(owner.Username, data.Applicant, data.CSR, data.Lifetime, data.Type, reasons,
+		time.Duration(cfg.ApprovalExpiry)*time.Hour)
+	request.MaxPathLen = data.MaxPathLen
+	request.NameConstraints = nameConstraintsOf(data.NameConstraints)
+	if err := repositories.GetIssuanceRequestRepository().Insert(*request); err != nil {
+		slog.ErrorContext(ctx, "Failed to store certificate request", "error", err)
+		return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	slog.InfoContext(ctx, "Certificate request awaits approval", "request_id", request.ID.Hex(), "reasons", reasons)
+	return nil, request, nil
+}
+
+// approvalReasons returns why a request needs approval, an empty list means it can be issued right away.
+func approvalReasons(cfg *config.Config, profile string, dnsNames []string, lifetime int) []string {
+	var reasons []string
+
+	for _, p := range cfg.ApprovalProfiles {
+		if p == profile {
+			reasons = append(reasons, fmt.Sprintf("%s certificates require approval", profile))
+			break
+		}
+	}
+
+	if cfg.ApprovalWildcards {
+		for _, name := range dnsNames {
+			if strings.HasPrefix(name, "*.") {
+				reasons = append(reasons, "wildcard names require approval")
+				break
+			}
+		}
+	}
+
+	if cfg.ApprovalLifetimeThreshold > 0 && lifetime > cfg.ApprovalLifetimeThreshold {
+		reasons = append(reasons, fmt.Sprintf("lifetimes above %d days require approval", cfg.ApprovalLifetimeThreshold))
+	}
+
+	return reasons
+}
+
+// GetIssuanceRequest returns a certificate request. Only the requester and admins can see it.
+func GetIssuanceRequest(ctx context.Context, caller *models.User, id string) (*models.IssuanceRequest, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusNotFound, "Certificate request not found", err)
+	}
+
+	request, err := repositories.GetIssuanceRequestRepository().FindByID(objectID)
+	if err != nil || (request.Username != caller.Username && !caller.IsAdmin()) {
+		return nil, api.NewStatusError(http.StatusNotFound, "Certificate request not found", err)
+	}
+
+	// The expiry job runs periodically, report requests past their expiry right away
+	if request.IsExpired() {
+		request.Status = models.IssuanceExpired
+	}
+
+	return request, nil
+}
+
+// ListIssuanceRequests returns all certificate requests with the given status, or all if status is empty.
+func ListIssuanceRequests(ctx context.Context, status string) ([]models.IssuanceRequest, error) {
+	requests, err := repositories.GetIssuanceRequestRepository().FindByStatus(status)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to retrieve certificate requests", "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Failed to retrieve certificate requests", err)
+	}
+	return requests, nil
+}
+
+// ApproveIssuanceRequest issues the certificate of a pending request on behalf of its requester.
+// Operators can't approve their own requests.
+func ApproveIssuanceRequest(ctx context.Context, operator *models.User, id, comment string) (*models.IssuanceRequest, *models.Certificate, error) {
+	request, err := pendingRequest(ctx, operator, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if request.Username == operator.Username {
+		return nil, nil, api.NewStatusError(http.StatusForbidden, "Requesters can't approve their own requests", nil)
+	}
+
+	requester, err := repositories.GetUserRepository().FindByUsername(request.Username)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusConflict, "Requester no longer exists", err)
+	}
+
+	// Claim the request before issuing so concurrent approvals can't issue it twice
+	request.Status = models.IssuanceApproved
+	request.AddEvent("approved", operator.Username, comment)
+	if err := updateIssuanceRequest(ctx, request, models.IssuancePending); err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := IssueCertificate(ctx, requester, api.RequestData{
+		Applicant: request.Applicant,
+		CSR:       request.CSR,
+		Lifetime:  request.Lifetime,
+		Type:      request.Type,
+
+		MaxPathLen:      request.MaxPathLen,
+		NameConstraints: requestedNameConstraints(request.NameConstraints),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to issue approved certificate request", "request_id", request.ID.Hex(), "error", err)
+		request.Status = models.IssuanceFailed
+		request.AddEvent("failed", "system", err.Error())
+		updateIssuanceRequest(ctx, request, models.IssuanceApproved)
+		return nil, nil, err
+	}
+
+	request.SerialNumber = cert.SerialNumber
+	request.AddEvent("issued", "system", "")
+	if err := updateIssuanceRequest(ctx, request, models.IssuanceApproved); err != nil {
+		slog.ErrorContext(ctx, "Failed to link certificate to request", "request_id", request.ID.Hex(), "error", err)
+	}
+
+	slog.InfoContext(ctx, "Certificate request approved", "request_id", request.ID.Hex(), "serialnumber", cert.SerialNumber)
+	return request, cert, nil
+}
+
+// RejectIssuanceRequest rejects a pending request.
+func RejectIssuanceRequest(ctx context.Context, operator *models.User, id, comment string) (*models.IssuanceRequest, error) {
+	request, err := pendingRequest(ctx, operator, id)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Status = models.IssuanceRejected
+	request.AddEvent("rejected", operator.Username, comment)
+	if err := updateIssuanceRequest(ctx, request, models.IssuancePending); err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Certificate request rejected", "request_id", request.ID.Hex())
+	return request, nil
+}
+
+func pendingRequest(ctx context.Context, operator *models.User, id string) (*models.IssuanceRequest, error) {
+	request, err := GetIssuanceRequest(ctx, operator, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Status != models.IssuancePending {
+		return nil, api.NewStatusError(http.StatusConflict, "Certificate request is "+request.Status, nil)
+	}
+
+	return request, nil
+}
+
+func updateIssuanceRequest(ctx context.Context, request *models.IssuanceRequest, expectedStatus string) error {
+	err := repositories.GetIssuanceRequestRepository().Update(*request, expectedStatus)
+	if err == mongo.ErrNoDocuments {
+		return api.NewStatusError(http.StatusConflict, "Certificate request was decided concurrently", err)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update certificate request", "request_id", request.ID.Hex(), "error", err)
+		return api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+	return nil
+}
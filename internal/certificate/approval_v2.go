@@ -0,0 +1,126 @@
+package certificate
+
+import (
+	"encoding/json"
+	"gcipher/internal/db/models"
+	"gcipher/internal/server/api"
+	"gcipher/internal/user"
+	"net/http"
+)
+
+// HandleListIssuanceRequestsV2 handles GET /api/v2/certificate-requests?status=... and is restricted to admins.
+func HandleListIssuanceRequestsV2(w http.ResponseWriter, r *http.Request) {
+	if _, ok := user.RequireAdmin(w, r); !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.IssuancePending, models.IssuanceApproved, models.IssuanceRejected, models.IssuanceExpired, models.IssuanceFailed:
+	default:
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid status parameter")
+		return
+	}
+
+	requests, err := ListIssuanceRequests(r.Context(), status)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	requestList := make([]api.IssuanceRequestResponseData, 0, len(requests))
+	for i := range requests {
+		requestList = append(requestList, newIssuanceRequestResponseData(&requests[i]))
+	}
+
+	api.EncodeResponse(w, requestList)
+}
+
+// HandleGetIssuanceRequestV2 handles GET /api/v2/certificate-requests/{id} so requesters can poll the status.
+func HandleGetIssuanceRequestV2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	request, err := GetIssuanceRequest(r.Context(), authUser, r.PathValue("id"))
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	api.EncodeResponse(w, newIssuanceRequestResponseData(request))
+}
+
+// HandleApproveIssuanceRequestV2 handles POST /api/v2/certificate-requests/{id}/approve and
+// answers with the issued certificate.
+func HandleApproveIssuanceRequestV2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var data api.DecisionData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	_, cert, err := ApproveIssuanceRequest(r.Context(), authUser, r.PathValue("id"), data.Comment)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v2/certificates/"+cert.SerialNumber)
+	api.EncodeResponseWithStatus(w, http.StatusCreated, newCertificateResponseData(cert))
+}
+
+// HandleRejectIssuanceRequestV2 handles POST /api/v2/certificate-requests/{id}/reject.
+func HandleRejectIssuanceRequestV2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var data api.DecisionData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	request, err := RejectIssuanceRequest(r.Context(), authUser, r.PathValue("id"), data.Comment)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	api.EncodeResponse(w, newIssuanceRequestResponseData(request))
+}
+
+func newIssuanceRequestResponseData(request *models.IssuanceRequest) api.IssuanceRequestResponseData {
+	data := api.IssuanceRequestResponseData{
+		ID:           request.ID.Hex(),
+		Username:     request.Username,
+		Applicant:    request.Applicant,
+		Type:         request.Type,
+		Lifetime:     request.Lifetime,
+		Reasons:      request.Reasons,
+		Status:       request.Status,
+		SerialNumber: request.SerialNumber,
+		Events:       make([]api.AuditEventData, 0, len(request.Events)),
+		CreatedAt:    request.CreatedAt,
+		ExpiresAt:    request.ExpiresAt,
+	}
+
+	for _, event := range request.Events {
+		data.Events = append(data.Events, api.AuditEventData{
+			Action:   event.Action,
+			Username: event.Username,
+			Comment:  event.Comment,
+			Time:     event.Time,
+		})
+	}
+
+	return data
+}
@@ -1,19 +1,12 @@
 package certificate
 
 import (
-	"crypto/rand"
-	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
-	"gcipher/internal/config"
-	"gcipher/internal/db/models"
-	"gcipher/internal/db/repositories"
+	"gcipher/internal/logging"
 	"gcipher/internal/server/api"
 	"gcipher/internal/user"
-	"math/big"
+	"log/slog"
 	"net/http"
-	"time"
 )
 
 // HandleCertificateRequest handles incoming certificate signing requests (CSRs) and generates signed certificates.
@@ -27,95 +20,52 @@ func HandleCertificateRequest(w http.ResponseWriter, r *http.Request) {
 
 	authUser, err := user.Authenticate(request.Auth.Username, request.Auth.Password)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusUnauthorized, "Unauthenticated")
+		slog.WarnContext(r.Context(), "Authentication failed", "auth", request.Auth, "error", err)
+		user.EncodeAuthenticationError(w, err)
 		return
 	}
+	logging.SetUsername(r.Context(), authUser.Username)
 
-	cfg, err := config.GetConfig()
+	cert, pending, err := SubmitCertificateRequest(r.Context(), authUser, request.Data)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusBadRequest, "Couldn't read config")
+		api.EncodeError(w, err)
 		return
 	}
 
-	// Determine key usage from type
-	var keyUsage x509.KeyUsage
-	var extKeyUsage []x509.ExtKeyUsage
-
-	switch request.Data.Type {
-	case "client":
-		keyUsage = x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
-		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
-	default:
-		keyUsage = x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
-		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
-	}
-
-	// Decode CSR from base64
-	csrBytes, err := base64.StdEncoding.DecodeString(request.Data.CSR)
-	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid CSR format")
+	// Requests awaiting approval are polled using /api/v1/certificate/status
+	if pending != nil {
+		api.EncodeResponseWithStatus(w, http.StatusAccepted, newIssuanceRequestResponseData(pending))
 		return
 	}
 
-	// Parse CSR
-	csr, err := x509.ParseCertificateRequest(csrBytes)
-	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusBadRequest, "Failed to parse CSR")
-		return
-	}
-
-	if request.Data.Lifetime < 1 {
-		request.Data.Lifetime = cfg.CertificateLifetimeDefault
-	}
+	// Return certificate to the client
+	api.EncodeResponse(w, api.CertificateResponseData{CertificatePEM: string(cert.CertificatePEM)})
+}
 
-	serialNumber, succeed := new(big.Int).SetString(csr.Subject.SerialNumber, 16)
-	if !succeed {
-		api.EncodeErrorResponse(w, http.StatusBadRequest, "CSR doesn't contain valid serial number")
+// HandleCertificateRequestStatus returns the status of a certificate request awaiting approval.
+func HandleCertificateRequestStatus(w http.ResponseWriter, r *http.Request) {
+	var request api.Request
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	// Create certificate template
-	template := x509.Certificate{
-		Issuer:                cfg.CACert.Subject,
-		SignatureAlgorithm:    csr.SignatureAlgorithm,
-		PublicKeyAlgorithm:    csr.PublicKeyAlgorithm,
-		Version:               csr.Version,
-		SerialNumber:          serialNumber,
-		Subject:               csr.Subject,
-		IPAddresses:           csr.IPAddresses,
-		EmailAddresses:        csr.EmailAddresses,
-		DNSNames:              csr.DNSNames,
-		URIs:                  csr.URIs,
-		Extensions:            csr.Extensions,
-		ExtraExtensions:       csr.ExtraExtensions,
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(0, 0, request.Data.Lifetime),
-		KeyUsage:              keyUsage,
-		ExtKeyUsage:           extKeyUsage,
-		BasicConstraintsValid: true,
-	}
-
-	// Generate certificate
-	certBytes, err := x509.CreateCertificate(rand.Reader, &template, cfg.CACert, csr.PublicKey, cfg.CAKey)
+	authUser, err := user.Authenticate(request.Auth.Username, request.Auth.Password)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to create certificate")
+		slog.WarnContext(r.Context(), "Authentication failed", "auth", request.Auth, "error", err)
+		user.EncodeAuthenticationError(w, err)
 		return
 	}
+	logging.SetUsername(r.Context(), authUser.Username)
 
-	// Encode certificate to PEM format
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
-
-	// Save certificate to database
-	cert := models.NewCertificate(template.Subject.SerialNumber, certPEM, authUser.Username)
-
-	err = repositories.GetCertificateRepository().Insert(*cert)
+	issuanceRequest, err := GetIssuanceRequest(r.Context(), authUser, request.Data.RequestID)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		api.EncodeError(w, err)
 		return
 	}
 
-	// Return certificate to the client
-	api.EncodeResponse(w, api.CertificateResponseData{CertificatePEM: string(certPEM)})
+	api.EncodeResponse(w, newIssuanceRequestResponseData(issuanceRequest))
 }
 
 // HandleCertificateRetrieval retrieves a certificate by serial number.
@@ -129,18 +79,15 @@ func HandleCertificateRetrieval(w http.ResponseWriter, r *http.Request) {
 
 	authUser, err := user.Authenticate(request.Auth.Username, request.Auth.Password)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusUnauthorized, "Unauthenticated")
+		slog.WarnContext(r.Context(), "Authentication failed", "auth", request.Auth, "error", err)
+		user.EncodeAuthenticationError(w, err)
 		return
 	}
+	logging.SetUsername(r.Context(), authUser.Username)
 
-	if request.Data.SerialNumber == "" {
-		api.EncodeErrorResponse(w, http.StatusBadRequest, "Missing serialnumber parameter")
-		return
-	}
-
-	cert, err := repositories.GetCertificateRepository().FindBySerialNumberAndUsername(request.Data.SerialNumber, authUser.Username)
+	cert, err := RetrieveCertificate(r.Context(), authUser, request.Data.SerialNumber)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusNotFound, "Certificate not found")
+		api.EncodeError(w, err)
 		return
 	}
 
@@ -159,33 +106,15 @@ func HandleRevokeCertificate(w http.ResponseWriter, r *http.Request) {
 
 	authUser, err := user.Authenticate(request.Auth.Username, request.Auth.Password)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusUnauthorized, "Unauthenticated")
-		return
-	}
-
-	if request.Data.SerialNumber == "" {
-		api.EncodeErrorResponse(w, http.StatusBadRequest, "Missing serialnumber parameter")
-		return
-	}
-
-	cert, err := repositories.GetCertificateRepository().FindBySerialNumberAndUsername(request.Data.SerialNumber, authUser.Username)
-	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusNotFound, "Certificate not found")
+		slog.WarnContext(r.Context(), "Authentication failed", "auth", request.Auth, "error", err)
+		user.EncodeAuthenticationError(w, err)
 		return
 	}
+	logging.SetUsername(r.Context(), authUser.Username)
 
-	// Check if the certificate is already revoked
-	if cert.RevokedAt != nil {
-		api.EncodeErrorResponse(w, http.StatusBadRequest, "Certificate already revoked")
-		return
-	}
-
-	// Update certificate with revocation time
-	now := time.Now()
-	cert.RevokedAt = &now
-	err = repositories.GetCertificateRepository().Update(*cert)
+	_, err = RevokeCertificate(r.Context(), authUser, request.Data.SerialNumber)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		api.EncodeError(w, err)
 		return
 	}
 
@@ -202,11 +131,13 @@ func HandleCertificateList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = user.Authenticate(request.Auth.Username, request.Auth.Password)
+	authUser, err := user.Authenticate(request.Auth.Username, request.Auth.Password)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusUnauthorized, "Unauthenticated")
+		slog.WarnContext(r.Context(), "Authentication failed", "auth", request.Auth, "error", err)
+		user.EncodeAuthenticationError(w, err)
 		return
 	}
+	logging.SetUsername(r.Context(), authUser.Username)
 
 	/* TODO: add admin check?
 	if !authUser.IsAdmin() {
@@ -215,9 +146,9 @@ func HandleCertificateList(w http.ResponseWriter, r *http.Request) {
 	}
 	*/
 
-	certificates, err := repositories.GetCertificateRepository().FindByState(request.Data.State)
+	certificates, err := ListCertificates(r.Context(), nil, request.Data.State)
 	if err != nil {
-		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve certificates")
+		api.EncodeError(w, err)
 		return
 	}
 
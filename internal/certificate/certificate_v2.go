@@ -0,0 +1,215 @@
+package certificate
+
+import (
+	"encoding/json"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/format"
+	"gcipher/internal/server/api"
+	"gcipher/internal/user"
+	"gcipher/internal/util"
+	"log/slog"
+	"net/http"
+)
+
+// HandleCreateCertificateV2 handles POST /api/v2/certificates. The body carries the request data,
+// credentials are passed using HTTP basic authentication. Requests that need approval are
+// answered with 202 and the location of the pending request.
+func HandleCreateCertificateV2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	outputFormat, err := format.Negotiate(r, format.CertificateOffers)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	var data api.RequestData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	cert, pending, err := SubmitCertificateRequest(r.Context(), authUser, data)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	if pending != nil {
+		w.Header().Set("Location", "/api/v2/certificate-requests/"+pending.ID.Hex())
+		api.EncodeResponseWithStatus(w, http.StatusAccepted, newIssuanceRequestResponseData(pending))
+		return
+	}
+
+	w.Header().Set("Location", "/api/v2/certificates/"+cert.SerialNumber)
+	writeCertificate(w, r, http.StatusCreated, outputFormat, cert)
+}
+
+// HandleGetCertificateV2 handles GET /api/v2/certificates/{serial}. The representation is
+// selected using the format parameter or the Accept header.
+func HandleGetCertificateV2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	outputFormat, err := format.Negotiate(r, format.CertificateOffers)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	cert, err := RetrieveCertificate(r.Context(), authUser, r.PathValue("serial"))
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	writeCertificate(w, r, http.StatusOK, outputFormat, cert)
+}
+
+// HandleRevokeCertificateV2 handles DELETE /api/v2/certificates/{serial}.
+func HandleRevokeCertificateV2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	cert, err := RevokeCertificate(r.Context(), authUser, r.PathValue("serial"))
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	api.EncodeResponse(w, newCertificateResponseData(cert))
+}
+
+// HandleListCertificatesV2 handles GET /api/v2/certificates?state=... and lists the caller's certificates.
+func HandleListCertificatesV2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", "valid", "revoked":
+	default:
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid state parameter")
+		return
+	}
+
+	certificates, err := ListCertificates(r.Context(), authUser, state)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	certList := make([]api.CertificateResponseData, 0, len(certificates))
+	for i := range certificates {
+		certList = append(certList, newCertificateResponseData(&certificates[i]))
+	}
+
+	api.EncodeResponse(w, certList)
+}
+
+func newCertificateResponseData(cert *models.Certificate) api.CertificateResponseData {
+	return api.CertificateResponseData{
+		CertificatePEM: string(cert.CertificatePEM),
+		SerialNumber:   cert.SerialNumber,
+		RevokedAt:      cert.RevokedAt,
+	}
+}
+
+// writeCertificate writes the certificate in the negotiated representation. The JSON
+// representations use the response envelope, all others are sent as attachment.
+func writeCertificate(w http.ResponseWriter, r *http.Request, code int, outputFormat string, cert *models.Certificate) {
+	if outputFormat == format.JSON {
+		api.EncodeResponseWithStatus(w, code, newCertificateResponseData(cert))
+		return
+	}
+
+	parsed, err := util.ParseCertificateFromBytes(cert.CertificatePEM)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to parse stored certificate", "serialnumber", cert.SerialNumber, "error", err)
+		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if outputFormat == format.Decoded {
+		details := format.DecodeCertificate(parsed)
+		details.SerialNumber = cert.SerialNumber
+		details.RevokedAt = cert.RevokedAt
+		api.EncodeResponseWithStatus(w, code, details)
+		return
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Couldn't read config")
+		return
+	}
+
+	if err := format.WriteCertificate(w, code, outputFormat, parsed, cfg.CAChain()); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode certificate", "format", outputFormat, "error", err)
+		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to encode certificate")
+	}
+}
+
+// HandleGenerateCertificateV2 handles POST /api/v2/certificates/pkcs12. The keypair is generated
+// server-side and returned together with the certificate and CA chain as a PKCS#12 bundle.
+func HandleGenerateCertificateV2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	var data api.KeyGenerationRequestData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	cert, pfxData, err := GenerateCertificate(r.Context(), authUser, data)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v2/certificates/"+cert.SerialNumber)
+	writePKCS12(w, http.StatusCreated, cert.SerialNumber, pfxData)
+}
+
+// HandleGetPKCS12V2 handles GET /api/v2/certificates/{serial}/pkcs12 and returns the stored
+// bundle of a certificate whose key was generated with persist_key.
+func HandleGetPKCS12V2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	cert, err := RetrieveCertificate(r.Context(), authUser, r.PathValue("serial"))
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	if len(cert.PKCS12) == 0 {
+		api.EncodeErrorResponse(w, http.StatusNotFound, "No PKCS#12 bundle stored for this certificate")
+		return
+	}
+
+	writePKCS12(w, http.StatusOK, cert.SerialNumber, cert.PKCS12)
+}
+
+func writePKCS12(w http.ResponseWriter, code int, serialNumber string, pfxData []byte) {
+	w.Header().Set("Content-Type", "application/x-pkcs12")
+	w.Header().Set("Content-Disposition", "attachment; filename="+serialNumber+".p12")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(pfxData)
+}
@@ -0,0 +1,295 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"fmt"
+	"gcipher/internal/db/models"
+	"gcipher/internal/server/api"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// checkProfile enforces the rules that depend on the issuance profile. Subordinate CAs are only
+// issued to admins and within the constraints of the issuing CA, the names of all other
+// certificates must satisfy the name constraints of every CA in the chain.
+func checkProfile(chain []*x509.Certificate, owner *models.User, profile issuanceProfile, csr *x509.CertificateRequest, dnsNames []string, data api.RequestData) error {
+	if !profile.isCA {
+		return checkNameConstraints(chain, dnsNames, csr.IPAddresses, csr.EmailAddresses, csr.URIs)
+	}
+
+	if !owner.IsAdmin() {
+		return api.NewStatusError(http.StatusForbidden, "Only admins can request subordinate CA certificates", nil)
+	}
+	return applySubCA(&x509.Certificate{}, chain[0], data)
+}
+
+// applySubCA sets the basic and name constraints of a subordinate CA on the template. The path
+// length defaults to 0, so the sub-CA can only issue end-entity certificates, and both have to
+// fit within the constraints of the issuer.
+func applySubCA(template *x509.Certificate, issuer *x509.Certificate, data api.RequestData) error {
+	maxPathLen := 0
+	if data.MaxPathLen != nil {
+		maxPathLen = *data.MaxPathLen
+	}
+	if maxPathLen < 0 {
+		return api.NewStatusError(http.StatusBadRequest, "max_path_len must not be negative", nil)
+	}
+	if issuer.MaxPathLenZero {
+		return api.NewStatusError(http.StatusBadRequest, "The path length constraint of the CA doesn't allow subordinate CAs", nil)
+	}
+	if issuer.MaxPathLen > 0 && maxPathLen >= issuer.MaxPathLen {
+		return api.NewStatusError(http.StatusBadRequest,
+			fmt.Sprintf("max_path_len must be below the CA's path length constraint of %d", issuer.MaxPathLen), nil)
+	}
+
+	template.IsCA = true
+	template.MaxPathLen = maxPathLen
+	template.MaxPathLenZero = maxPathLen == 0
+	// Names of a CA belong in its name constraints, not in subject alternative names
+	template.DNSNames, template.IPAddresses, template.EmailAddresses, template.URIs = nil, nil, nil, nil
+
+	if data.NameConstraints == nil {
+		return checkConstraintsWithin(template, issuer)
+	}
+
+	nc := data.NameConstraints
+	template.PermittedDNSDomainsCritical = true
+	template.PermittedDNSDomains = normalizeDomains(nc.PermittedDNSDomains)
+	template.ExcludedDNSDomains = normalizeDomains(nc.ExcludedDNSDomains)
+	template.PermittedEmailAddresses = normalizeDomains(nc.PermittedEmailAddresses)
+	template.ExcludedEmailAddresses = normalizeDomains(nc.ExcludedEmailAddresses)
+
+	var err error
+	if template.PermittedIPRanges, err = parseIPRanges(nc.PermittedIPRanges); err != nil {
+		return err
+	}
+	if template.ExcludedIPRanges, err = parseIPRanges(nc.ExcludedIPRanges); err != nil {
+		return err
+	}
+
+	for _, domain := range append(template.PermittedDNSDomains, template.ExcludedDNSDomains...) {
+		if err := checkDNSName(strings.TrimPrefix(domain, ".")); err != nil {
+			return api.NewStatusError(http.StatusBadRequest, fmt.Sprintf("Invalid DNS name constraint %s", domain), nil)
+		}
+	}
+
+	return checkConstraintsWithin(template, issuer)
+}
+
+// checkConstraintsWithin makes sure a sub-CA doesn't claim names its issuer isn't permitted to
+// issue for. Path validation would reject such certificates anyway, refusing them at issuance
+// gives a clear error instead of a CA that fails in the field.
+func checkConstraintsWithin(template *x509.Certificate, issuer *x509.Certificate) error {
+	if len(issuer.PermittedDNSDomains) > 0 {
+		if len(template.PermittedDNSDomains) == 0 {
+			return constraintError("permitted DNS domains are required by the CA")
+		}
+		for _, domain := range template.PermittedDNSDomains {
+			if !matchesAny(issuer.PermittedDNSDomains, domain, domainWithin) {
+				return constraintError(fmt.Sprintf("DNS domain %s is not permitted by the CA", domain))
+			}
+		}
+	}
+	for _, domain := range template.PermittedDNSDomains {
+		if matchesAny(issuer.ExcludedDNSDomains, domain, domainWithin) {
+			return constraintError(fmt.Sprintf("DNS domain %s is excluded by the CA", domain))
+		}
+	}
+
+	if len(issuer.PermittedIPRanges) > 0 {
+		if len(template.PermittedIPRanges) == 0 {
+			return constraintError("permitted IP ranges are required by the CA")
+		}
+		for _, ipRange := range template.PermittedIPRanges {
+			if !rangeWithinAny(issuer.PermittedIPRanges, ipRange) {
+				return constraintError(fmt.Sprintf("IP range %s is not permitted by the CA", ipRange))
+			}
+		}
+	}
+	for _, ipRange := range template.PermittedIPRanges {
+		if rangeWithinAny(issuer.ExcludedIPRanges, ipRange) {
+			return constraintError(fmt.Sprintf("IP range %s is excluded by the CA", ipRange))
+		}
+	}
+
+	if len(issuer.PermittedEmailAddresses) > 0 {
+		if len(template.PermittedEmailAddresses) == 0 {
+			return constraintError("permitted email addresses are required by the CA")
+		}
+		for _, email := range template.PermittedEmailAddresses {
+			if !matchesAny(issuer.PermittedEmailAddresses, email, emailWithin) {
+				return constraintError(fmt.Sprintf("email constraint %s is not permitted by the CA", email))
+			}
+		}
+	}
+	for _, email := range template.PermittedEmailAddresses {
+		if matchesAny(issuer.ExcludedEmailAddresses, email, emailWithin) {
+			return constraintError(fmt.Sprintf("email constraint %s is excluded by the CA", email))
+		}
+	}
+
+	return nil
+}
+
+// checkNameConstraints checks the names of an end-entity certificate against the permitted and
+// excluded subtrees of every CA in the chain.
+func checkNameConstraints(chain []*x509.Certificate, dnsNames []string, ips []net.IP, emails []string, uris []*url.URL) error {
+	for _, ca := range chain {
+		for _, name := range dnsNames {
+			if err := checkSubtrees(ca, name, ca.PermittedDNSDomains, ca.ExcludedDNSDomains, domainWithin); err != nil {
+				return err
+			}
+		}
+		for _, email := range emails {
+			if err := checkSubtrees(ca, email, ca.PermittedEmailAddresses, ca.ExcludedEmailAddresses, emailWithin); err != nil {
+				return err
+			}
+		}
+		for _, uri := range uris {
+			if err := checkSubtrees(ca, uri.Hostname(), ca.PermittedURIDomains, ca.ExcludedURIDomains, domainWithin); err != nil {
+				return err
+			}
+		}
+		for _, ip := range ips {
+			if len(ca.PermittedIPRanges) > 0 && !containsIP(ca.PermittedIPRanges, ip) {
+				return nameConstraintError(ip.String(), "not permitted", ca)
+			}
+			if containsIP(ca.ExcludedIPRanges, ip) {
+				return nameConstraintError(ip.String(), "excluded", ca)
+			}
+		}
+	}
+	return nil
+}
+
+func checkSubtrees(ca *x509.Certificate, name string, permitted, excluded []string, within func(name, constraint string) bool) error {
+	if len(permitted) > 0 && !matchesAny(permitted, name, within) {
+		return nameConstraintError(name, "not permitted", ca)
+	}
+	if matchesAny(excluded, name, within) {
+		return nameConstraintError(name, "excluded", ca)
+	}
+	return nil
+}
+
+// domainWithin reports whether a DNS name or domain lies within a DNS name constraint. Following
+// RFC 5280 a constraint matches the domain and its subdomains, one with a leading period only
+// matches subdomains.
+func domainWithin(name, constraint string) bool {
+	name, constraint = strings.ToLower(name), strings.ToLower(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(name, constraint)
+	}
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+// emailWithin reports whether a mailbox or email constraint lies within an email constraint. A
+// constraint is either a mailbox, a host matching all mailboxes on it, or a domain with a leading
+// period matching all mailboxes on its subdomains.
+func emailWithin(name, constraint string) bool {
+	if strings.Contains(constraint, "@") {
+		return strings.EqualFold(name, constraint)
+	}
+
+	host := name
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		host = name[i+1:]
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(constraint))
+	}
+	return strings.EqualFold(host, constraint)
+}
+
+func matchesAny(constraints []string, name string, within func(name, constraint string) bool) bool {
+	for _, constraint := range constraints {
+		if within(name, constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(ranges []*net.IPNet, ip net.IP) bool {
+	for _, ipRange := range ranges {
+		if ipRange.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeWithinAny reports whether an IP range is fully contained in one of the ranges.
+func rangeWithinAny(ranges []*net.IPNet, ipRange *net.IPNet) bool {
+	ones, bits := ipRange.Mask.Size()
+	for _, outer := range ranges {
+		outerOnes, outerBits := outer.Mask.Size()
+		if bits == outerBits && ones >= outerOnes && outer.Contains(ipRange.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseIPRanges(cidrs []string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipRange, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, api.NewStatusError(http.StatusBadRequest, fmt.Sprintf("Invalid IP range %s", cidr), err)
+		}
+		ranges = append(ranges, ipRange)
+	}
+	return ranges, nil
+}
+
+func normalizeDomains(values []string) []string {
+	var normalized []string
+	for _, value := range values {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			normalized = append(normalized, value)
+		}
+	}
+	return normalized
+}
+
+func constraintError(msg string) error {
+	return api.NewStatusError(http.StatusBadRequest, "Invalid name constraints: "+msg, nil)
+}
+
+func nameConstraintError(name, verdict string, ca *x509.Certificate) error {
+	return api.NewStatusError(http.StatusBadRequest,
+		fmt.Sprintf("%s is %s by the name constraints of %s", name, verdict, ca.Subject.CommonName), nil)
+}
+
+// nameConstraintsOf converts requested name constraints for storage with a pending request.
+func nameConstraintsOf(nc *api.NameConstraints) *models.NameConstraints {
+	if nc == nil {
+		return nil
+	}
+	return &models.NameConstraints{
+		PermittedDNSDomains:     nc.PermittedDNSDomains,
+		ExcludedDNSDomains:      nc.ExcludedDNSDomains,
+		PermittedIPRanges:       nc.PermittedIPRanges,
+		ExcludedIPRanges:        nc.ExcludedIPRanges,
+		PermittedEmailAddresses: nc.PermittedEmailAddresses,
+		ExcludedEmailAddresses:  nc.ExcludedEmailAddresses,
+	}
+}
+
+// requestedNameConstraints converts the stored name constraints of a pending request back.
+func requestedNameConstraints(nc *models.NameConstraints) *api.NameConstraints {
+	if nc == nil {
+		return nil
+	}
+	return &api.NameConstraints{
+		PermittedDNSDomains:     nc.PermittedDNSDomains,
+		ExcludedDNSDomains:      nc.ExcludedDNSDomains,
+		PermittedIPRanges:       nc.PermittedIPRanges,
+		ExcludedIPRanges:        nc.ExcludedIPRanges,
+		PermittedEmailAddresses: nc.PermittedEmailAddresses,
+		ExcludedEmailAddresses:  nc.ExcludedEmailAddresses,
+	}
+}
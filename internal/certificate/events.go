@@ -0,0 +1,54 @@
+package certificate
+
+import (
+	"sync"
+	"time"
+)
+
+// RevocationEvent is published whenever a certificate is revoked
+type RevocationEvent struct {
+	SerialNumber string
+	Username     string
+	RevokedAt    time.Time
+}
+
+// revocationBroker fans out revocation events to all subscribers of this process.
+// Slow subscribers miss events rather than blocking revocations.
+type revocationBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan RevocationEvent]struct{}
+}
+
+var revocations = &revocationBroker{subscribers: make(map[chan RevocationEvent]struct{})}
+
+// SubscribeRevocations returns a channel receiving revocation events and a function to cancel the subscription.
+func SubscribeRevocations() (<-chan RevocationEvent, func()) {
+	ch := make(chan RevocationEvent, 64)
+
+	revocations.mu.Lock()
+	revocations.subscribers[ch] = struct{}{}
+	revocations.mu.Unlock()
+
+	cancel := func() {
+		revocations.mu.Lock()
+		defer revocations.mu.Unlock()
+		if _, ok := revocations.subscribers[ch]; ok {
+			delete(revocations.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel
+}
+
+func publishRevocation(event RevocationEvent) {
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+
+	for ch := range revocations.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
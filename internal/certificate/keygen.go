@@ -0,0 +1,233 @@
+package certificate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/escrow"
+	"gcipher/internal/server/api"
+	"gcipher/internal/user"
+	"gcipher/internal/util"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// keyProfile describes the key generated for a certificate type when the request doesn't specify one
+type keyProfile struct {
+	keyType string
+	keySize int
+}
+
+var keyProfiles = map[string]keyProfile{
+	"server": {keyType: "ecdsa", keySize: 256},
+	"client": {keyType: "rsa", keySize: 2048},
+	"smime":  {keyType: "rsa", keySize: 2048},
+}
+
+// allowedKeySizes lists the RSA modulus sizes and ECDSA curve sizes that may be generated
+var allowedKeySizes = map[string][]int{
+	"rsa":   {2048, 3072, 4096},
+	"ecdsa": {256, 384, 521},
+}
+
+// GenerateCertificate generates a keypair for the owner, signs a certificate for it and returns
+// both bundled as a password protected PKCS#12 file including the CA chain.
+func GenerateCertificate(ctx context.Context, owner *models.User, data api.KeyGenerationRequestData) (*models.Certificate, []byte, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, "Couldn't read config", err)
+	}
+
+	if data.PersistKey && !cfg.KeygenAllowKeyPersistence {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, "Persisting generated keys is disabled", nil)
+	}
+
+	if err := user.CheckPasswordPolicy(cfg, owner.Username, data.Password, cfg.KeygenMinPasswordLength); err != nil {
+		return nil, nil, user.PasswordPolicyError(err)
+	}
+
+	encoder, err := util.PKCS12Encoder(data.Encoding)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, api.Capitalize(err.Error()), nil)
+	}
+
+	profile := data.Type
+	if profile == "" {
+		profile = "server"
+	}
+	if _, ok := keyProfiles[profile]; !ok {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, fmt.Sprintf("Unsupported certificate type for key generation: %s (supported: server, client, smime)", data.Type), nil)
+	}
+
+	escrowKey := escrow.Required(cfg, profile) || data.Escrow
+	if escrowKey && !escrow.Enabled(cfg) {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, "Key escrow is disabled", nil)
+	}
+
+	key, err := generateKey(profile, data.KeyType, data.KeySize)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, api.Capitalize(err.Error()), nil)
+	}
+
+	csrDER, err := createCSR(key, data)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, api.Capitalize(err.Error()), nil)
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	// Approval is checked on the names the certificate will carry, which include the common
+	// name of server requests without SANs
+	dnsNames, err := subjectDNSNames(profileFor(profile), csr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Generated keys are returned right away, so there is no way to hold them back for approval
+	lifetime := lifetimeOf(cfg, api.RequestData{Lifetime: data.Lifetime})
+	if reasons := approvalReasons(cfg, profile, dnsNames, lifetime); len(reasons) > 0 {
+		return nil, nil, api.NewStatusError(http.StatusForbidden, "Request requires approval, submit a CSR instead: "+strings.Join(reasons, ", "), nil)
+	}
+
+	cert, err := IssueCertificate(ctx, owner, api.RequestData{
+		Applicant: data.Applicant,
+		CSR:       base64.StdEncoding.EncodeToString(csrDER),
+		Lifetime:  data.Lifetime,
+		Type:      profile,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsed, err := util.ParseCertificateFromBytes(cert.CertificatePEM)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	if escrowKey {
+		if err := escrow.EscrowKey(ctx, cfg, cert, key); err != nil {
+			slog.ErrorContext(ctx, "Failed to escrow private key", "serialnumber", cert.SerialNumber, "error", err)
+			// The certificate was never handed out, don't keep it without its escrowed key
+			if err := repositories.GetCertificateRepository().Delete(cert.SerialNumber); err != nil {
+				slog.ErrorContext(ctx, "Failed to delete certificate without escrowed key", "serialnumber", cert.SerialNumber, "error", err)
+			}
+			return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Failed to escrow private key", err)
+		}
+	}
+
+	pfxData, err := encoder.Encode(key, parsed, cfg.CAChain(), data.Password)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to encode PKCS#12 bundle", "error", err)
+		return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Failed to encode PKCS#12 bundle", err)
+	}
+
+	if data.PersistKey {
+		// Only the password protected bundle is kept, the server never stores the plain key
+		cert.PKCS12 = pfxData
+		if err := repositories.GetCertificateRepository().Update(*cert); err != nil {
+			slog.ErrorContext(ctx, "Failed to store PKCS#12 bundle", "serialnumber", cert.SerialNumber, "error", err)
+			return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+		}
+	}
+
+	return cert, pfxData, nil
+}
+
+// generateKey generates a private key of the given type and size, falling back to the profile's defaults.
+func generateKey(profile, keyType string, keySize int) (crypto.Signer, error) {
+	defaults := keyProfiles[profile]
+	if keyType == "" {
+		keyType = defaults.keyType
+		if keySize == 0 {
+			keySize = defaults.keySize
+		}
+	}
+
+	sizes, ok := allowedKeySizes[keyType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+	if keySize == 0 {
+		keySize = sizes[0]
+	}
+
+	allowed := false
+	for _, size := range sizes {
+		if size == keySize {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("unsupported %s key size: %d", keyType, keySize)
+	}
+
+	switch keyType {
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, keySize)
+	default:
+		var curve elliptic.Curve
+		switch keySize {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		default:
+			curve = elliptic.P521()
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	}
+}
+
+// createCSR builds the CSR passed to the regular issuance flow, so server-side generated
+// keys go through the same checks as client-provided ones.
+func createCSR(key crypto.Signer, data api.KeyGenerationRequestData) ([]byte, error) {
+	if data.CommonName == "" {
+		return nil, fmt.Errorf("missing common_name parameter")
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	subject := pkix.Name{
+		CommonName:   data.CommonName,
+		SerialNumber: fmt.Sprintf("%x", serialNumber),
+	}
+	if data.Organization != "" {
+		subject.Organization = []string{data.Organization}
+	}
+
+	template := x509.CertificateRequest{
+		Subject:        subject,
+		DNSNames:       data.DNSNames,
+		EmailAddresses: data.EmailAddresses,
+	}
+
+	for _, ip := range data.IPAddresses {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return nil, fmt.Errorf("invalid IP address: %s", ip)
+		}
+		template.IPAddresses = append(template.IPAddresses, parsed)
+	}
+
+	return x509.CreateCertificateRequest(rand.Reader, &template, key)
+}
@@ -0,0 +1,66 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// lintCertificate checks a freshly signed certificate against the rules every certificate
+// issued by gcipher must follow. It returns an error listing all violations.
+func lintCertificate(cert *x509.Certificate, issuer *x509.Certificate, profile string) error {
+	var findings []string
+
+	if err := cert.CheckSignatureFrom(issuer); err != nil {
+		findings = append(findings, fmt.Sprintf("signature doesn't verify with the issuer: %v", err))
+	}
+
+	if cert.SerialNumber.Sign() <= 0 {
+		findings = append(findings, "serial number must be positive")
+	}
+	if len(cert.SerialNumber.Bytes()) > 20 {
+		findings = append(findings, "serial number must not be longer than 20 octets")
+	}
+
+	if !cert.NotAfter.After(cert.NotBefore) {
+		findings = append(findings, "validity period is empty")
+	}
+	if cert.NotAfter.After(issuer.NotAfter) {
+		findings = append(findings, "certificate outlives its issuer")
+	}
+
+	if profile == "subca" {
+		if !cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+			findings = append(findings, "subordinate CA certificate must be a CA allowed to sign certificates")
+		}
+		if issuer.MaxPathLenZero || (issuer.MaxPathLen > 0 && (cert.MaxPathLen < 0 || cert.MaxPathLen >= issuer.MaxPathLen)) {
+			findings = append(findings, "path length exceeds the issuer's path length constraint")
+		}
+	} else {
+		if cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign != 0 {
+			findings = append(findings, "end-entity certificate must not be a CA")
+		}
+		if len(cert.ExtKeyUsage) == 0 {
+			findings = append(findings, "extended key usage is missing")
+		}
+	}
+	if cert.KeyUsage == 0 {
+		findings = append(findings, "key usage is missing")
+	}
+
+	switch profile {
+	case "server":
+		if len(cert.DNSNames) == 0 && len(cert.IPAddresses) == 0 {
+			findings = append(findings, "server certificate has no DNS or IP subject alternative name")
+		}
+	case "smime":
+		if len(cert.EmailAddresses) == 0 {
+			findings = append(findings, "S/MIME certificate has no email subject alternative name")
+		}
+	}
+
+	if len(findings) > 0 {
+		return fmt.Errorf("%s", strings.Join(findings, "; "))
+	}
+	return nil
+}
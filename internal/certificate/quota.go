@@ -0,0 +1,126 @@
+package certificate
+
+import (
+	"context"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/ratelimit"
+	"gcipher/internal/server/api"
+	"gcipher/internal/user"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Names of the issuance quotas
+const (
+	QuotaCertificatesPerDay = "certificates_per_day"
+	QuotaActiveCertificates = "active_certificates"
+)
+
+// quotaWindow is the window the daily issuance quota is counted over
+const quotaWindow = 24 * time.Hour
+
+// checkQuota refuses issuing another certificate to the owner with 429 if a quota is used up.
+func checkQuota(ctx context.Context, cfg *config.Config, owner *models.User) error {
+	usage, err := quotaUsage(cfg, owner)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count certificates for quota", "error", err)
+		return api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	for _, quota := range usage {
+		if quota.Used < quota.Limit {
+			continue
+		}
+
+		slog.WarnContext(ctx, "Issuance quota exceeded", "quota", quota.Name, "limit", quota.Limit)
+		statusErr := api.NewStatusError(http.StatusTooManyRequests, fmt.Sprintf("Quota %s of %d exceeded", quota.Name, quota.Limit), nil)
+		if quota.ResetsAt != nil {
+			statusErr.RetryAfter = time.Until(*quota.ResetsAt)
+		}
+		return statusErr
+	}
+
+	return nil
+}
+
+// quotaUsage returns the usage of the configured quotas of the owner.
+func quotaUsage(cfg *config.Config, owner *models.User) ([]api.QuotaUsage, error) {
+	usage := []api.QuotaUsage{}
+	now := time.Now()
+	repo := repositories.GetCertificateRepository()
+
+	if cfg.QuotaCertificatesPerDay > 0 {
+		since := now.Add(-quotaWindow)
+		used, err := repo.CountIssuedSince(owner.Username, since)
+		if err != nil {
+			return nil, err
+		}
+
+		quota := api.QuotaUsage{Name: QuotaCertificatesPerDay, Limit: cfg.QuotaCertificatesPerDay, Used: used}
+		if used >= quota.Limit {
+			// A slot frees up once the oldest certificate in the window drops out of it
+			first, err := repo.FindFirstIssuedSince(owner.Username, since)
+			if err != nil {
+				return nil, err
+			}
+			resetsAt := first.IssuedAt.Add(quotaWindow)
+			quota.ResetsAt = &resetsAt
+		}
+		usage = append(usage, quota)
+	}
+
+	if cfg.QuotaActiveCertificates > 0 {
+		used, err := repo.CountActive(owner.Username, now)
+		if err != nil {
+			return nil, err
+		}
+		usage = append(usage, api.QuotaUsage{Name: QuotaActiveCertificates, Limit: cfg.QuotaActiveCertificates, Used: used})
+	}
+
+	return usage, nil
+}
+
+// HandleUsageV2 handles GET /api/v2/usage and reports the caller's remaining requests and
+// issuance quotas. Admins can query the quotas of other users with ?username=...
+func HandleUsageV2(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Couldn't read config")
+		return
+	}
+
+	subject := authUser
+	if username := r.URL.Query().Get("username"); username != "" && username != authUser.Username {
+		if !authUser.IsAdmin() {
+			api.EncodeErrorResponse(w, http.StatusForbidden, "Access denied")
+			return
+		}
+		subject, err = repositories.GetUserRepository().FindByUsername(username)
+		if err != nil {
+			api.EncodeErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+	}
+
+	quotas, err := quotaUsage(cfg, subject)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to count certificates for quota", "error", err)
+		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	api.EncodeResponse(w, api.UsageData{
+		Username:   subject.Username,
+		RateLimits: ratelimit.Usage(r),
+		Quotas:     quotas,
+	})
+}
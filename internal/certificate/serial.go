@@ -0,0 +1,51 @@
+package certificate
+
+import (
+	"errors"
+	"fmt"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/util"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CanonicalizeSerialNumbers migrates certificates that were stored with the serial number as
+// given in the CSR, e.g. uppercase or zero-padded, to the canonical form they are looked up in.
+// Escrowed keys, key recoveries and certificate requests referring to them are updated as well.
+func CanonicalizeSerialNumbers() error {
+	certRepo := repositories.GetCertificateRepository()
+	certs, err := certRepo.FindWithNonCanonicalSerialNumber()
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range certs {
+		canonical, ok := util.CanonicalSerialNumber(cert.SerialNumber)
+		if !ok {
+			slog.Warn("Certificate has an invalid serial number", "serialnumber", cert.SerialNumber)
+			continue
+		}
+
+		_, err := certRepo.FindBySerialNumber(canonical)
+		if err == nil {
+			slog.Warn("Certificate serial number is stored in two forms", "serialnumber", cert.SerialNumber, "canonical", canonical)
+			continue
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+
+		if err := repositories.GetKeyEscrowRepository().RenameSerialNumber(cert.SerialNumber, canonical); err != nil {
+			return fmt.Errorf("failed to update escrowed key of %s: %v", cert.SerialNumber, err)
+		}
+		if err := repositories.GetIssuanceRequestRepository().RenameSerialNumber(cert.SerialNumber, canonical); err != nil {
+			return fmt.Errorf("failed to update requests of %s: %v", cert.SerialNumber, err)
+		}
+		if err := certRepo.RenameSerialNumber(cert.SerialNumber, canonical); err != nil {
+			return fmt.Errorf("failed to update %s: %v", cert.SerialNumber, err)
+		}
+		slog.Info("Certificate serial number canonicalized", "serialnumber", cert.SerialNumber, "canonical", canonical)
+	}
+	return nil
+}
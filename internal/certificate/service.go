@@ -0,0 +1,336 @@
+package certificate
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/metrics"
+	"gcipher/internal/server/api"
+	"gcipher/internal/user"
+	"gcipher/internal/util"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IssueCertificate signs the CSR contained in data and stores the resulting certificate for the owner.
+func IssueCertificate(ctx context.Context, owner *models.User, data api.RequestData) (*models.Certificate, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Couldn't read config", err)
+	}
+
+	profile := profileFor(data.Type)
+
+	csr, err := parseCSR(cfg, data.CSR, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	dnsNames, err := subjectDNSNames(profile, csr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeNames(cfg, owner, csr, dnsNames); err != nil {
+		return nil, err
+	}
+
+	if err := checkClientName(owner, profile, csr); err != nil {
+		return nil, err
+	}
+
+	if err := checkProfile(cfg.CAChain(), owner, profile, csr, dnsNames, data); err != nil {
+		return nil, err
+	}
+
+	if err := checkQuota(ctx, cfg, owner); err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now()
+	notAfter := notBefore.AddDate(0, 0, lifetimeOf(cfg, data))
+	if notAfter.After(cfg.CACert.NotAfter) {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Requested lifetime exceeds the validity of the CA certificate", nil)
+	}
+
+	serialNumber, succeed := new(big.Int).SetString(csr.Subject.SerialNumber, 16)
+	if !succeed {
+		return nil, api.NewStatusError(http.StatusBadRequest, "CSR doesn't contain valid serial number", nil)
+	}
+
+	// Create certificate template. Extensions requested in the CSR are never copied, they are
+	// derived from the profile and the validated SANs, and the signature algorithm is chosen
+	// based on the CA key.
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               csr.Subject,
+		IPAddresses:           csr.IPAddresses,
+		EmailAddresses:        csr.EmailAddresses,
+		DNSNames:              dnsNames,
+		URIs:                  csr.URIs,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              profile.keyUsage,
+		ExtKeyUsage:           profile.extKeyUsage,
+		BasicConstraintsValid: true,
+	}
+	if profile.isCA {
+		if err := applySubCA(&template, cfg.CACert, data); err != nil {
+			return nil, err
+		}
+	}
+
+	// Generate certificate
+	signingStart := time.Now()
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, cfg.CACert, csr.PublicKey, cfg.CAKey)
+	metrics.SigningDuration.WithLabelValues("certificate").Observe(time.Since(signingStart).Seconds())
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create certificate", "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Failed to create certificate", err)
+	}
+
+	// Lint the certificate before it is stored and returned
+	issued, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to parse issued certificate", "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Failed to create certificate", err)
+	}
+	if err := lintCertificate(issued, cfg.CACert, profile.name); err != nil {
+		slog.ErrorContext(ctx, "Issued certificate failed linting", "serialnumber", fmt.Sprintf("%x", serialNumber), "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Issued certificate failed linting", err)
+	}
+
+	// Encode certificate to PEM format
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+
+	// Save certificate to database
+	// Serial numbers are stored in canonical form, the form they are looked up in
+	cert := models.NewCertificate(fmt.Sprintf("%x", serialNumber), certPEM, owner.Username)
+	cert.IssuedAt = notBefore
+	cert.NotAfter = issued.NotAfter
+	cert.IssuerKeyID = util.KeyID(cfg.CACert)
+
+	err = repositories.GetCertificateRepository().Insert(*cert)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to store certificate", "serialnumber", cert.SerialNumber, "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	metrics.CertificatesIssued.WithLabelValues(profile.name, owner.Username).Inc()
+	slog.InfoContext(ctx, "Certificate issued", "serialnumber", cert.SerialNumber, "profile", profile.name)
+
+	return cert, nil
+}
+
+// issuanceProfile describes the key usages of a certificate type
+type issuanceProfile struct {
+	name        string
+	keyUsage    x509.KeyUsage
+	extKeyUsage []x509.ExtKeyUsage
+	isCA        bool
+}
+
+// profileFor returns the issuance profile of a certificate type, unknown types are issued as server certificates.
+func profileFor(certType string) issuanceProfile {
+	switch certType {
+	case "client":
+		return issuanceProfile{
+			name:        "client",
+			keyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+	case "smime":
+		return issuanceProfile{
+			name:        "smime",
+			keyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		}
+	case "codesigning":
+		return issuanceProfile{
+			name:        "codesigning",
+			keyUsage:    x509.KeyUsageDigitalSignature,
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}
+	case "subca":
+		return issuanceProfile{
+			name:     "subca",
+			keyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+			isCA:     true,
+		}
+	default:
+		return issuanceProfile{
+			name:        "server",
+			keyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+	}
+}
+
+// parseCSR decodes, parses and validates a base64 encoded DER CSR for the given profile.
+func parseCSR(cfg *config.Config, encoded string, profile issuanceProfile) (*x509.CertificateRequest, error) {
+	csrBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Invalid CSR format", err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Failed to parse CSR", err)
+	}
+
+	if err := validateCSR(cfg, csr, profile); err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, api.Capitalize(err.Error()), nil)
+	}
+
+	return csr, nil
+}
+
+// subjectDNSNames returns the DNS names the certificate will be issued for.
+func subjectDNSNames(profile issuanceProfile, csr *x509.CertificateRequest) ([]string, error) {
+	if profile.name != "server" || len(csr.DNSNames) > 0 || len(csr.IPAddresses) > 0 {
+		return csr.DNSNames, nil
+	}
+
+	// Clients ignore the common name, so CN-only server requests get it as DNS name
+	if err := checkDNSName(csr.Subject.CommonName); err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Server certificates require a DNS or IP subject alternative name", nil)
+	}
+	return []string{csr.Subject.CommonName}, nil
+}
+
+// authorizeNames checks the owner's name rules if name ownership is enforced.
+func authorizeNames(cfg *config.Config, owner *models.User, csr *x509.CertificateRequest, dnsNames []string) error {
+	if !cfg.EnforceNameOwnership {
+		return nil
+	}
+
+	if err := user.AuthorizeNames(owner, dnsNames, csr.IPAddresses, csr.EmailAddresses, csr.URIs); err != nil {
+		return api.NewStatusError(http.StatusForbidden, api.Capitalize(err.Error()), nil)
+	}
+	return nil
+}
+
+// checkClientName refuses client certificates whose common name is another user's name, the
+// common name is the username when the certificate authenticates gRPC calls.
+func checkClientName(owner *models.User, profile issuanceProfile, csr *x509.CertificateRequest) error {
+	name := csr.Subject.CommonName
+	if profile.name != "client" || name == owner.Username {
+		return nil
+	}
+
+	_, err := repositories.GetUserRepository().FindByUsername(name)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+	return api.NewStatusError(http.StatusForbidden, "Client certificates can't be issued for another user's name", nil)
+}
+
+// lifetimeOf returns the requested lifetime in days, falling back to the configured default.
+func lifetimeOf(cfg *config.Config, data api.RequestData) int {
+	if data.Lifetime < 1 {
+		return cfg.CertificateLifetimeDefault
+	}
+	return data.Lifetime
+}
+
+// RetrieveCertificate returns the certificate with the given serial number if it belongs to the owner.
+func RetrieveCertificate(ctx context.Context, owner *models.User, serialNumber string) (*models.Certificate, error) {
+	if serialNumber == "" {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Missing serialnumber parameter", nil)
+	}
+
+	if canonical, ok := util.CanonicalSerialNumber(serialNumber); ok {
+		serialNumber = canonical
+	}
+
+	cert, err := repositories.GetCertificateRepository().FindBySerialNumberAndUsername(serialNumber, owner.Username)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusNotFound, "Certificate not found", err)
+	}
+
+	return cert, nil
+}
+
+// RevokeCertificate revokes the owner's certificate with the given serial number.
+func RevokeCertificate(ctx context.Context, owner *models.User, serialNumber string) (*models.Certificate, error) {
+	cert, err := RetrieveCertificate(ctx, owner, serialNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if the certificate is already revoked
+	if cert.RevokedAt != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Certificate already revoked", nil)
+	}
+
+	// Update certificate with revocation time
+	now := time.Now()
+	cert.RevokedAt = &now
+	err = repositories.GetCertificateRepository().Update(*cert)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to revoke certificate", "serialnumber", cert.SerialNumber, "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	metrics.CertificatesRevoked.WithLabelValues(profileOf(cert), owner.Username).Inc()
+	slog.InfoContext(ctx, "Certificate revoked", "serialnumber", cert.SerialNumber)
+
+	publishRevocation(RevocationEvent{SerialNumber: cert.SerialNumber, Username: cert.Username, RevokedAt: now})
+
+	return cert, nil
+}
+
+// ListCertificates returns the certificates matching the state filter ("valid", "revoked" or empty for all).
+// If owner is nil, certificates of all users are returned.
+func ListCertificates(ctx context.Context, owner *models.User, state string) ([]models.Certificate, error) {
+	var certificates []models.Certificate
+	var err error
+
+	if owner == nil {
+		certificates, err = repositories.GetCertificateRepository().FindByState(state)
+	} else {
+		certificates, err = repositories.GetCertificateRepository().FindByStateAndUsername(state, owner.Username)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to retrieve certificates", "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Failed to retrieve certificates", err)
+	}
+
+	return certificates, nil
+}
+
+// profileOf derives the issuance profile of a stored certificate from its extended key usage.
+func profileOf(cert *models.Certificate) string {
+	parsed, err := util.ParseCertificateFromBytes(cert.CertificatePEM)
+	if err != nil {
+		return "unknown"
+	}
+	if parsed.IsCA {
+		return "subca"
+	}
+
+	for _, usage := range parsed.ExtKeyUsage {
+		switch usage {
+		case x509.ExtKeyUsageClientAuth:
+			return "client"
+		case x509.ExtKeyUsageEmailProtection:
+			return "smime"
+		case x509.ExtKeyUsageCodeSigning:
+			return "codesigning"
+		}
+	}
+	return "server"
+}
@@ -0,0 +1,149 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"gcipher/internal/config"
+	"strings"
+)
+
+var (
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionSubjectKeyID     = asn1.ObjectIdentifier{2, 5, 29, 14}
+)
+
+// allowedCSRExtensions lists the extensions a CSR may request. Their values are never copied,
+// the certificate's extensions are derived from the profile and the parsed SANs.
+var allowedCSRExtensions = []asn1.ObjectIdentifier{
+	oidExtensionSubjectAltName,
+	oidExtensionKeyUsage,
+	oidExtensionExtKeyUsage,
+	oidExtensionBasicConstraints,
+	oidExtensionSubjectKeyID,
+}
+
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+// validateCSR checks proof of possession, the strength of the public key and the requested
+// extensions before a CSR is signed with the given profile.
+func validateCSR(cfg *config.Config, csr *x509.CertificateRequest, profile issuanceProfile) error {
+	if err := csr.CheckSignature(); err != nil {
+		return fmt.Errorf("CSR signature is invalid: %v", err)
+	}
+
+	if err := checkPublicKey(cfg, csr.PublicKey); err != nil {
+		return err
+	}
+
+	if err := checkExtensions(csr, profile); err != nil {
+		return err
+	}
+
+	for _, name := range csr.DNSNames {
+		if err := checkDNSName(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkPublicKey rejects key types, sizes and curves that are considered weak, as well as
+// keys known to be compromised.
+func checkPublicKey(cfg *config.Config, publicKey interface{}) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < cfg.CSRMinRSAKeySize {
+			return fmt.Errorf("RSA key size %d is below the minimum of %d bits", key.N.BitLen(), cfg.CSRMinRSAKeySize)
+		}
+		if key.E < 65537 || key.E%2 == 0 {
+			return fmt.Errorf("RSA public exponent %d is not allowed", key.E)
+		}
+		if isROCAVulnerable(key.N) {
+			return fmt.Errorf("RSA key is vulnerable to ROCA (CVE-2017-15361)")
+		}
+		blacklisted, err := isDebianWeakKey(cfg, key)
+		if err != nil {
+			return err
+		}
+		if blacklisted {
+			return fmt.Errorf("RSA key is a known Debian weak key (CVE-2008-0166)")
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("unsupported elliptic curve: %s", key.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Errorf("unsupported public key type: %T", publicKey)
+	}
+
+	return nil
+}
+
+// checkExtensions rejects CSRs requesting extensions gcipher doesn't know, or a CA certificate
+// unless a subordinate CA is requested.
+func checkExtensions(csr *x509.CertificateRequest, profile issuanceProfile) error {
+	for _, ext := range csr.Extensions {
+		if ext.Id.Equal(oidExtensionBasicConstraints) {
+			var constraints basicConstraints
+			if _, err := asn1.Unmarshal(ext.Value, &constraints); err != nil {
+				return fmt.Errorf("invalid basic constraints extension: %v", err)
+			}
+			if constraints.IsCA && !profile.isCA {
+				return fmt.Errorf("CSR requests a CA certificate")
+			}
+			continue
+		}
+
+		allowed := false
+		for _, id := range allowedCSRExtensions {
+			if ext.Id.Equal(id) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed && ext.Critical {
+			return fmt.Errorf("CSR contains unsupported critical extension %s", ext.Id)
+		}
+	}
+
+	return nil
+}
+
+// checkDNSName checks the syntax of a DNS name, allowing a wildcard as the leftmost label only.
+func checkDNSName(name string) error {
+	if len(name) > 253 {
+		return fmt.Errorf("invalid DNS name: %s", name)
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if label == "*" && i == 0 && len(labels) > 2 {
+			continue
+		}
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid DNS name: %s", name)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid DNS name: %s", name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/server/api"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxVerifyBodySize limits the certificates accepted by HandleVerifyCertificate
+const maxVerifyBodySize = 1 << 20
+
+// verificationPurposes maps the purpose parameter to the extended key usage it requires
+var verificationPurposes = map[string]x509.ExtKeyUsage{
+	"server":       x509.ExtKeyUsageServerAuth,
+	"client":       x509.ExtKeyUsageClientAuth,
+	"smime":        x509.ExtKeyUsageEmailProtection,
+	"codesigning":  x509.ExtKeyUsageCodeSigning,
+	"timestamping": x509.ExtKeyUsageTimeStamping,
+}
+
+// VerifyOptions select the optional checks of VerifyCertificate
+type VerifyOptions struct {
+	// Purpose is a certificate type the certificate must be usable for, empty for any
+	Purpose string
+	// Name is a DNS name, IP address or email address the certificate must be valid for
+	Name string
+	// Intermediates are extra CA certificates to build the chain with
+	Intermediates []*x509.Certificate
+}
+
+// HandleVerifyCertificate handles POST /public/certificates/verify. The body is a PEM or DER
+// encoded certificate, optionally followed by intermediates, the purpose and name parameters
+// select the optional checks. The verdict is returned with 200 whether the certificate is
+// valid or not.
+func HandleVerifyCertificate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxVerifyBodySize))
+	if err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	certs, err := ParseCertificates(body)
+	if err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid certificate: "+err.Error())
+		return
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		api.EncodeError(w, api.NewStatusError(http.StatusInternalServerError, "Couldn't read config", err))
+		return
+	}
+
+	result, err := VerifyCertificate(cfg, repositories.GetCertificateRepository(), repositories.GetCARepository(), certs[0], VerifyOptions{
+		Purpose:       r.URL.Query().Get("purpose"),
+		Name:          r.URL.Query().Get("name"),
+		Intermediates: certs[1:],
+	})
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	api.EncodeResponse(w, result)
+}
+
+// ParseCertificates parses PEM encoded certificates or one or more concatenated DER
+// certificates. The first certificate is the one to verify.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		certs, err := x509.ParseCertificates(data)
+		if err != nil || len(certs) == 0 {
+			return nil, fmt.Errorf("expected a PEM or DER encoded certificate")
+		}
+		return certs, nil
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in PEM data")
+	}
+	return certs, nil
+}
+
+// VerifyCertificate decides whether gcipher considers the certificate valid right now. It builds
+// the chain to the configured CAs and checks validity, the revocation status in the repositories
+// and, if requested, the purpose and name. Every check is reported, failing ones with reasons.
+func VerifyCertificate(cfg *config.Config, certRepo *repositories.CertificateRepository, caRepo *repositories.CARepository,
+	cert *x509.Certificate, opts VerifyOptions) (*api.VerificationResult, error) {
+	var usage x509.ExtKeyUsage
+	if opts.Purpose != "" {
+		var ok bool
+		if usage, ok = verificationPurposes[opts.Purpose]; !ok {
+			return nil, api.NewStatusError(http.StatusBadRequest, "Unknown purpose "+opts.Purpose, nil)
+		}
+	}
+
+	now := time.Now()
+	result := &api.VerificationResult{
+		SerialNumber: fmt.Sprintf("%x", cert.SerialNumber),
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		Valid:        true,
+	}
+
+	chain, chainCheck := verifyChain(cfg, cert, opts.Intermediates, now)
+	result.AddCheck(chainCheck)
+	for _, ca := range chain {
+		result.Chain = append(result.Chain, ca.Subject.String())
+	}
+
+	result.AddCheck(verifyValidity(cert, chain, now))
+
+	revocationCheck, err := verifyRevocation(certRepo, caRepo, cert, chain)
+	if err != nil {
+		return nil, err
+	}
+	result.AddCheck(revocationCheck)
+
+	if opts.Purpose != "" {
+		result.AddCheck(verifyPurpose(cfg, cert, opts, usage, chain, now))
+	}
+	if opts.Name != "" {
+		result.AddCheck(verifyName(cert, opts.Name))
+	}
+
+	return result, nil
+}
+
+// verifyChain builds the chain of the certificate and returns it without the certificate itself.
+// Validity is checked separately, so the chain is built at a time the certificate is valid.
+func verifyChain(cfg *config.Config, cert *x509.Certificate, extra []*x509.Certificate, now time.Time) ([]*x509.Certificate, api.VerificationCheck) {
+	check := api.VerificationCheck{Check: "chain"}
+
+	chains, err := cert.Verify(chainOptions(cfg, cert, extra, now, x509.ExtKeyUsageAny))
+	if err != nil {
+		check.Reasons = append(check.Reasons, err.Error())
+		return nil, check
+	}
+	return chains[0][1:], check
+}
+
+func chainOptions(cfg *config.Config, cert *x509.Certificate, extra []*x509.Certificate, now time.Time, usage x509.ExtKeyUsage) x509.VerifyOptions {
+	roots, intermediates := cfg.TrustAnchors()
+	for _, ca := range extra {
+		intermediates.AddCert(ca)
+	}
+
+	at := now
+	if at.Before(cert.NotBefore) {
+		at = cert.NotBefore
+	}
+	if at.After(cert.NotAfter) {
+		at = cert.NotAfter
+	}
+
+	return x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+}
+
+// verifyValidity checks that the certificate and its chain are valid now.
+func verifyValidity(cert *x509.Certificate, chain []*x509.Certificate, now time.Time) api.VerificationCheck {
+	check := api.VerificationCheck{Check: "validity"}
+	for _, c := range append([]*x509.Certificate{cert}, chain...) {
+		if now.Before(c.NotBefore) {
+			check.Reasons = append(check.Reasons, fmt.Sprintf("%s is not valid before %s", c.Subject, c.NotBefore.Format(time.RFC3339)))
+		}
+		if now.After(c.NotAfter) {
+			check.Reasons = append(check.Reasons, fmt.Sprintf("%s expired at %s", c.Subject, c.NotAfter.Format(time.RFC3339)))
+		}
+	}
+	return check
+}
+
+// verifyRevocation checks the certificate against the certificate repository and the CAs of the
+// chain against the CA repository and, for sub-CAs issued with the subca type, the certificate
+// repository. Certificates gcipher has no record of fail the check, gcipher can't vouch for
+// their revocation status.
+func verifyRevocation(certRepo *repositories.CertificateRepository, caRepo *repositories.CARepository,
+	cert *x509.Certificate, chain []*x509.Certificate) (api.VerificationCheck, error) {
+	check := api.VerificationCheck{Check: "revocation"}
+
+	serialNumber := fmt.Sprintf("%x", cert.SerialNumber)
+	record, err := certRepo.FindBySerialNumber(serialNumber)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		check.Reasons = append(check.Reasons, "certificate is not recorded by gcipher")
+	case err != nil:
+		return check, api.NewStatusError(http.StatusInternalServerError, "Failed to check revocation status", err)
+	case !samePEM(record.CertificatePEM, cert):
+		check.Reasons = append(check.Reasons, fmt.Sprintf("serial number %s is recorded for a different certificate", serialNumber))
+	case record.RevokedAt != nil:
+		check.Reasons = append(check.Reasons, fmt.Sprintf("certificate was revoked at %s", record.RevokedAt.UTC().Format(time.RFC3339)))
+	}
+
+	for _, ca := range chain {
+		revokedAt, err := caRevocation(certRepo, caRepo, ca)
+		if err != nil {
+			return check, api.NewStatusError(http.StatusInternalServerError, "Failed to check revocation status", err)
+		}
+		if revokedAt != nil {
+			check.Reasons = append(check.Reasons, fmt.Sprintf("CA %s was revoked at %s", ca.Subject, revokedAt.UTC().Format(time.RFC3339)))
+		}
+	}
+
+	return check, nil
+}
+
+// caRevocation returns the revocation time of a CA of the chain, or nil if neither the CA
+// repository nor the certificate repository record it as revoked.
+func caRevocation(certRepo *repositories.CertificateRepository, caRepo *repositories.CARepository, ca *x509.Certificate) (*time.Time, error) {
+	serialNumber := fmt.Sprintf("%x", ca.SerialNumber)
+
+	record, err := caRepo.FindBySerialNumber(serialNumber)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	if err == nil && record.RevokedAt != nil && samePEM(record.CertificatePEM, ca) {
+		return record.RevokedAt, nil
+	}
+
+	// Sub-CAs requested with the subca type are stored like any other certificate
+	subCA, err := certRepo.FindBySerialNumber(serialNumber)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	if err == nil && subCA.RevokedAt != nil && samePEM(subCA.CertificatePEM, ca) {
+		return subCA.RevokedAt, nil
+	}
+
+	return nil, nil
+}
+
+func samePEM(certPEM []byte, cert *x509.Certificate) bool {
+	block, _ := pem.Decode(certPEM)
+	return block != nil && bytes.Equal(block.Bytes, cert.Raw)
+}
+
+// verifyPurpose checks the extended key usage of the certificate and that the CAs of the chain
+// don't restrict it.
+func verifyPurpose(cfg *config.Config, cert *x509.Certificate, opts VerifyOptions, usage x509.ExtKeyUsage, chain []*x509.Certificate, now time.Time) api.VerificationCheck {
+	check := api.VerificationCheck{Check: "purpose"}
+
+	if len(cert.ExtKeyUsage) > 0 && !hasUsage(cert.ExtKeyUsage, usage) {
+		check.Reasons = append(check.Reasons, fmt.Sprintf("certificate is not valid for %s", opts.Purpose))
+		return check
+	}
+	if chain == nil {
+		return check
+	}
+	if _, err := cert.Verify(chainOptions(cfg, cert, opts.Intermediates, now, usage)); err != nil {
+		check.Reasons = append(check.Reasons, fmt.Sprintf("a CA of the chain doesn't allow %s: %v", opts.Purpose, err))
+	}
+	return check
+}
+
+func hasUsage(usages []x509.ExtKeyUsage, usage x509.ExtKeyUsage) bool {
+	for _, u := range usages {
+		if u == usage || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyName checks that the certificate is valid for a DNS name, IP address or email address.
+func verifyName(cert *x509.Certificate, name string) api.VerificationCheck {
+	check := api.VerificationCheck{Check: "name"}
+
+	if strings.Contains(name, "@") && net.ParseIP(name) == nil {
+		for _, email := range cert.EmailAddresses {
+			if strings.EqualFold(email, name) {
+				return check
+			}
+		}
+		check.Reasons = append(check.Reasons, fmt.Sprintf("certificate is not valid for %s", name))
+		return check
+	}
+
+	if err := cert.VerifyHostname(name); err != nil {
+		check.Reasons = append(check.Reasons, err.Error())
+	}
+	return check
+}
@@ -0,0 +1,101 @@
+package certificate
+
+import (
+	"bufio"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"gcipher/internal/config"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+)
+
+// rocaPrimes are the small primes dividing the primorial used by the vulnerable Infineon
+// key generator. ROCA moduli are congruent to a power of 65537 modulo each of them.
+var rocaPrimes = []int64{
+	3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73, 79,
+	83, 89, 97, 101, 103, 107, 109, 113, 127, 131, 137, 139, 149, 151, 157, 163, 167,
+}
+
+var (
+	rocaOnce     sync.Once
+	rocaSubgroup []map[int64]bool
+)
+
+// isROCAVulnerable reports whether the modulus has the fingerprint of CVE-2017-15361.
+func isROCAVulnerable(n *big.Int) bool {
+	rocaOnce.Do(func() {
+		rocaSubgroup = make([]map[int64]bool, len(rocaPrimes))
+		for i, p := range rocaPrimes {
+			// The subgroup generated by 65537 modulo p
+			subgroup := map[int64]bool{}
+			for x := int64(1); !subgroup[x]; x = x * (65537 % p) % p {
+				subgroup[x] = true
+			}
+			rocaSubgroup[i] = subgroup
+		}
+	})
+
+	remainder := new(big.Int)
+	for i, p := range rocaPrimes {
+		remainder.Mod(n, big.NewInt(p))
+		if !rocaSubgroup[i][remainder.Int64()] {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	blacklistOnce sync.Once
+	blacklist     map[string]bool
+	blacklistErr  error
+)
+
+// isDebianWeakKey looks the modulus up in the blacklists of the openssl-blacklist package
+// configured with weak_key_blacklist_files. Without blacklists no key is considered weak.
+func isDebianWeakKey(cfg *config.Config, key *rsa.PublicKey) (bool, error) {
+	blacklistOnce.Do(func() {
+		blacklist, blacklistErr = loadBlacklists(cfg.WeakKeyBlacklistFiles)
+	})
+	if blacklistErr != nil {
+		return false, blacklistErr
+	}
+	if len(blacklist) == 0 {
+		return false, nil
+	}
+
+	// Entries are the last 20 hex digits of the SHA-1 of the modulus as printed by OpenSSL
+	sum := sha1.Sum([]byte(fmt.Sprintf("Modulus=%X\n", key.N)))
+	return blacklist[hex.EncodeToString(sum[:])[20:]], nil
+}
+
+func loadBlacklists(paths []string) (map[string]bool, error) {
+	entries := make(map[string]bool)
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open weak key blacklist: %v", err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries[line] = true
+		}
+		file.Close()
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read weak key blacklist: %v", err)
+		}
+	}
+
+	return entries, nil
+}
@@ -1,38 +1,132 @@
 package config
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/x509"
+	"encoding/asn1"
 	"fmt"
 	"gcipher/internal/util"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Port                       int    `yaml:"port"`
-	DatabaseURL                string `yaml:"database_url"`
-	CertificateLifetimeDefault int    `yaml:"certificate_lifetime_default"`
-	CACertPath                 string `yaml:"ca_cert_path"`
-	CAKeyPath                  string `yaml:"ca_key_path"`
-	CAKeyPassphrase            string `yaml:"ca_key_passphrase"`
-	IntermediateCertPath       string `yaml:"intermediate_cert_path"`
-	IntermediateKeyPath        string `yaml:"ca_key_path"`
-	IntermediateKeyPassphrase  string `yaml:"intermediate_key_passphrase"`
-	S3AccessKey                string `yaml:"s3_access_key"`
-	S3SecretKey                string `yaml:"s3_secret_key"`
-	S3Bucket                   string `yaml:"s3_bucket"`
-	S3Region                   string `yaml:"s3_region"`
-	CACertS3Key                string `yaml:"ca_cert_s3_key"`
-	CAKeyS3Key                 string `yaml:"ca_key_s3_key"`
-	IntermediateCertS3Key      string `yaml:"intermediate_cert_s3_key"`
-	IntermediateKeyS3Key       string `yaml:"intermediate_key_s3_key"`
+	Port                       int      `yaml:"port"`
+	DatabaseURL                string   `yaml:"database_url"`
+	CertificateLifetimeDefault int      `yaml:"certificate_lifetime_default"`
+	CACertPath                 string   `yaml:"ca_cert_path"`
+	CAKeyPath                  string   `yaml:"ca_key_path"`
+	CAKeyPassphrase            string   `yaml:"ca_key_passphrase"`
+	IntermediateCertPath       string   `yaml:"intermediate_cert_path"`
+	IntermediateKeyPath        string   `yaml:"intermediate_key_path"`
+	IntermediateKeyPassphrase  string   `yaml:"intermediate_key_passphrase"`
+	S3AccessKey                string   `yaml:"s3_access_key"`
+	S3SecretKey                string   `yaml:"s3_secret_key"`
+	S3Bucket                   string   `yaml:"s3_bucket"`
+	S3Region                   string   `yaml:"s3_region"`
+	CACertS3Key                string   `yaml:"ca_cert_s3_key"`
+	CAKeyS3Key                 string   `yaml:"ca_key_s3_key"`
+	IntermediateCertS3Key      string   `yaml:"intermediate_cert_s3_key"`
+	IntermediateKeyS3Key       string   `yaml:"intermediate_key_s3_key"`
+	KeygenAllowKeyPersistence  bool     `yaml:"keygen_allow_key_persistence"`
+	KeygenMinPasswordLength    int      `yaml:"keygen_min_password_length"`
+	GRPCPort                   int      `yaml:"grpc_port"`
+	GRPCTLSCertPath            string   `yaml:"grpc_tls_cert_path"`
+	GRPCTLSKeyPath             string   `yaml:"grpc_tls_key_path"`
+	LogLevel                   string   `yaml:"log_level"`
+	LogFormat                  string   `yaml:"log_format"`
+	LogOutput                  string   `yaml:"log_output"`
+	LogFilePath                string   `yaml:"log_file_path"`
+	LogFileMaxSize             int      `yaml:"log_file_max_size"`
+	LogFileMaxBackups          int      `yaml:"log_file_max_backups"`
+	KeyEscrowMode              string   `yaml:"key_escrow_mode"`
+	KeyEscrowKEKPath           string   `yaml:"key_escrow_kek_path"`
+	KeyEscrowPublicKey         string   `yaml:"key_escrow_public_key"`
+	KeyEscrowShamirThreshold   int      `yaml:"key_escrow_shamir_threshold"`
+	KeyEscrowRequiredApprovals int      `yaml:"key_escrow_required_approvals"`
+	KeyEscrowProfiles          []string `yaml:"key_escrow_profiles"`
+	CSRMinRSAKeySize           int      `yaml:"csr_min_rsa_key_size"`
+	WeakKeyBlacklistFiles      []string `yaml:"weak_key_blacklist_files"`
+	ApprovalProfiles           []string `yaml:"approval_profiles"`
+	ApprovalWildcards          bool     `yaml:"approval_wildcards"`
+	ApprovalLifetimeThreshold  int      `yaml:"approval_lifetime_threshold"`
+	ApprovalExpiry             int      `yaml:"approval_expiry"`
+	EnforceNameOwnership       bool     `yaml:"enforce_name_ownership"`
+	RateLimitIP                int      `yaml:"rate_limit_ip"`
+	RateLimitIPBurst           int      `yaml:"rate_limit_ip_burst"`
+	RateLimitUser              int      `yaml:"rate_limit_user"`
+	RateLimitUserBurst         int      `yaml:"rate_limit_user_burst"`
+	RateLimitToken             int      `yaml:"rate_limit_token"`
+	RateLimitTokenBurst        int      `yaml:"rate_limit_token_burst"`
+	TrustedProxies             []string `yaml:"trusted_proxies"`
+	QuotaCertificatesPerDay    int      `yaml:"quota_certificates_per_day"`
+	QuotaActiveCertificates    int      `yaml:"quota_active_certificates"`
+	PasswordMinLength          int      `yaml:"password_min_length"`
+	PasswordBreachedListFile   string   `yaml:"password_breached_list_file"`
+	LockoutThreshold           *int     `yaml:"lockout_threshold"` // Zero disables the lockout
+	LockoutDuration            int      `yaml:"lockout_duration"`
+	PKCS11Module               string   `yaml:"pkcs11_module"`
+	PKCS11TokenLabel           string   `yaml:"pkcs11_token_label"`
+	PKCS11Pin                  string   `yaml:"pkcs11_pin"`
+	CAKeyPKCS11Label           string   `yaml:"ca_key_pkcs11_label"`
+	IntermediateKeyPKCS11Label string   `yaml:"intermediate_key_pkcs11_label"`
+	CACrossCertPaths           []string `yaml:"ca_cross_cert_paths"`
+	KeyEscrowKEK               []byte
 	IntermediateCert           *x509.Certificate
 	IntermediateKey            interface{}
 	CACert                     *x509.Certificate
 	CAKey                      interface{}
+	CAGenerations              []CAGeneration
+	CACrossCerts               []*x509.Certificate
+	pkcs11                     *util.PKCS11Token
+
+	// CAGenerationConfigs are the generations of the signing CA besides ca_cert_path
+	CAGenerationConfigs []CAGenerationConfig `yaml:"ca_generations"`
+
+	// SSH CA, disabled unless a key is configured. Lifetimes are in hours.
+	SSHCAKeyPath        string `yaml:"ssh_ca_key_path"`
+	SSHCAKeyPassphrase  string `yaml:"ssh_ca_key_passphrase"`
+	SSHCAKeyPKCS11Label string `yaml:"ssh_ca_key_pkcs11_label"`
+	SSHUserLifetimeMax  int    `yaml:"ssh_user_lifetime_max"`
+	SSHHostLifetimeMax  int    `yaml:"ssh_host_lifetime_max"`
+	SSHCAKey            crypto.Signer
+
+	// Timestamping authority, disabled unless a certificate is configured. Accuracy is in seconds.
+	TSACertPath       string `yaml:"tsa_cert_path"`
+	TSAKeyPath        string `yaml:"tsa_key_path"`
+	TSAKeyPassphrase  string `yaml:"tsa_key_passphrase"`
+	TSAKeyPKCS11Label string `yaml:"tsa_key_pkcs11_label"`
+	TSAPolicy         string `yaml:"tsa_policy"`
+	TSAAccuracy       int    `yaml:"tsa_accuracy"`
+	TSACert           *x509.Certificate
+	TSAKey            crypto.Signer
+	TSAPolicyID       asn1.ObjectIdentifier
+}
+
+// CAGenerationConfig is an additional generation of the signing CA
+type CAGenerationConfig struct {
+	CertPath       string `yaml:"cert_path"`
+	KeyPath        string `yaml:"key_path"`
+	KeyPassphrase  string `yaml:"key_passphrase"`
+	KeyPKCS11Label string `yaml:"key_pkcs11_label"`
+}
+
+// CAGeneration is a certificate and key of the signing CA. During a rollover several
+// generations are active, the newest valid one signs and the older ones keep publishing CRLs.
+type CAGeneration struct {
+	Cert *x509.Certificate
+	Key  interface{}
 }
 
 // Default values
@@ -42,19 +136,61 @@ const (
 	DefaultCACertPath                 = "ca.crt"
 	DefaultCAKeyPath                  = "ca.key"
 	DefaultDatabaseURL                = "mongodb://localhost:27017"
+	DefaultKeygenMinPasswordLength    = 12
+	DefaultLogLevel                   = "info"
+	DefaultLogFormat                  = "text"
+	DefaultLogOutput                  = "stdout"
+	DefaultLogFilePath                = "gcipher.log"
+	DefaultLogFileMaxSize             = 100 // Megabytes
+	DefaultLogFileMaxBackups          = 5
+	DefaultKeyEscrowRequiredApprovals = 2
+	DefaultCSRMinRSAKeySize           = 2048
+	DefaultApprovalExpiry             = 72 // Hours
+	DefaultPasswordMinLength          = 12
+	DefaultLockoutThreshold           = 5
+	DefaultLockoutDuration            = 15 // Minutes
+	DefaultSSHUserLifetimeMax         = 16 // Hours
+	DefaultSSHHostLifetimeMax         = 24 * 30
+	DefaultTSAAccuracy                = 1 // Seconds
 )
 
 var (
 	configOnce sync.Once
 	cfg        *Config
+
+	settingsOnce sync.Once
+	settings     *Config
+	settingsErr  error
 )
 
 func NewConfig() (*Config, error) {
+	cfg, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.loadCAs(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.loadSSHCA(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.loadTSA(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// readConfig reads the config file and the environment overrides without loading the CAs.
+func readConfig() (*Config, error) {
 	var cfg Config
 
-	configFile, err := findConfigFile()
+	configFile, err := FindConfigFile()
 	if err != nil {
-		fmt.Println("No config file found, using defaults...")
+		slog.Info("No config file found, using defaults")
 
 		cfg.Port = DefaultPort
 		cfg.CertificateLifetimeDefault = DefaultCertificateLifetimeDefault
@@ -91,6 +227,129 @@ func NewConfig() (*Config, error) {
 		}
 	}
 
+	if cfg.KeygenMinPasswordLength == 0 {
+		cfg.KeygenMinPasswordLength = DefaultKeygenMinPasswordLength
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = DefaultLogLevel
+	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = DefaultLogFormat
+	}
+	if cfg.LogOutput == "" {
+		cfg.LogOutput = DefaultLogOutput
+	}
+	if cfg.LogFilePath == "" {
+		cfg.LogFilePath = DefaultLogFilePath
+	}
+	if cfg.LogFileMaxSize == 0 {
+		cfg.LogFileMaxSize = DefaultLogFileMaxSize
+	}
+	if cfg.LogFileMaxBackups == 0 {
+		cfg.LogFileMaxBackups = DefaultLogFileMaxBackups
+	}
+
+	if cfg.CSRMinRSAKeySize == 0 {
+		cfg.CSRMinRSAKeySize = DefaultCSRMinRSAKeySize
+	}
+	if cfg.ApprovalExpiry == 0 {
+		cfg.ApprovalExpiry = DefaultApprovalExpiry
+	}
+	if cfg.KeyEscrowRequiredApprovals == 0 {
+		cfg.KeyEscrowRequiredApprovals = DefaultKeyEscrowRequiredApprovals
+		// Shamir recoveries need as many approvals as shares are required to rebuild the key
+		if cfg.KeyEscrowMode == "shamir" && cfg.KeyEscrowShamirThreshold > 0 {
+			cfg.KeyEscrowRequiredApprovals = cfg.KeyEscrowShamirThreshold
+		}
+	}
+	if cfg.PasswordMinLength == 0 {
+		cfg.PasswordMinLength = DefaultPasswordMinLength
+	}
+	if cfg.LockoutThreshold == nil {
+		threshold := DefaultLockoutThreshold
+		cfg.LockoutThreshold = &threshold
+	}
+	if cfg.LockoutDuration == 0 {
+		cfg.LockoutDuration = DefaultLockoutDuration
+	}
+	if cfg.SSHUserLifetimeMax == 0 {
+		cfg.SSHUserLifetimeMax = DefaultSSHUserLifetimeMax
+	}
+	if cfg.SSHHostLifetimeMax == 0 {
+		cfg.SSHHostLifetimeMax = DefaultSSHHostLifetimeMax
+	}
+	if cfg.TSAAccuracy == 0 {
+		cfg.TSAAccuracy = DefaultTSAAccuracy
+	}
+
+	if grpcPortStr := os.Getenv("GCIPHER_GRPC_PORT"); grpcPortStr != "" {
+		cfg.GRPCPort, err = strconv.Atoi(grpcPortStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GCIPHER_GRPC_PORT value: %s", grpcPortStr)
+		}
+	}
+
+	if logLevel := os.Getenv("GCIPHER_LOG_LEVEL"); logLevel != "" {
+		cfg.LogLevel = logLevel
+	}
+
+	if logFormat := os.Getenv("GCIPHER_LOG_FORMAT"); logFormat != "" {
+		cfg.LogFormat = logFormat
+	}
+
+	if logOutput := os.Getenv("GCIPHER_LOG_OUTPUT"); logOutput != "" {
+		cfg.LogOutput = logOutput
+	}
+
+	if logFilePath := os.Getenv("GCIPHER_LOG_FILE_PATH"); logFilePath != "" {
+		cfg.LogFilePath = logFilePath
+	}
+
+	if pin := os.Getenv("GCIPHER_PKCS11_PIN"); pin != "" {
+		cfg.PKCS11Pin = pin
+	}
+
+	if cfg.CACertPath == "" {
+		cfg.CACertPath = DefaultCACertPath
+	}
+	if cfg.CAKeyPath == "" {
+		cfg.CAKeyPath = DefaultCAKeyPath
+	}
+	if caCertPath := os.Getenv("GCIPHER_CA_CERT_PATH"); caCertPath != "" {
+		cfg.CACertPath = caCertPath
+	}
+	if caKeyPath := os.Getenv("GCIPHER_CA_KEY_PATH"); caKeyPath != "" {
+		cfg.CAKeyPath = caKeyPath
+	}
+
+	switch cfg.KeyEscrowMode {
+	case "":
+	case "kek":
+		kek, err := util.ParseSymmetricKey(cfg.KeyEscrowKEKPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key escrow KEK: %v", err)
+		}
+		cfg.KeyEscrowKEK = kek
+	case "shamir":
+		if cfg.KeyEscrowPublicKey == "" {
+			return nil, fmt.Errorf("key_escrow_public_key is required for shamir key escrow")
+		}
+		if cfg.KeyEscrowShamirThreshold < 2 {
+			return nil, fmt.Errorf("key_escrow_shamir_threshold of at least 2 is required for shamir key escrow")
+		}
+		if cfg.KeyEscrowRequiredApprovals < cfg.KeyEscrowShamirThreshold {
+			return nil, fmt.Errorf("key_escrow_required_approvals (%d) is lower than key_escrow_shamir_threshold (%d), recoveries could never complete",
+				cfg.KeyEscrowRequiredApprovals, cfg.KeyEscrowShamirThreshold)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key_escrow_mode: %s", cfg.KeyEscrowMode)
+	}
+
+	return &cfg, nil
+}
+
+// loadCAs loads the CA and intermediate certificates and keys from S3, files or a PKCS#11 token.
+func (cfg *Config) loadCAs() error {
 	if cfg.S3AccessKey != "" &&
 		cfg.S3SecretKey != "" &&
 		cfg.S3Bucket != "" &&
@@ -99,48 +358,44 @@ func NewConfig() (*Config, error) {
 		cfg.CAKeyS3Key != "" {
 		caCertBytes, err := util.LoadKeyFromS3(cfg.S3Bucket, cfg.CACertS3Key, cfg.S3Region)
 		if err != nil {
-			fmt.Println("Failed to load CA certificate from S3:", err)
-			os.Exit(1)
+			return fmt.Errorf("failed to load CA certificate from S3: %v", err)
 		}
 
 		caKeyBytes, err := util.LoadKeyFromS3(cfg.S3Bucket, cfg.CAKeyS3Key, cfg.S3Region)
 		if err != nil {
-			fmt.Println("Failed to load CA key from S3:", err)
-			os.Exit(1)
+			return fmt.Errorf("failed to load CA key from S3: %v", err)
 		}
 
 		cert, err := util.ParseCertificateFromBytes(caCertBytes)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+			return fmt.Errorf("failed to parse CA certificate: %v", err)
 		}
 		cfg.CACert = cert
 
 		key, err := util.ParseKeyFromBytes(caKeyBytes, []byte(cfg.CAKeyPassphrase))
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse CA key: %v", err)
+			return fmt.Errorf("failed to parse CA key: %v", err)
 		}
 		cfg.CAKey = key
 	} else {
-		if caCertPath := os.Getenv("GCIPHER_CA_CERT_PATH"); caCertPath != "" {
-			cfg.CACertPath = caCertPath
-			cert, err := util.ParseCertificate(caCertPath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
-			}
-			cfg.CACert = cert
-		} else {
-			return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+		cert, err := util.ParseCertificate(cfg.CACertPath)
+		if err != nil {
+			return fmt.Errorf("failed to parse CA certificate: %v", err)
 		}
+		cfg.CACert = cert
 
-		if caKeyPath := os.Getenv("GCIPHER_CA_KEY_PATH"); caKeyPath != "" {
-			cfg.CAKeyPath = caKeyPath
-			key, err := util.ParseKey(caKeyPath, []byte(cfg.CAKeyPassphrase))
+		if cfg.CAKeyPKCS11Label != "" {
+			key, err := cfg.pkcs11Key(cfg.CAKeyPKCS11Label)
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse CA private key: %v", err)
+				return fmt.Errorf("failed to load CA private key: %v", err)
 			}
 			cfg.CAKey = key
 		} else {
-			return nil, fmt.Errorf("failed to parse CA private key: %v", err)
+			key, err := util.ParseKey(cfg.CAKeyPath, []byte(cfg.CAKeyPassphrase))
+			if err != nil {
+				return fmt.Errorf("failed to parse CA private key: %v", err)
+			}
+			cfg.CAKey = key
 		}
 	}
 
@@ -152,50 +407,279 @@ func NewConfig() (*Config, error) {
 		cfg.IntermediateKeyS3Key != "" {
 		intermediateCertBytes, err := util.LoadKeyFromS3(cfg.S3Bucket, cfg.IntermediateCertS3Key, cfg.S3Region)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load intermediate certificate from S3: %v", err)
+			return fmt.Errorf("failed to load intermediate certificate from S3: %v", err)
 		}
 
 		intermediateKeyBytes, err := util.LoadKeyFromS3(cfg.S3Bucket, cfg.IntermediateKeyS3Key, cfg.S3Region)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load intermediate key from S3: %v", err)
+			return fmt.Errorf("failed to load intermediate key from S3: %v", err)
 		}
 
 		intermediateCert, err := util.ParseCertificateFromBytes(intermediateCertBytes)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse intermediate certificate: %v", err)
+			return fmt.Errorf("failed to parse intermediate certificate: %v", err)
 		}
 		cfg.IntermediateCert = intermediateCert
 
 		intermediateKey, err := util.ParseKeyFromBytes(intermediateKeyBytes, []byte(cfg.IntermediateKeyPassphrase))
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse intermediate key: %v", err)
+			return fmt.Errorf("failed to parse intermediate key: %v", err)
 		}
 		cfg.IntermediateKey = intermediateKey
-	} else if cfg.IntermediateCertPath != "" && cfg.IntermediateKeyPath != "" {
-		intermediateCertBytes, err := os.ReadFile(cfg.IntermediateCertPath)
+	} else if cfg.IntermediateCertPath != "" && (cfg.IntermediateKeyPath != "" || cfg.IntermediateKeyPKCS11Label != "") {
+		intermediateCert, err := util.ParseCertificate(cfg.IntermediateCertPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read intermediate certificate file: %v", err)
+			return fmt.Errorf("failed to parse intermediate certificate: %v", err)
 		}
+		cfg.IntermediateCert = intermediateCert
+
+		if cfg.IntermediateKeyPKCS11Label != "" {
+			intermediateKey, err := cfg.pkcs11Key(cfg.IntermediateKeyPKCS11Label)
+			if err != nil {
+				return fmt.Errorf("failed to load intermediate key: %v", err)
+			}
+			cfg.IntermediateKey = intermediateKey
+		} else {
+			intermediateKey, err := util.ParseKey(cfg.IntermediateKeyPath, []byte(cfg.IntermediateKeyPassphrase))
+			if err != nil {
+				return fmt.Errorf("failed to parse intermediate key: %v", err)
+			}
+			cfg.IntermediateKey = intermediateKey
+		}
+	}
 
-		intermediateKeyBytes, err := os.ReadFile(cfg.IntermediateKeyPath)
+	return cfg.loadGenerations()
+}
+
+// loadGenerations loads the additional CA generations and the cross-signed certificates, and
+// makes the newest valid generation the signing CA. A generation whose validity starts later
+// is only used after a restart.
+func (cfg *Config) loadGenerations() error {
+	cfg.CAGenerations = []CAGeneration{{Cert: cfg.CACert, Key: cfg.CAKey}}
+
+	for _, generation := range cfg.CAGenerationConfigs {
+		cert, err := util.ParseCertificate(generation.CertPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read intermediate key file: %v", err)
+			return fmt.Errorf("failed to parse CA generation %s: %v", generation.CertPath, err)
+		}
+		if cert.Equal(cfg.CACert) {
+			continue
 		}
 
-		intermediateCert, err := util.ParseCertificateFromBytes(intermediateCertBytes)
+		var key interface{}
+		if generation.KeyPKCS11Label != "" {
+			key, err = cfg.pkcs11Key(generation.KeyPKCS11Label)
+		} else {
+			key, err = util.ParseKey(generation.KeyPath, []byte(generation.KeyPassphrase))
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse intermediate certificate: %v", err)
+			return fmt.Errorf("failed to load key of CA generation %s: %v", generation.CertPath, err)
 		}
-		cfg.IntermediateCert = intermediateCert
 
-		intermediateKey, err := util.ParseKeyFromBytes(intermediateKeyBytes, []byte(cfg.IntermediateKeyPassphrase))
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("key of CA generation %s cannot sign", generation.CertPath)
+		}
+		if publicKey, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !publicKey.Equal(cert.PublicKey) {
+			return fmt.Errorf("key of CA generation %s doesn't match its certificate", generation.CertPath)
+		}
+
+		cfg.CAGenerations = append(cfg.CAGenerations, CAGeneration{Cert: cert, Key: key})
+	}
+
+	now := time.Now()
+	current := cfg.CAGenerations[0]
+	for _, generation := range cfg.CAGenerations[1:] {
+		if !generation.valid(now) {
+			continue
+		}
+		if !current.valid(now) || generation.Cert.NotBefore.After(current.Cert.NotBefore) {
+			current = generation
+		}
+	}
+	cfg.CACert, cfg.CAKey = current.Cert, current.Key
+
+	for _, path := range cfg.CACrossCertPaths {
+		cert, err := util.ParseCertificate(path)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse intermediate key: %v", err)
+			return fmt.Errorf("failed to parse cross-signed certificate %s: %v", path, err)
 		}
-		cfg.IntermediateKey = intermediateKey
+		cfg.CACrossCerts = append(cfg.CACrossCerts, cert)
 	}
 
-	return &cfg, nil
+	return nil
+}
+
+// loadSSHCA loads the key of the SSH CA from a PKCS#11 token or a file in OpenSSH, PKCS#1,
+// PKCS#8 or SEC 1 format. Without a configured key the SSH CA is disabled.
+func (cfg *Config) loadSSHCA() error {
+	if cfg.SSHCAKeyPKCS11Label != "" {
+		key, err := cfg.pkcs11Key(cfg.SSHCAKeyPKCS11Label)
+		if err != nil {
+			return fmt.Errorf("failed to load SSH CA key: %v", err)
+		}
+		cfg.SSHCAKey = key
+		return nil
+	}
+	if cfg.SSHCAKeyPath == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(cfg.SSHCAKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH CA key: %v", err)
+	}
+
+	var key interface{}
+	if cfg.SSHCAKeyPassphrase != "" {
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(content, []byte(cfg.SSHCAKeyPassphrase))
+	} else {
+		key, err = ssh.ParseRawPrivateKey(content)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse SSH CA key: %v", err)
+	}
+
+	// ed25519 keys are parsed as pointers by the ssh package
+	if edKey, ok := key.(*ed25519.PrivateKey); ok {
+		key = *edKey
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("SSH CA key of type %T cannot sign", key)
+	}
+	cfg.SSHCAKey = signer
+	return nil
+}
+
+// loadTSA loads the timestamping certificate and key. The certificate must have the
+// timeStamping extended key usage and a policy OID has to be configured.
+func (cfg *Config) loadTSA() error {
+	if cfg.TSACertPath == "" {
+		return nil
+	}
+
+	cert, err := util.ParseCertificate(cfg.TSACertPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse TSA certificate: %v", err)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping {
+		return fmt.Errorf("TSA certificate must have the timeStamping extended key usage only")
+	}
+	if !util.HasCriticalExtKeyUsage(cert) {
+		return fmt.Errorf("TSA certificate must mark the extended key usage extension critical")
+	}
+
+	var key interface{}
+	if cfg.TSAKeyPKCS11Label != "" {
+		key, err = cfg.pkcs11Key(cfg.TSAKeyPKCS11Label)
+	} else {
+		key, err = util.ParseKey(cfg.TSAKeyPath, []byte(cfg.TSAKeyPassphrase))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load TSA key: %v", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("TSA key cannot sign")
+	}
+	switch signer.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return fmt.Errorf("TSA key must be an RSA or ECDSA key")
+	}
+	if publicKey, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !publicKey.Equal(cert.PublicKey) {
+		return fmt.Errorf("TSA key doesn't match the TSA certificate")
+	}
+
+	if cfg.TSAPolicyID, err = parseOID(cfg.TSAPolicy); err != nil {
+		return fmt.Errorf("invalid tsa_policy %q: %v", cfg.TSAPolicy, err)
+	}
+
+	cfg.TSACert, cfg.TSAKey = cert, signer
+	return nil
+}
+
+// parseOID parses an object identifier in dotted notation.
+func parseOID(value string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("expected a dotted object identifier")
+	}
+
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.Atoi(part)
+		if err != nil || arc < 0 {
+			return nil, fmt.Errorf("invalid arc %q", part)
+		}
+		oid[i] = arc
+	}
+	return oid, nil
+}
+
+func (generation CAGeneration) valid(now time.Time) bool {
+	return !now.Before(generation.Cert.NotBefore) && now.Before(generation.Cert.NotAfter)
+}
+
+// PKCS11 returns the session with the configured PKCS#11 token, opening it on first use.
+func (cfg *Config) PKCS11() (*util.PKCS11Token, error) {
+	if cfg.pkcs11 == nil {
+		ctx, err := util.OpenPKCS11(cfg.PKCS11Module, cfg.PKCS11TokenLabel, cfg.PKCS11Pin)
+		if err != nil {
+			return nil, err
+		}
+		cfg.pkcs11 = ctx
+	}
+	return cfg.pkcs11, nil
+}
+
+func (cfg *Config) pkcs11Key(label string) (crypto.Signer, error) {
+	token, err := cfg.PKCS11()
+	if err != nil {
+		return nil, err
+	}
+	return util.FindPKCS11Key(token, label)
+}
+
+// CAChain returns the CA certificates to hand out together with issued certificates. The
+// cross-signed certificates let clients that only trust another generation build a path.
+func (cfg *Config) CAChain() []*x509.Certificate {
+	chain := []*x509.Certificate{cfg.CACert}
+	if cfg.IntermediateCert != nil && !cfg.IntermediateCert.Equal(cfg.CACert) {
+		chain = append(chain, cfg.IntermediateCert)
+	}
+	return append(chain, cfg.CACrossCerts...)
+}
+
+// TrustAnchors returns the configured CA certificates of all generations as roots and
+// intermediates, see TrustPools.
+func (cfg *Config) TrustAnchors() (roots, intermediates *x509.CertPool) {
+	var cas []*x509.Certificate
+	for _, generation := range cfg.CAGenerations {
+		cas = append(cas, generation.Cert)
+	}
+	return TrustPools(append(cas, cfg.CAChain()...))
+}
+
+// TrustPools sorts CA certificates into roots and intermediates. Self-signed certificates are
+// roots, if there is none chains end at the given CAs.
+func TrustPools(cas []*x509.Certificate) (roots, intermediates *x509.CertPool) {
+	roots, intermediates = x509.NewCertPool(), x509.NewCertPool()
+	hasRoot := false
+	for _, ca := range cas {
+		if bytes.Equal(ca.RawSubject, ca.RawIssuer) && ca.CheckSignatureFrom(ca) == nil {
+			roots.AddCert(ca)
+			hasRoot = true
+		} else {
+			intermediates.AddCert(ca)
+		}
+	}
+	if !hasRoot {
+		return intermediates, x509.NewCertPool()
+	}
+	return roots, intermediates
 }
 
 func GetConfig() (*Config, error) {
@@ -211,7 +695,17 @@ func GetConfig() (*Config, error) {
 	return cfg, nil
 }
 
-func findConfigFile() (string, error) {
+// GetConfigWithoutCA returns the config without loading the CA certificates and keys, for the
+// database connection and commands like cactl that run before the CA exists.
+func GetConfigWithoutCA() (*Config, error) {
+	settingsOnce.Do(func() {
+		settings, settingsErr = readConfig()
+	})
+	return settings, settingsErr
+}
+
+// FindConfigFile returns the path of the config file in the working directory.
+func FindConfigFile() (string, error) {
 	for _, filename := range []string{"config.yml", "config.yaml"} {
 		if _, err := os.Stat(filename); err == nil {
 			return filename, nil
@@ -3,8 +3,10 @@ package db
 import (
 	"context"
 	"gcipher/internal/config"
+	"gcipher/internal/metrics"
 	"sync"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -16,13 +18,13 @@ var (
 
 func GetDBClient() (*mongo.Client, error) {
 	var err error
-	cfg, err := config.GetConfig()
+	cfg, err := config.GetConfigWithoutCA()
 	if err != nil {
 		return nil, err
 	}
 
 	clientOnce.Do(func() {
-		clientOptions := options.Client().ApplyURI(cfg.DatabaseURL)
+		clientOptions := options.Client().ApplyURI(cfg.DatabaseURL).SetMonitor(commandMonitor())
 		client, err = mongo.Connect(context.Background(), clientOptions)
 		if err != nil {
 			panic(err)
@@ -30,3 +32,15 @@ func GetDBClient() (*mongo.Client, error) {
 	})
 	return client, err
 }
+
+// commandMonitor reports the latency of every MongoDB command to the metrics registry.
+func commandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			metrics.DBCommandDuration.WithLabelValues(e.CommandName, "success").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			metrics.DBCommandDuration.WithLabelValues(e.CommandName, "failure").Observe(e.Duration.Seconds())
+		},
+	}
+}
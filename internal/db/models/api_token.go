@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIToken is a bearer token used by services to authenticate as a user.
+// Only the SHA-256 hash of the token is stored.
+type APIToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Name      string             `bson:"name"`
+	Username  string             `bson:"username"`
+	TokenHash string             `bson:"token_hash"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// Create a new API token instance
+func NewAPIToken(name, username, tokenHash string) *APIToken {
+	return &APIToken{
+		Name:      name,
+		Username:  username,
+		TokenHash: tokenHash,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// AuditEvent is an entry in the audit trail of a request that needs approval
+type AuditEvent struct {
+	Action   string    `bson:"action"`
+	Username string    `bson:"username"`
+	Comment  string    `bson:"comment,omitempty"`
+	Time     time.Time `bson:"time"`
+}
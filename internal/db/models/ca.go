@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// CA types
+const (
+	CATypeRoot         = "root"
+	CATypeIntermediate = "intermediate"
+	// CATypeCrossSigned is a certificate for the key of another CA signed by a different issuer
+	CATypeCrossSigned = "cross-signed"
+)
+
+// Storage of CA keys
+const (
+	KeyStorageFile   = "file"
+	KeyStoragePKCS11 = "pkcs11"
+)
+
+// CA is a certificate authority created with cactl. The name constraints are part of the
+// certificate and aren't stored separately.
+type CA struct {
+	SerialNumber string `bson:"serial_number"`
+	Type         string `bson:"type"`
+	Subject      string `bson:"subject"`
+	// SubjectKeyID is the hex encoded subject key identifier, shared by the CA certificate and
+	// its cross-signed certificates
+	SubjectKeyID string `bson:"subject_key_id"`
+	// Generation counts the rollovers of the CA, starting at 1. Cross-signed certificates
+	// have the generation of the CA they were issued for.
+	Generation int `bson:"generation"`
+	// IssuerSerialNumber is the serial number of the issuing CA, roots don't have one
+	IssuerSerialNumber string `bson:"issuer_serial_number,omitempty"`
+	CertificatePEM     []byte `bson:"certificate_pem"`
+	KeyStorage         string `bson:"key_storage"`
+	// KeyReference is the path of the key file or the label of the key on the PKCS#11 token
+	KeyReference string `bson:"key_reference"`
+	// MaxPathLen is the path length constraint, -1 if there is none
+	MaxPathLen int       `bson:"max_path_len"`
+	NotBefore  time.Time `bson:"not_before"`
+	NotAfter   time.Time `bson:"not_after"`
+	CreatedAt  time.Time `bson:"created_at"`
+	// RevokedAt is set once the CA is revoked, its issuer lists it on the next CRL
+	RevokedAt *time.Time `bson:"revoked_at,omitempty"`
+	// RevocationReason is the RFC 5280 CRLReason code
+	RevocationReason int `bson:"revocation_reason,omitempty"`
+}
@@ -6,7 +6,17 @@ type Certificate struct {
 	SerialNumber   string     `bson:"serial_number"`
 	CertificatePEM []byte     `bson:"certificate_pem"`
 	Username       string     `bson:"username"`
+	IssuedAt       time.Time  `bson:"issued_at,omitempty"`
+	NotAfter       time.Time  `bson:"not_after,omitempty"`
 	RevokedAt      *time.Time `bson:"revoked_at,omitempty"`
+	// RevocationReason is the RFC 5280 CRLReason code, 0 (unspecified) is left out of the CRL
+	RevocationReason int `bson:"revocation_reason,omitempty"`
+	// InvalidityDate is the date the key is known or suspected to have been compromised,
+	// published as invalidity date CRL entry extension
+	InvalidityDate *time.Time `bson:"invalidity_date,omitempty"`
+	PKCS12         []byte     `bson:"pkcs12,omitempty"`
+	// IssuerKeyID is the subject key ID of the CA generation that signed the certificate
+	IssuerKeyID string `bson:"issuer_key_id,omitempty"`
 }
 
 // Create a new certificate instance
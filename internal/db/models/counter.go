@@ -0,0 +1,7 @@
+package models
+
+// Counter is a named, monotonically increasing sequence
+type Counter struct {
+	Name  string `bson:"_id"`
+	Value int64  `bson:"value"`
+}
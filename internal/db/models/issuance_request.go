@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Issuance request states
+const (
+	IssuancePending  = "pending"
+	IssuanceApproved = "approved"
+	IssuanceRejected = "rejected"
+	IssuanceExpired  = "expired"
+	IssuanceFailed   = "failed"
+)
+
+// IssuanceRequest is a certificate request held back until an operator approves it
+type IssuanceRequest struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Username     string             `bson:"username"`
+	Applicant    string             `bson:"applicant,omitempty"`
+	CSR          string             `bson:"csr"`
+	Lifetime     int                `bson:"lifetime"`
+	Type         string             `bson:"type"`
+	Reasons      []string           `bson:"reasons"`
+	Status       string             `bson:"status"`
+	SerialNumber string             `bson:"serial_number,omitempty"`
+	Events       []AuditEvent       `bson:"events"`
+	CreatedAt    time.Time          `bson:"created_at"`
+	ExpiresAt    time.Time          `bson:"expires_at"`
+	// MaxPathLen and NameConstraints are the constraints requested for a subordinate CA
+	MaxPathLen      *int             `bson:"max_path_len,omitempty"`
+	NameConstraints *NameConstraints `bson:"name_constraints,omitempty"`
+}
+
+// NameConstraints are the name constraints of a subordinate CA, IP ranges in CIDR notation
+type NameConstraints struct {
+	PermittedDNSDomains     []string `bson:"permitted_dns_domains,omitempty"`
+	ExcludedDNSDomains      []string `bson:"excluded_dns_domains,omitempty"`
+	PermittedIPRanges       []string `bson:"permitted_ip_ranges,omitempty"`
+	ExcludedIPRanges        []string `bson:"excluded_ip_ranges,omitempty"`
+	PermittedEmailAddresses []string `bson:"permitted_email_addresses,omitempty"`
+	ExcludedEmailAddresses  []string `bson:"excluded_email_addresses,omitempty"`
+}
+
+// Create a new issuance request instance
+func NewIssuanceRequest(username, applicant, csr string, lifetime int, certType string, reasons []string, ttl time.Duration) *IssuanceRequest {
+	now := time.Now()
+	return &IssuanceRequest{
+		ID:        primitive.NewObjectID(),
+		Username:  username,
+		Applicant: applicant,
+		CSR:       csr,
+		Lifetime:  lifetime,
+		Type:      certType,
+		Reasons:   reasons,
+		Status:    IssuancePending,
+		Events:    []AuditEvent{{Action: "submitted", Username: username, Time: now}},
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+// AddEvent appends an entry to the audit trail
+func (r *IssuanceRequest) AddEvent(action, username, comment string) {
+	r.Events = append(r.Events, AuditEvent{Action: action, Username: username, Comment: comment, Time: time.Now()})
+}
+
+// IsExpired reports whether a pending request is past its expiry
+func (r *IssuanceRequest) IsExpired() bool {
+	return r.Status == IssuancePending && time.Now().After(r.ExpiresAt)
+}
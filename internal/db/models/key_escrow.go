@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Key escrow modes
+const (
+	EscrowModeKEK    = "kek"
+	EscrowModeShamir = "shamir"
+)
+
+// EscrowedKey is the private key of a server-side generated certificate, encrypted under
+// the configured key encryption key or sealed to the escrow public key.
+type EscrowedKey struct {
+	SerialNumber string    `bson:"serial_number"`
+	Username     string    `bson:"username"`
+	Mode         string    `bson:"mode"`
+	EncryptedKey []byte    `bson:"encrypted_key"`
+	CreatedAt    time.Time `bson:"created_at"`
+}
+
+// Create a new escrowed key instance
+func NewEscrowedKey(serialNumber, username, mode string, encryptedKey []byte) *EscrowedKey {
+	return &EscrowedKey{
+		SerialNumber: serialNumber,
+		Username:     username,
+		Mode:         mode,
+		EncryptedKey: encryptedKey,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Key recovery states
+const (
+	RecoveryPending   = "pending"
+	RecoveryApproved  = "approved"
+	RecoveryRejected  = "rejected"
+	RecoveryCompleted = "completed"
+)
+
+// KeyRecovery is a request to recover an escrowed key. It needs the approval of several
+// admins before the key is released to the requester.
+type KeyRecovery struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	SerialNumber string             `bson:"serial_number"`
+	Requester    string             `bson:"requester"`
+	Reason       string             `bson:"reason"`
+	Status       string             `bson:"status"`
+	Approvals    []KeyApproval      `bson:"approvals"`
+	Events       []AuditEvent       `bson:"events"`
+	// Per-request keypair the approvers' shares are sealed to, its private key is
+	// encrypted with a key derived from the requester's password
+	PublicKey           []byte    `bson:"public_key,omitempty"`
+	EncryptedPrivateKey []byte    `bson:"encrypted_private_key,omitempty"`
+	Salt                []byte    `bson:"salt,omitempty"`
+	CreatedAt           time.Time `bson:"created_at"`
+}
+
+// KeyApproval records an admin's approval of a key recovery
+type KeyApproval struct {
+	Username    string    `bson:"username"`
+	SealedShare []byte    `bson:"sealed_share,omitempty"`
+	ApprovedAt  time.Time `bson:"approved_at"`
+}
+
+// Create a new key recovery instance
+func NewKeyRecovery(serialNumber, requester, reason string) *KeyRecovery {
+	now := time.Now()
+	return &KeyRecovery{
+		ID:           primitive.NewObjectID(),
+		SerialNumber: serialNumber,
+		Requester:    requester,
+		Reason:       reason,
+		Status:       RecoveryPending,
+		Approvals:    []KeyApproval{},
+		Events:       []AuditEvent{{Action: "requested", Username: requester, Comment: reason, Time: now}},
+		CreatedAt:    now,
+	}
+}
+
+// AddEvent appends an entry to the audit trail
+func (r *KeyRecovery) AddEvent(action, username, comment string) {
+	r.Events = append(r.Events, AuditEvent{Action: action, Username: username, Comment: comment, Time: time.Now()})
+}
+
+// HasApproved reports whether the user already approved the recovery
+func (r *KeyRecovery) HasApproved(username string) bool {
+	for _, approval := range r.Approvals {
+		if approval.Username == username {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package models
+
+// Name rule types
+const (
+	NameRuleDNS   = "dns"
+	NameRuleIP    = "ip"
+	NameRuleEmail = "email"
+)
+
+// NameRule grants the right to issue certificates for names. DNS patterns are exact names or
+// wildcard suffixes ("*.example.com"), IP patterns are addresses or CIDRs and email patterns
+// are addresses or domains.
+type NameRule struct {
+	Type    string `bson:"type"`
+	Pattern string `bson:"pattern"`
+}
+
+// Group bundles name rules shared by all of its members
+type Group struct {
+	Name      string     `bson:"name"`
+	NameRules []NameRule `bson:"name_rules"`
+}
+
+// Create a new group instance
+func NewGroup(name string) *Group {
+	return &Group{
+		Name:      name,
+		NameRules: []NameRule{},
+	}
+}
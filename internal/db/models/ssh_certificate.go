@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// SSH certificate types
+const (
+	SSHCertificateUser = "user"
+	SSHCertificateHost = "host"
+)
+
+// SSHCertificate is an OpenSSH certificate signed by the SSH CA
+type SSHCertificate struct {
+	SerialNumber uint64   `bson:"serial_number"`
+	Type         string   `bson:"type"`
+	KeyID        string   `bson:"key_id"`
+	Principals   []string `bson:"principals"`
+	// Certificate and CAPublicKey are in authorized_keys format
+	Certificate          string     `bson:"certificate"`
+	CAPublicKey          string     `bson:"ca_public_key"`
+	PublicKeyFingerprint string     `bson:"public_key_fingerprint"`
+	Username             string     `bson:"username"`
+	IssuedAt             time.Time  `bson:"issued_at"`
+	ValidAfter           time.Time  `bson:"valid_after"`
+	ValidBefore          time.Time  `bson:"valid_before"`
+	RevokedAt            *time.Time `bson:"revoked_at,omitempty"`
+}
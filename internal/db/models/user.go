@@ -1,8 +1,23 @@
 package models
 
+import "time"
+
+// Roles a user can have
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	Username string `bson:"username"`
-	Password string `bson:"password"`
+	Username  string     `bson:"username"`
+	Password  string     `bson:"password"`
+	Role      string     `bson:"role,omitempty"`
+	Disabled  bool       `bson:"disabled"`
+	Groups    []string   `bson:"groups"`
+	NameRules []NameRule `bson:"name_rules"`
+	// FailedLogins counts the failed logins since the last successful one or lockout
+	FailedLogins int        `bson:"failed_logins"`
+	LockedUntil  *time.Time `bson:"locked_until,omitempty"`
 }
 
 // Create a new user instance
@@ -10,5 +25,21 @@ func NewUser(username, password string) *User {
 	return &User{
 		Username: username,
 		Password: password,
+		Role:     RoleUser,
 	}
 }
+
+// IsValidRole reports whether role is one of the known roles
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+// IsAdmin reports whether the user has the admin role
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsLocked reports whether the account is temporarily locked after too many failed logins
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"context"
+	"gcipher/internal/db"
+	"gcipher/internal/db/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type APITokenRepository struct {
+	tokenCollection *mongo.Collection
+}
+
+func NewAPITokenRepository() (*APITokenRepository, error) {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenCollection := client.Database("gcipher").Collection("api_tokens")
+	return &APITokenRepository{tokenCollection: tokenCollection}, nil
+}
+
+func (repo *APITokenRepository) Insert(token models.APIToken) error {
+	_, err := repo.tokenCollection.InsertOne(context.Background(), token)
+	return err
+}
+
+func (repo *APITokenRepository) FindByTokenHash(tokenHash string) (*models.APIToken, error) {
+	filter := bson.M{"token_hash": tokenHash}
+	var result models.APIToken
+	err := repo.tokenCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (repo *APITokenRepository) FindByUsernameAndName(username, name string) (*models.APIToken, error) {
+	filter := bson.M{"username": username, "name": name}
+	var result models.APIToken
+	err := repo.tokenCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (repo *APITokenRepository) Delete(username, name string) error {
+	filter := bson.M{"username": username, "name": name}
+	_, err := repo.tokenCollection.DeleteOne(context.Background(), filter)
+	return err
+}
+
+// DeleteByUsername deletes all API tokens of a user.
+func (repo *APITokenRepository) DeleteByUsername(username string) error {
+	filter := bson.M{"username": username}
+	_, err := repo.tokenCollection.DeleteMany(context.Background(), filter)
+	return err
+}
@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"gcipher/internal/db"
+	"gcipher/internal/db/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CARepository struct {
+	caCollection *mongo.Collection
+}
+
+func NewCARepository() (*CARepository, error) {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	caCollection := client.Database("gcipher").Collection("cas")
+	return &CARepository{caCollection: caCollection}, nil
+}
+
+func (repo *CARepository) Insert(ca models.CA) error {
+	_, err := repo.caCollection.InsertOne(context.Background(), ca)
+	return err
+}
+
+func (repo *CARepository) FindBySerialNumber(serialNumber string) (*models.CA, error) {
+	filter := bson.M{"serial_number": serialNumber}
+	var result models.CA
+	err := repo.caCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Revoke marks the CA as revoked, it returns mongo.ErrNoDocuments if there is no such CA.
+func (repo *CARepository) Revoke(serialNumber string, revokedAt time.Time, reason int) error {
+	filter := bson.M{"serial_number": serialNumber}
+	update := bson.M{"$set": bson.M{"revoked_at": revokedAt, "revocation_reason": reason}}
+	result, err := repo.caCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// FindRevokedByIssuer returns the revoked CAs issued by the CA with the given serial number.
+func (repo *CARepository) FindRevokedByIssuer(issuerSerialNumber string) ([]models.CA, error) {
+	filter := bson.M{"issuer_serial_number": issuerSerialNumber, "revoked_at": bson.M{"$exists": true}}
+	return repo.find(filter, options.Find().SetSort(bson.M{"revoked_at": 1}))
+}
+
+// FindAll returns all CAs in the order they were created
+func (repo *CARepository) FindAll() ([]models.CA, error) {
+	return repo.find(bson.M{}, options.Find().SetSort(bson.M{"created_at": 1}))
+}
+
+func (repo *CARepository) find(filter bson.M, opts *options.FindOptions) ([]models.CA, error) {
+	cursor, err := repo.caCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var cas []models.CA
+	for cursor.Next(context.Background()) {
+		var ca models.CA
+		if err := cursor.Decode(&ca); err != nil {
+			return nil, err
+		}
+		cas = append(cas, ca)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return cas, nil
+}
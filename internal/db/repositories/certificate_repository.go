@@ -8,6 +8,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type CertificateRepository struct {
@@ -94,6 +95,104 @@ func (repo *CertificateRepository) RevokeCertificate(serialNumber string) error
 }
 
 func (repo *CertificateRepository) FindByState(stateFilter string) ([]models.Certificate, error) {
+	return repo.find(stateFilterQuery(stateFilter))
+}
+
+func (repo *CertificateRepository) FindByStateAndUsername(stateFilter, username string) ([]models.Certificate, error) {
+	filter := stateFilterQuery(stateFilter)
+	filter["username"] = username
+	return repo.find(filter)
+}
+
+// CountIssuedSince counts the certificates issued to the user since the given time.
+func (repo *CertificateRepository) CountIssuedSince(username string, since time.Time) (int, error) {
+	filter := bson.M{"username": username, "issued_at": bson.M{"$gte": since}}
+	count, err := repo.certCollection.CountDocuments(context.Background(), filter)
+	return int(count), err
+}
+
+// FindFirstIssuedSince returns the user's oldest certificate issued since the given time.
+func (repo *CertificateRepository) FindFirstIssuedSince(username string, since time.Time) (*models.Certificate, error) {
+	filter := bson.M{"username": username, "issued_at": bson.M{"$gte": since}}
+	opts := options.FindOne().SetSort(bson.M{"issued_at": 1})
+	var result models.Certificate
+	err := repo.certCollection.FindOne(context.Background(), filter, opts).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CountActive counts the user's certificates that are neither revoked nor expired. Certificates
+// stored without expiry date are counted as active.
+func (repo *CertificateRepository) CountActive(username string, now time.Time) (int, error) {
+	filter := bson.M{
+		"username":   username,
+		"revoked_at": nil,
+		"$or": bson.A{
+			bson.M{"not_after": bson.M{"$gt": now}},
+			bson.M{"not_after": bson.M{"$exists": false}},
+		},
+	}
+	count, err := repo.certCollection.CountDocuments(context.Background(), filter)
+	return int(count), err
+}
+
+// CountExpiring counts the certificates that aren't revoked and expire after from but not after to.
+func (repo *CertificateRepository) CountExpiring(from, to time.Time) (int, error) {
+	filter := bson.M{
+		"revoked_at": nil,
+		"not_after":  bson.M{"$gt": from, "$lte": to},
+	}
+	count, err := repo.certCollection.CountDocuments(context.Background(), filter)
+	return int(count), err
+}
+
+// FindWithoutIssuerKeyID returns the certificates stored before the issuing CA generation was
+// recorded.
+func (repo *CertificateRepository) FindWithoutIssuerKeyID() ([]models.Certificate, error) {
+	return repo.find(bson.M{"issuer_key_id": bson.M{"$exists": false}})
+}
+
+// SetIssuerKeyID records the CA generation that signed the certificate.
+func (repo *CertificateRepository) SetIssuerKeyID(serialNumber, issuerKeyID string) error {
+	filter := bson.M{"serial_number": serialNumber}
+	update := bson.M{"$set": bson.M{"issuer_key_id": issuerKeyID}}
+	_, err := repo.certCollection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+// LatestNotAfterByIssuer returns the latest expiry date of the certificates signed by the CA
+// generation with the given key ID, or the zero time if it didn't sign any.
+func (repo *CertificateRepository) LatestNotAfterByIssuer(issuerKeyID string) (time.Time, error) {
+	filter := bson.M{"issuer_key_id": issuerKeyID}
+	opts := options.FindOne().SetSort(bson.M{"not_after": -1})
+	var result models.Certificate
+	err := repo.certCollection.FindOne(context.Background(), filter, opts).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return result.NotAfter, nil
+}
+
+// FindWithNonCanonicalSerialNumber returns the certificates whose serial number was stored with
+// uppercase letters or leading zeros.
+func (repo *CertificateRepository) FindWithNonCanonicalSerialNumber() ([]models.Certificate, error) {
+	return repo.find(bson.M{"serial_number": bson.M{"$regex": "^0.|[A-F]"}})
+}
+
+// RenameSerialNumber changes the serial number the certificate is stored under.
+func (repo *CertificateRepository) RenameSerialNumber(serialNumber, newSerialNumber string) error {
+	filter := bson.M{"serial_number": serialNumber}
+	update := bson.M{"$set": bson.M{"serial_number": newSerialNumber}}
+	_, err := repo.certCollection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+func stateFilterQuery(stateFilter string) bson.M {
 	filter := bson.M{}
 
 	if stateFilter == "revoked" {
@@ -102,6 +201,10 @@ func (repo *CertificateRepository) FindByState(stateFilter string) ([]models.Cer
 		filter["revoked_at"] = nil
 	}
 
+	return filter
+}
+
+func (repo *CertificateRepository) find(filter bson.M) ([]models.Certificate, error) {
 	cursor, err := repo.certCollection.Find(context.Background(), filter)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"context"
+	"gcipher/internal/db"
+	"gcipher/internal/db/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CounterRepository struct {
+	counterCollection *mongo.Collection
+}
+
+func NewCounterRepository() (*CounterRepository, error) {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	counterCollection := client.Database("gcipher").Collection("counters")
+	return &CounterRepository{counterCollection: counterCollection}, nil
+}
+
+// Next atomically increments the named counter and returns its new value, the first value is 1.
+func (repo *CounterRepository) Next(name string) (int64, error) {
+	filter := bson.M{"_id": name}
+	update := bson.M{"$inc": bson.M{"value": int64(1)}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter models.Counter
+	if err := repo.counterCollection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&counter); err != nil {
+		return 0, err
+	}
+	return counter.Value, nil
+}
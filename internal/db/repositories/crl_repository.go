@@ -47,3 +47,28 @@ func (repo *CRLRepository) FindLatest() (*models.CRL, error) {
 	}
 	return &result, nil
 }
+
+// FindAll returns the CRLs of all issuers.
+func (repo *CRLRepository) FindAll() ([]models.CRL, error) {
+	cursor, err := repo.crlCollection.Find(context.Background(), bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var crls []models.CRL
+	if err := cursor.All(context.Background(), &crls); err != nil {
+		return nil, err
+	}
+	return crls, nil
+}
+
+// FindByIssuer returns the CRL of the CA generation with the given key ID.
+func (repo *CRLRepository) FindByIssuer(issuer string) (*models.CRL, error) {
+	var result models.CRL
+	err := repo.crlCollection.FindOne(context.Background(), bson.M{"issuer": issuer}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
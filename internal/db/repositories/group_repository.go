@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"context"
+	"gcipher/internal/db"
+	"gcipher/internal/db/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GroupRepository struct {
+	groupCollection *mongo.Collection
+}
+
+func NewGroupRepository() (*GroupRepository, error) {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	groupCollection := client.Database("gcipher").Collection("groups")
+	return &GroupRepository{groupCollection: groupCollection}, nil
+}
+
+func (repo *GroupRepository) FindByName(name string) (*models.Group, error) {
+	filter := bson.M{"name": name}
+	var result models.Group
+	err := repo.groupCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (repo *GroupRepository) FindByNames(names []string) ([]models.Group, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.M{"name": bson.M{"$in": names}}
+	cursor, err := repo.groupCollection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var groups []models.Group
+	for cursor.Next(context.Background()) {
+		var group models.Group
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// Save inserts the group or replaces it if a group with the same name exists
+func (repo *GroupRepository) Save(group models.Group) error {
+	filter := bson.M{"name": group.Name}
+	_, err := repo.groupCollection.ReplaceOne(context.Background(), filter, group, options.Replace().SetUpsert(true))
+	return err
+}
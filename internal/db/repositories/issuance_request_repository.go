@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"gcipher/internal/db"
+	"gcipher/internal/db/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type IssuanceRequestRepository struct {
+	requestCollection *mongo.Collection
+}
+
+func NewIssuanceRequestRepository() (*IssuanceRequestRepository, error) {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	requestCollection := client.Database("gcipher").Collection("certificate_requests")
+	return &IssuanceRequestRepository{requestCollection: requestCollection}, nil
+}
+
+func (repo *IssuanceRequestRepository) Insert(request models.IssuanceRequest) error {
+	_, err := repo.requestCollection.InsertOne(context.Background(), request)
+	return err
+}
+
+func (repo *IssuanceRequestRepository) FindByID(id primitive.ObjectID) (*models.IssuanceRequest, error) {
+	filter := bson.M{"_id": id}
+	var result models.IssuanceRequest
+	err := repo.requestCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Update replaces the request if it still has the expected status, so two operators can't decide
+// on the same request. It returns mongo.ErrNoDocuments if the status changed in the meantime.
+func (repo *IssuanceRequestRepository) Update(request models.IssuanceRequest, expectedStatus string) error {
+	filter := bson.M{"_id": request.ID, "status": expectedStatus}
+	result, err := repo.requestCollection.ReplaceOne(context.Background(), filter, request)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RenameSerialNumber changes the serial number the requests refer to.
+func (repo *IssuanceRequestRepository) RenameSerialNumber(serialNumber, newSerialNumber string) error {
+	filter := bson.M{"serial_number": serialNumber}
+	update := bson.M{"$set": bson.M{"serial_number": newSerialNumber}}
+	_, err := repo.requestCollection.UpdateMany(context.Background(), filter, update)
+	return err
+}
+
+func (repo *IssuanceRequestRepository) FindByStatus(status string) ([]models.IssuanceRequest, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := repo.requestCollection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var requests []models.IssuanceRequest
+	for cursor.Next(context.Background()) {
+		var request models.IssuanceRequest
+		if err := cursor.Decode(&request); err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// ExpirePending marks all pending requests past their expiry as expired and returns their number.
+func (repo *IssuanceRequestRepository) ExpirePending(now time.Time) (int64, error) {
+	filter := bson.M{"status": models.IssuancePending, "expires_at": bson.M{"$lt": now}}
+	update := bson.M{
+		"$set":  bson.M{"status": models.IssuanceExpired},
+		"$push": bson.M{"events": models.AuditEvent{Action: "expired", Username: "system", Time: now}},
+	}
+	result, err := repo.requestCollection.UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"gcipher/internal/db"
+	"gcipher/internal/db/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type KeyEscrowRepository struct {
+	keyCollection      *mongo.Collection
+	recoveryCollection *mongo.Collection
+}
+
+func NewKeyEscrowRepository() (*KeyEscrowRepository, error) {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	database := client.Database("gcipher")
+	return &KeyEscrowRepository{
+		keyCollection:      database.Collection("key_escrow"),
+		recoveryCollection: database.Collection("key_recoveries"),
+	}, nil
+}
+
+func (repo *KeyEscrowRepository) InsertKey(key models.EscrowedKey) error {
+	_, err := repo.keyCollection.InsertOne(context.Background(), key)
+	return err
+}
+
+func (repo *KeyEscrowRepository) FindKeyBySerialNumber(serialNumber string) (*models.EscrowedKey, error) {
+	filter := bson.M{"serial_number": serialNumber}
+	var result models.EscrowedKey
+	err := repo.keyCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RenameSerialNumber changes the serial number the escrowed key and its recoveries refer to.
+func (repo *KeyEscrowRepository) RenameSerialNumber(serialNumber, newSerialNumber string) error {
+	filter := bson.M{"serial_number": serialNumber}
+	update := bson.M{"$set": bson.M{"serial_number": newSerialNumber}}
+	if _, err := repo.keyCollection.UpdateMany(context.Background(), filter, update); err != nil {
+		return err
+	}
+	_, err := repo.recoveryCollection.UpdateMany(context.Background(), filter, update)
+	return err
+}
+
+func (repo *KeyEscrowRepository) InsertRecovery(recovery models.KeyRecovery) error {
+	_, err := repo.recoveryCollection.InsertOne(context.Background(), recovery)
+	return err
+}
+
+func (repo *KeyEscrowRepository) FindRecoveryByID(id primitive.ObjectID) (*models.KeyRecovery, error) {
+	filter := bson.M{"_id": id}
+	var result models.KeyRecovery
+	err := repo.recoveryCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateRecovery replaces the recovery if it still has the expected status, so concurrent
+// approvals can't overwrite each other. It returns mongo.ErrNoDocuments if the status changed.
+func (repo *KeyEscrowRepository) UpdateRecovery(recovery models.KeyRecovery, expectedStatus string, expectedApprovals int) error {
+	filter := bson.M{
+		"_id":       recovery.ID,
+		"status":    expectedStatus,
+		"approvals": bson.M{"$size": expectedApprovals},
+	}
+	result, err := repo.recoveryCollection.ReplaceOne(context.Background(), filter, recovery)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (repo *KeyEscrowRepository) FindRecoveriesByStatus(status string) ([]models.KeyRecovery, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := repo.recoveryCollection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var recoveries []models.KeyRecovery
+	for cursor.Next(context.Background()) {
+		var recovery models.KeyRecovery
+		if err := cursor.Decode(&recovery); err != nil {
+			return nil, err
+		}
+		recoveries = append(recoveries, recovery)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return recoveries, nil
+}
@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"gcipher/internal/db"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type LogRepository struct {
+	logCollection *mongo.Collection
+}
+
+func NewLogRepository() (*LogRepository, error) {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	logCollection := client.Database("gcipher").Collection("logs")
+	return &LogRepository{logCollection: logCollection}, nil
+}
+
+// Write implements io.Writer so the repository can be used as a log sink.
+// Every call is expected to carry exactly one JSON encoded log record.
+func (repo *LogRepository) Write(p []byte) (int, error) {
+	var entry map[string]interface{}
+	if err := json.Unmarshal(p, &entry); err != nil {
+		return 0, err
+	}
+
+	_, err := repo.logCollection.InsertOne(context.Background(), entry)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -9,6 +9,14 @@ var (
 	certRepo      *CertificateRepository
 	userRepo      *UserRepository
 	crlRepo       *CRLRepository
+	logRepo       *LogRepository
+	tokenRepo     *APITokenRepository
+	escrowRepo    *KeyEscrowRepository
+	issuanceRepo  *IssuanceRequestRepository
+	groupRepo     *GroupRepository
+	caRepo        *CARepository
+	sshCertRepo   *SSHCertificateRepository
+	counterRepo   *CounterRepository
 	repoInitError error
 )
 
@@ -29,6 +37,46 @@ func InitializeRepositories() error {
 		if repoInitError != nil {
 			return
 		}
+
+		logRepo, repoInitError = NewLogRepository()
+		if repoInitError != nil {
+			return
+		}
+
+		tokenRepo, repoInitError = NewAPITokenRepository()
+		if repoInitError != nil {
+			return
+		}
+
+		escrowRepo, repoInitError = NewKeyEscrowRepository()
+		if repoInitError != nil {
+			return
+		}
+
+		issuanceRepo, repoInitError = NewIssuanceRequestRepository()
+		if repoInitError != nil {
+			return
+		}
+
+		groupRepo, repoInitError = NewGroupRepository()
+		if repoInitError != nil {
+			return
+		}
+
+		caRepo, repoInitError = NewCARepository()
+		if repoInitError != nil {
+			return
+		}
+
+		sshCertRepo, repoInitError = NewSSHCertificateRepository()
+		if repoInitError != nil {
+			return
+		}
+
+		counterRepo, repoInitError = NewCounterRepository()
+		if repoInitError != nil {
+			return
+		}
 	})
 
 	return repoInitError
@@ -48,3 +96,43 @@ func GetUserRepository() *UserRepository {
 func GetCRLRepository() *CRLRepository {
 	return crlRepo
 }
+
+// GetLogRepository returns the singleton-like instance of the LogRepository
+func GetLogRepository() *LogRepository {
+	return logRepo
+}
+
+// GetAPITokenRepository returns the singleton-like instance of the APITokenRepository
+func GetAPITokenRepository() *APITokenRepository {
+	return tokenRepo
+}
+
+// GetKeyEscrowRepository returns the singleton-like instance of the KeyEscrowRepository
+func GetKeyEscrowRepository() *KeyEscrowRepository {
+	return escrowRepo
+}
+
+// GetIssuanceRequestRepository returns the singleton-like instance of the IssuanceRequestRepository
+func GetIssuanceRequestRepository() *IssuanceRequestRepository {
+	return issuanceRepo
+}
+
+// GetGroupRepository returns the singleton-like instance of the GroupRepository
+func GetGroupRepository() *GroupRepository {
+	return groupRepo
+}
+
+// GetCARepository returns the singleton-like instance of the CARepository
+func GetCARepository() *CARepository {
+	return caRepo
+}
+
+// GetSSHCertificateRepository returns the singleton-like instance of the SSHCertificateRepository
+func GetSSHCertificateRepository() *SSHCertificateRepository {
+	return sshCertRepo
+}
+
+// GetCounterRepository returns the singleton-like instance of the CounterRepository
+func GetCounterRepository() *CounterRepository {
+	return counterRepo
+}
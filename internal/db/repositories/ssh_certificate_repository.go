@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"context"
+	"gcipher/internal/db"
+	"gcipher/internal/db/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SSHCertificateRepository struct {
+	sshCertCollection *mongo.Collection
+}
+
+func NewSSHCertificateRepository() (*SSHCertificateRepository, error) {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	sshCertCollection := client.Database("gcipher").Collection("ssh_certificates")
+	return &SSHCertificateRepository{sshCertCollection: sshCertCollection}, nil
+}
+
+func (repo *SSHCertificateRepository) Insert(cert models.SSHCertificate) error {
+	_, err := repo.sshCertCollection.InsertOne(context.Background(), cert)
+	return err
+}
+
+func (repo *SSHCertificateRepository) FindBySerialNumber(serialNumber uint64) (*models.SSHCertificate, error) {
+	filter := bson.M{"serial_number": serialNumber}
+	var result models.SSHCertificate
+	err := repo.sshCertCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (repo *SSHCertificateRepository) FindBySerialNumberAndUsername(serialNumber uint64, username string) (*models.SSHCertificate, error) {
+	filter := bson.M{"serial_number": serialNumber, "username": username}
+	var result models.SSHCertificate
+	err := repo.sshCertCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Revoke marks the certificate as revoked unless it already is, it returns mongo.ErrNoDocuments
+// if there is no such unrevoked certificate.
+func (repo *SSHCertificateRepository) Revoke(serialNumber uint64, revokedAt time.Time) error {
+	filter := bson.M{"serial_number": serialNumber, "revoked_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revoked_at": revokedAt}}
+	result, err := repo.sshCertCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// FindRevoked returns the revoked certificates that haven't expired at now, expired ones are
+// refused by sshd anyway and don't need to be listed in the KRL.
+func (repo *SSHCertificateRepository) FindRevoked(now time.Time) ([]models.SSHCertificate, error) {
+	filter := bson.M{"revoked_at": bson.M{"$exists": true}, "valid_before": bson.M{"$gt": now}}
+	return repo.find(filter, options.Find().SetSort(bson.M{"serial_number": 1}))
+}
+
+// FindByStateAndUsername returns the user's certificates matching the state filter ("valid",
+// "revoked" or empty for all).
+func (repo *SSHCertificateRepository) FindByStateAndUsername(stateFilter, username string) ([]models.SSHCertificate, error) {
+	filter := stateFilterQuery(stateFilter)
+	filter["username"] = username
+	return repo.find(filter, options.Find().SetSort(bson.M{"issued_at": 1}))
+}
+
+func (repo *SSHCertificateRepository) find(filter bson.M, opts *options.FindOptions) ([]models.SSHCertificate, error) {
+	cursor, err := repo.sshCertCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var certs []models.SSHCertificate
+	for cursor.Next(context.Background()) {
+		var cert models.SSHCertificate
+		if err := cursor.Decode(&cert); err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"gcipher/internal/db"
 	"gcipher/internal/db/models"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserRepository struct {
@@ -38,6 +40,47 @@ func (repo *UserRepository) FindByUsername(username string) (*models.User, error
 	return &result, nil
 }
 
+// FindAll returns all users sorted by username.
+func (repo *UserRepository) FindAll() ([]models.User, error) {
+	opts := options.Find().SetSort(bson.M{"username": 1})
+	cursor, err := repo.userCollection.Find(context.Background(), bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var users []models.User
+	for cursor.Next(context.Background()) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SetDisabled disables or enables a user.
+func (repo *UserRepository) SetDisabled(username string, disabled bool) error {
+	filter := bson.M{"username": username}
+	update := bson.M{"$set": bson.M{"disabled": disabled}}
+	_, err := repo.userCollection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+// SetRole changes the role of a user.
+func (repo *UserRepository) SetRole(username, role string) error {
+	filter := bson.M{"username": username}
+	update := bson.M{"$set": bson.M{"role": role}}
+	_, err := repo.userCollection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
 func (repo *UserRepository) Update(user models.User) error {
 	filter := bson.M{"username": user.Username}
 	update := bson.M{"$set": user}
@@ -45,6 +88,44 @@ func (repo *UserRepository) Update(user models.User) error {
 	return err
 }
 
+// RecordFailedLogin counts a failed login. Once threshold failures are reached, the account is
+// locked until lockUntil and the counter starts over. It reports whether the account was locked.
+func (repo *UserRepository) RecordFailedLogin(username string, threshold int, lockUntil time.Time) (bool, error) {
+	filter := bson.M{"username": username}
+	update := bson.M{"$inc": bson.M{"failed_logins": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result models.User
+	err := repo.userCollection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&result)
+	if err != nil {
+		return false, err
+	}
+
+	if result.FailedLogins < threshold {
+		return false, nil
+	}
+
+	update = bson.M{"$set": bson.M{"failed_logins": 0, "locked_until": lockUntil}}
+	_, err = repo.userCollection.UpdateOne(context.Background(), filter, update)
+	return err == nil, err
+}
+
+// ResetFailedLogins clears the failed login counter and lifts a lockout.
+func (repo *UserRepository) ResetFailedLogins(username string) error {
+	filter := bson.M{"username": username}
+	update := bson.M{"$set": bson.M{"failed_logins": 0}, "$unset": bson.M{"locked_until": ""}}
+	_, err := repo.userCollection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+// UpdatePassword replaces the password hash of a user.
+func (repo *UserRepository) UpdatePassword(username, passwordHash string) error {
+	filter := bson.M{"username": username}
+	update := bson.M{"$set": bson.M{"password": passwordHash}}
+	_, err := repo.userCollection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
 func (repo *UserRepository) Delete(username string) error {
 	filter := bson.M{"username": username}
 	_, err := repo.userCollection.DeleteOne(context.Background(), filter)
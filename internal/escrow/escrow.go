@@ -0,0 +1,104 @@
+package escrow
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"log/slog"
+)
+
+// Enabled reports whether key escrow is configured.
+func Enabled(cfg *config.Config) bool {
+	return cfg.KeyEscrowMode != ""
+}
+
+// Required reports whether keys generated for the profile must be escrowed.
+func Required(cfg *config.Config, profile string) bool {
+	for _, p := range cfg.KeyEscrowProfiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// EscrowKey stores the private key of the certificate encrypted under the KEK, or sealed to
+// the escrow public key whose private key is split between the admins.
+func EscrowKey(ctx context.Context, cfg *config.Config, cert *models.Certificate, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %v", err)
+	}
+
+	var encrypted []byte
+	switch cfg.KeyEscrowMode {
+	case models.EscrowModeKEK:
+		encrypted, err = encrypt(cfg.KeyEscrowKEK, der)
+	case models.EscrowModeShamir:
+		var recipient *ecdh.PublicKey
+		recipient, err = escrowPublicKey(cfg)
+		if err == nil {
+			encrypted, err = seal(recipient, der)
+		}
+	default:
+		return fmt.Errorf("key escrow is disabled")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encrypt private key: %v", err)
+	}
+
+	escrowed := models.NewEscrowedKey(cert.SerialNumber, cert.Username, cfg.KeyEscrowMode, encrypted)
+	if err := repositories.GetKeyEscrowRepository().InsertKey(*escrowed); err != nil {
+		return fmt.Errorf("failed to store escrowed key: %v", err)
+	}
+
+	slog.InfoContext(ctx, "Private key escrowed", "serialnumber", cert.SerialNumber, "mode", cfg.KeyEscrowMode)
+	return nil
+}
+
+// decryptKey decrypts an escrowed key. escrowKey is the reconstructed escrow private key
+// and only used in shamir mode.
+func decryptKey(cfg *config.Config, escrowed *models.EscrowedKey, escrowKey *ecdh.PrivateKey) (crypto.Signer, error) {
+	var der []byte
+	var err error
+
+	switch escrowed.Mode {
+	case models.EscrowModeKEK:
+		if cfg.KeyEscrowKEK == nil {
+			return nil, fmt.Errorf("key was escrowed with a KEK but none is configured")
+		}
+		der, err = decrypt(cfg.KeyEscrowKEK, escrowed.EncryptedKey)
+	case models.EscrowModeShamir:
+		der, err = open(escrowKey, escrowed.EncryptedKey)
+	default:
+		return nil, fmt.Errorf("unsupported escrow mode: %s", escrowed.Mode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt escrowed key: %v", err)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse escrowed key: %v", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported escrowed key type")
+	}
+	return signer, nil
+}
+
+func escrowPublicKey(cfg *config.Config) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(cfg.KeyEscrowPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key_escrow_public_key: %v", err)
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
@@ -0,0 +1,178 @@
+package escrow
+
+import (
+	"encoding/json"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/server/api"
+	"gcipher/internal/user"
+	"net/http"
+)
+
+// HandleRequestRecovery handles POST /api/v2/escrow/recoveries.
+func HandleRequestRecovery(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	var data api.KeyRecoveryRequestData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	recovery, err := RequestRecovery(r.Context(), authUser, data)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v2/escrow/recoveries/"+recovery.ID.Hex())
+	api.EncodeResponseWithStatus(w, http.StatusCreated, newRecoveryResponseData(recovery))
+}
+
+// HandleListRecoveries handles GET /api/v2/escrow/recoveries?status=... and is restricted to admins.
+func HandleListRecoveries(w http.ResponseWriter, r *http.Request) {
+	if _, ok := user.RequireAdmin(w, r); !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.RecoveryPending, models.RecoveryApproved, models.RecoveryRejected, models.RecoveryCompleted:
+	default:
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid status parameter")
+		return
+	}
+
+	recoveries, err := ListRecoveries(r.Context(), status)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	recoveryList := make([]api.KeyRecoveryResponseData, 0, len(recoveries))
+	for i := range recoveries {
+		recoveryList = append(recoveryList, newRecoveryResponseData(&recoveries[i]))
+	}
+
+	api.EncodeResponse(w, recoveryList)
+}
+
+// HandleGetRecovery handles GET /api/v2/escrow/recoveries/{id} so requesters can poll the status.
+func HandleGetRecovery(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	recovery, err := GetRecovery(r.Context(), authUser, r.PathValue("id"))
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	api.EncodeResponse(w, newRecoveryResponseData(recovery))
+}
+
+// HandleApproveRecovery handles POST /api/v2/escrow/recoveries/{id}/approve.
+func HandleApproveRecovery(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var data api.KeyRecoveryApprovalData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	recovery, err := ApproveRecovery(r.Context(), authUser, r.PathValue("id"), data)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	api.EncodeResponse(w, newRecoveryResponseData(recovery))
+}
+
+// HandleRejectRecovery handles POST /api/v2/escrow/recoveries/{id}/reject.
+func HandleRejectRecovery(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var data api.KeyRecoveryApprovalData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	recovery, err := RejectRecovery(r.Context(), authUser, r.PathValue("id"), data.Comment)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	api.EncodeResponse(w, newRecoveryResponseData(recovery))
+}
+
+// HandleCompleteRecovery handles POST /api/v2/escrow/recoveries/{id}/key and returns the
+// recovered key as PKCS#12 bundle.
+func HandleCompleteRecovery(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	var data api.KeyRecoveryCompletionData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	recovery, pfxData, err := CompleteRecovery(r.Context(), authUser, r.PathValue("id"), data)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pkcs12")
+	w.Header().Set("Content-Disposition", "attachment; filename="+recovery.SerialNumber+".p12")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(pfxData)
+}
+
+func newRecoveryResponseData(recovery *models.KeyRecovery) api.KeyRecoveryResponseData {
+	data := api.KeyRecoveryResponseData{
+		ID:           recovery.ID.Hex(),
+		SerialNumber: recovery.SerialNumber,
+		Requester:    recovery.Requester,
+		Reason:       recovery.Reason,
+		Status:       recovery.Status,
+		Approvals:    make([]string, 0, len(recovery.Approvals)),
+		Events:       make([]api.AuditEventData, 0, len(recovery.Events)),
+		CreatedAt:    recovery.CreatedAt,
+	}
+
+	if cfg, err := config.GetConfig(); err == nil {
+		data.RequiredApprovals = cfg.KeyEscrowRequiredApprovals
+	}
+
+	for _, approval := range recovery.Approvals {
+		data.Approvals = append(data.Approvals, approval.Username)
+	}
+	for _, event := range recovery.Events {
+		data.Events = append(data.Events, api.AuditEventData{
+			Action:   event.Action,
+			Username: event.Username,
+			Comment:  event.Comment,
+			Time:     event.Time,
+		})
+	}
+
+	return data
+}
@@ -0,0 +1,337 @@
+package escrow
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/server/api"
+	"gcipher/internal/user"
+	"gcipher/internal/util"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RequestRecovery opens a recovery request for the escrowed key of a certificate. Owners can
+// request their own keys, admins any key. The password later protects the recovered bundle and,
+// in shamir mode, the key shares submitted by the approvers.
+func RequestRecovery(ctx context.Context, requester *models.User, data api.KeyRecoveryRequestData) (*models.KeyRecovery, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Couldn't read config", err)
+	}
+
+	if !Enabled(cfg) {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Key escrow is disabled", nil)
+	}
+
+	if data.Reason == "" {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Missing reason parameter", nil)
+	}
+
+	if err := user.CheckPasswordPolicy(cfg, requester.Username, data.Password, cfg.KeygenMinPasswordLength); err != nil {
+		return nil, user.PasswordPolicyError(err)
+	}
+
+	serialNumber := data.SerialNumber
+	if canonical, ok := util.CanonicalSerialNumber(serialNumber); ok {
+		serialNumber = canonical
+	}
+
+	cert, err := repositories.GetCertificateRepository().FindBySerialNumber(serialNumber)
+	if err != nil || (cert.Username != requester.Username && !requester.IsAdmin()) {
+		return nil, api.NewStatusError(http.StatusNotFound, "Certificate not found", err)
+	}
+
+	if _, err := repositories.GetKeyEscrowRepository().FindKeyBySerialNumber(cert.SerialNumber); err != nil {
+		return nil, api.NewStatusError(http.StatusNotFound, "No escrowed key for this certificate", err)
+	}
+
+	recovery := models.NewKeyRecovery(cert.SerialNumber, requester.Username, data.Reason)
+
+	recoveryKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	recovery.Salt = make([]byte, 16)
+	if _, err := rand.Read(recovery.Salt); err != nil {
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	recovery.PublicKey = recoveryKey.PublicKey().Bytes()
+	recovery.EncryptedPrivateKey, err = encrypt(passwordKey(data.Password, recovery.Salt), recoveryKey.Bytes())
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	if err := repositories.GetKeyEscrowRepository().InsertRecovery(*recovery); err != nil {
+		slog.ErrorContext(ctx, "Failed to store key recovery", "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	slog.InfoContext(ctx, "Key recovery requested", "recovery_id", recovery.ID.Hex(), "serialnumber", recovery.SerialNumber, "reason", data.Reason)
+	return recovery, nil
+}
+
+// GetRecovery returns a recovery request. Only the requester and admins can see it.
+func GetRecovery(ctx context.Context, caller *models.User, id string) (*models.KeyRecovery, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusNotFound, "Recovery request not found", err)
+	}
+
+	recovery, err := repositories.GetKeyEscrowRepository().FindRecoveryByID(objectID)
+	if err != nil || (recovery.Requester != caller.Username && !caller.IsAdmin()) {
+		return nil, api.NewStatusError(http.StatusNotFound, "Recovery request not found", err)
+	}
+
+	return recovery, nil
+}
+
+// ListRecoveries returns all recovery requests with the given status, or all if status is empty.
+func ListRecoveries(ctx context.Context, status string) ([]models.KeyRecovery, error) {
+	recoveries, err := repositories.GetKeyEscrowRepository().FindRecoveriesByStatus(status)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to retrieve key recoveries", "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Failed to retrieve key recoveries", err)
+	}
+	return recoveries, nil
+}
+
+// ApproveRecovery records an admin's approval. Requesters can't approve their own requests and
+// every admin can approve only once. In shamir mode the approval must carry the admin's share,
+// which is sealed to the request's key so only the requester can use it.
+func ApproveRecovery(ctx context.Context, admin *models.User, id string, data api.KeyRecoveryApprovalData) (*models.KeyRecovery, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Couldn't read config", err)
+	}
+
+	recovery, err := GetRecovery(ctx, admin, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if recovery.Status != models.RecoveryPending {
+		return nil, api.NewStatusError(http.StatusConflict, "Recovery request is "+recovery.Status, nil)
+	}
+
+	if recovery.Requester == admin.Username {
+		return nil, api.NewStatusError(http.StatusForbidden, "Requesters can't approve their own recovery", nil)
+	}
+
+	if recovery.HasApproved(admin.Username) {
+		return nil, api.NewStatusError(http.StatusConflict, "Recovery already approved by this user", nil)
+	}
+
+	escrowed, err := repositories.GetKeyEscrowRepository().FindKeyBySerialNumber(recovery.SerialNumber)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusNotFound, "No escrowed key for this certificate", err)
+	}
+
+	approval := models.KeyApproval{Username: admin.Username, ApprovedAt: time.Now()}
+	if escrowed.Mode == models.EscrowModeShamir {
+		share, err := base64.StdEncoding.DecodeString(data.Share)
+		if err != nil || len(share) != 33 {
+			return nil, api.NewStatusError(http.StatusBadRequest, "Missing or invalid share parameter", err)
+		}
+
+		recoveryKey, err := ecdh.X25519().NewPublicKey(recovery.PublicKey)
+		if err != nil {
+			return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+		}
+
+		approval.SealedShare, err = seal(recoveryKey, share)
+		if err != nil {
+			return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+		}
+	}
+
+	previousApprovals := len(recovery.Approvals)
+	recovery.Approvals = append(recovery.Approvals, approval)
+	recovery.AddEvent("approved", admin.Username, data.Comment)
+	if len(recovery.Approvals) >= cfg.KeyEscrowRequiredApprovals {
+		recovery.Status = models.RecoveryApproved
+	}
+
+	if err := updateRecovery(ctx, recovery, models.RecoveryPending, previousApprovals); err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Key recovery approved", "recovery_id", recovery.ID.Hex(), "serialnumber", recovery.SerialNumber,
+		"approvals", len(recovery.Approvals), "required_approvals", cfg.KeyEscrowRequiredApprovals)
+	return recovery, nil
+}
+
+// RejectRecovery rejects a pending or approved recovery request.
+func RejectRecovery(ctx context.Context, admin *models.User, id string, comment string) (*models.KeyRecovery, error) {
+	recovery, err := GetRecovery(ctx, admin, id)
+	if err != nil {
+		return nil, err
+	}
+
+	previousStatus := recovery.Status
+	if previousStatus != models.RecoveryPending && previousStatus != models.RecoveryApproved {
+		return nil, api.NewStatusError(http.StatusConflict, "Recovery request is "+recovery.Status, nil)
+	}
+
+	recovery.Status = models.RecoveryRejected
+	recovery.AddEvent("rejected", admin.Username, comment)
+	wipe(recovery)
+
+	if err := updateRecovery(ctx, recovery, previousStatus, len(recovery.Approvals)); err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Key recovery rejected", "recovery_id", recovery.ID.Hex(), "serialnumber", recovery.SerialNumber)
+	return recovery, nil
+}
+
+// CompleteRecovery releases the key of an approved recovery to its requester as PKCS#12 bundle
+// protected by the password given when the recovery was requested. The request can only be
+// completed once.
+func CompleteRecovery(ctx context.Context, requester *models.User, id string, data api.KeyRecoveryCompletionData) (*models.KeyRecovery, []byte, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, "Couldn't read config", err)
+	}
+
+	encoder, err := util.PKCS12Encoder(data.Encoding)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusBadRequest, api.Capitalize(err.Error()), nil)
+	}
+
+	recovery, err := GetRecovery(ctx, requester, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if recovery.Requester != requester.Username {
+		return nil, nil, api.NewStatusError(http.StatusForbidden, "Only the requester can complete a recovery", nil)
+	}
+
+	if recovery.Status != models.RecoveryApproved {
+		return nil, nil, api.NewStatusError(http.StatusConflict, "Recovery request is "+recovery.Status, nil)
+	}
+
+	privateKeyBytes, err := decrypt(passwordKey(data.Password, recovery.Salt), recovery.EncryptedPrivateKey)
+	if err != nil {
+		slog.WarnContext(ctx, "Key recovery completion with wrong password", "recovery_id", recovery.ID.Hex())
+		return nil, nil, api.NewStatusError(http.StatusForbidden, "Invalid password", nil)
+	}
+
+	recoveryKey, err := ecdh.X25519().NewPrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	escrowed, err := repositories.GetKeyEscrowRepository().FindKeyBySerialNumber(recovery.SerialNumber)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusNotFound, "No escrowed key for this certificate", err)
+	}
+
+	var escrowKey *ecdh.PrivateKey
+	if escrowed.Mode == models.EscrowModeShamir {
+		escrowKey, err = combineShares(cfg, recoveryKey, recovery.Approvals)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to reconstruct escrow key", "recovery_id", recovery.ID.Hex(), "error", err)
+			return nil, nil, api.NewStatusError(http.StatusConflict, "The submitted shares don't reconstruct the escrow key", err)
+		}
+	}
+
+	key, err := decryptKey(cfg, escrowed, escrowKey)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to decrypt escrowed key", "recovery_id", recovery.ID.Hex(), "error", err)
+		return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Failed to decrypt escrowed key", err)
+	}
+
+	cert, err := repositories.GetCertificateRepository().FindBySerialNumber(recovery.SerialNumber)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusNotFound, "Certificate not found", err)
+	}
+
+	parsed, err := util.ParseCertificateFromBytes(cert.CertificatePEM)
+	if err != nil {
+		return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	pfxData, err := encoder.Encode(key, parsed, cfg.CAChain(), data.Password)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to encode PKCS#12 bundle", "error", err)
+		return nil, nil, api.NewStatusError(http.StatusInternalServerError, "Failed to encode PKCS#12 bundle", err)
+	}
+
+	recovery.Status = models.RecoveryCompleted
+	recovery.AddEvent("completed", requester.Username, "")
+	wipe(recovery)
+
+	if err := updateRecovery(ctx, recovery, models.RecoveryApproved, len(recovery.Approvals)); err != nil {
+		return nil, nil, err
+	}
+
+	slog.InfoContext(ctx, "Escrowed key recovered", "recovery_id", recovery.ID.Hex(), "serialnumber", recovery.SerialNumber)
+	return recovery, pfxData, nil
+}
+
+// combineShares opens the shares sealed to the recovery key and reconstructs the escrow private key.
+func combineShares(cfg *config.Config, recoveryKey *ecdh.PrivateKey, approvals []models.KeyApproval) (*ecdh.PrivateKey, error) {
+	shares := make([][]byte, 0, len(approvals))
+	for _, approval := range approvals {
+		share, err := open(recoveryKey, approval.SealedShare)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	secret, err := Combine(shares)
+	if err != nil {
+		return nil, err
+	}
+
+	escrowKey, err := ecdh.X25519().NewPrivateKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	expected, err := escrowPublicKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(escrowKey.PublicKey().Bytes(), expected.Bytes()) {
+		return nil, errors.New("reconstructed key doesn't match the escrow public key")
+	}
+
+	return escrowKey, nil
+}
+
+// wipe removes the key material of a finished recovery, only the audit trail is kept.
+func wipe(recovery *models.KeyRecovery) {
+	for i := range recovery.Approvals {
+		recovery.Approvals[i].SealedShare = nil
+	}
+	recovery.EncryptedPrivateKey = nil
+	recovery.Salt = nil
+}
+
+func updateRecovery(ctx context.Context, recovery *models.KeyRecovery, expectedStatus string, expectedApprovals int) error {
+	err := repositories.GetKeyEscrowRepository().UpdateRecovery(*recovery, expectedStatus, expectedApprovals)
+	if err == mongo.ErrNoDocuments {
+		return api.NewStatusError(http.StatusConflict, "Recovery request was modified concurrently", err)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update key recovery", "recovery_id", recovery.ID.Hex(), "error", err)
+		return api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package escrow
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// seal encrypts plaintext to an X25519 public key. The output is the ephemeral public
+// key followed by the AES-256-GCM nonce and ciphertext.
+func seal(recipient *ecdh.PublicKey, plaintext []byte) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+	ciphertext, err := encrypt(sealKey(shared, ephemeralPublic, recipient.Bytes()), plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ephemeralPublic, ciphertext...), nil
+}
+
+// open decrypts data created by seal.
+func open(private *ecdh.PrivateKey, sealed []byte) ([]byte, error) {
+	if len(sealed) < 32 {
+		return nil, errors.New("sealed data is too short")
+	}
+
+	ephemeralPublic, err := ecdh.X25519().NewPublicKey(sealed[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := private.ECDH(ephemeralPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	return decrypt(sealKey(shared, sealed[:32], private.PublicKey().Bytes()), sealed[32:])
+}
+
+func sealKey(shared, ephemeralPublic, recipientPublic []byte) []byte {
+	h := sha256.New()
+	h.Write(shared)
+	h.Write(ephemeralPublic)
+	h.Write(recipientPublic)
+	return h.Sum(nil)
+}
+
+// passwordKey derives an AES-256 key from a password.
+func passwordKey(password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, 3, 64*1024, 2, 32)
+}
+
+// encrypt encrypts plaintext with AES-256-GCM and prepends the nonce.
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// decrypt decrypts data created by encrypt.
+func decrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,129 @@
+package escrow
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+// Split divides secret into parts shares, any threshold of which can reconstruct it.
+// It implements Shamir's secret sharing over GF(2^8); every share is the evaluation
+// of one random polynomial per secret byte followed by the x coordinate.
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("cannot split an empty secret")
+	}
+	if threshold < 2 || parts < threshold || parts > 255 {
+		return nil, errors.New("invalid number of shares or threshold")
+	}
+
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+	for idx, b := range secret {
+		coefficients[0] = b
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+
+		for i := range shares {
+			shares[i][idx] = evaluate(coefficients, byte(i+1))
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine reconstructs the secret from at least threshold shares created by Split.
+// Combining too few shares yields a wrong secret rather than an error.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least two shares are required")
+	}
+
+	length := len(shares[0])
+	if length < 2 {
+		return nil, errors.New("shares are too short")
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != length {
+			return nil, errors.New("shares have different lengths")
+		}
+		x := share[length-1]
+		if x == 0 || seen[x] {
+			return nil, errors.New("duplicate or invalid share")
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	secret := make([]byte, length-1)
+	ys := make([]byte, len(shares))
+	for idx := range secret {
+		for i, share := range shares {
+			ys[i] = share[idx]
+		}
+		secret[idx] = interpolateAtZero(xs, ys)
+	}
+
+	return secret, nil
+}
+
+// evaluate computes the polynomial with the given coefficients at x using Horner's method.
+func evaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// interpolateAtZero computes the Lagrange interpolation of the points at x = 0.
+func interpolateAtZero(xs, ys []byte) byte {
+	var result byte
+	for i := range xs {
+		basis := byte(1)
+		for j := range xs {
+			if i == j {
+				continue
+			}
+			// In GF(2^8) subtraction is addition, so (0 - xj) / (xi - xj) = xj / (xi ^ xj)
+			basis = gfMul(basis, gfDiv(xs[j], xs[i]^xs[j]))
+		}
+		result ^= gfMul(ys[i], basis)
+	}
+	return result
+}
+
+// gfMul multiplies in GF(2^8) using the AES polynomial x^8 + x^4 + x^3 + x + 1.
+func gfMul(a, b byte) byte {
+	var product byte
+	for b > 0 {
+		if b&1 == 1 {
+			product ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return product
+}
+
+// gfDiv divides in GF(2^8). b must not be zero.
+func gfDiv(a, b byte) byte {
+	// The multiplicative inverse is b^254
+	inverse := byte(1)
+	for i := 0; i < 254; i++ {
+		inverse = gfMul(inverse, b)
+	}
+	return gfMul(a, inverse)
+}
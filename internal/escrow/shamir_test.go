@@ -0,0 +1,135 @@
+package escrow
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func randomSecret(t *testing.T) []byte {
+	t.Helper()
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// subsets returns every subset of the shares with the given size.
+func subsets(shares [][]byte, size int) [][][]byte {
+	var result [][][]byte
+	var pick func(start int, chosen [][]byte)
+	pick = func(start int, chosen [][]byte) {
+		if len(chosen) == size {
+			result = append(result, append([][]byte(nil), chosen...))
+			return
+		}
+		for i := start; i < len(shares); i++ {
+			pick(i+1, append(chosen, shares[i]))
+		}
+	}
+	pick(0, nil)
+	return result
+}
+
+func TestCombineReconstructsFromEverySubsetOfThreshold(t *testing.T) {
+	for _, test := range []struct{ parts, threshold int }{{2, 2}, {3, 2}, {5, 3}, {6, 6}} {
+		secret := randomSecret(t)
+		shares, err := Split(secret, test.parts, test.threshold)
+		if err != nil {
+			t.Fatalf("Split(%d, %d): %v", test.parts, test.threshold, err)
+		}
+		if len(shares) != test.parts {
+			t.Fatalf("Split(%d, %d) returned %d shares", test.parts, test.threshold, len(shares))
+		}
+
+		for size := test.threshold; size <= test.parts; size++ {
+			for _, subset := range subsets(shares, size) {
+				combined, err := Combine(subset)
+				if err != nil {
+					t.Fatalf("%d-of-%d: Combine of %d shares: %v", test.threshold, test.parts, size, err)
+				}
+				if !bytes.Equal(combined, secret) {
+					t.Errorf("%d-of-%d: %d shares didn't reconstruct the secret", test.threshold, test.parts, size)
+				}
+			}
+		}
+	}
+}
+
+func TestCombineFailsBelowThreshold(t *testing.T) {
+	secret := randomSecret(t)
+	shares, err := Split(secret, 5, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for size := 1; size < 4; size++ {
+		for _, subset := range subsets(shares, size) {
+			combined, err := Combine(subset)
+			if err == nil && bytes.Equal(combined, secret) {
+				t.Errorf("%d of 5 shares reconstructed a 4-of-5 secret", size)
+			}
+		}
+	}
+}
+
+func TestCombineRejectsDuplicateShares(t *testing.T) {
+	secret := randomSecret(t)
+	shares, err := Split(secret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Combine([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("Combine accepted the same share twice")
+	}
+
+	// A different share carrying the index of another one
+	forged := append([]byte(nil), shares[1]...)
+	forged[len(forged)-1] = shares[0][len(shares[0])-1]
+	if _, err := Combine([][]byte{shares[0], forged, shares[2]}); err == nil {
+		t.Error("Combine accepted two shares with the same index")
+	}
+}
+
+func TestCombineRejectsMalformedShares(t *testing.T) {
+	secret := randomSecret(t)
+	shares, err := Split(secret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zeroIndex := append([]byte(nil), shares[1]...)
+	zeroIndex[len(zeroIndex)-1] = 0
+
+	for name, malformed := range map[string][][]byte{
+		"different lengths": {shares[0], shares[1][1:]},
+		"zero index":        {shares[0], zeroIndex},
+		"too short":         {{1}, {2}},
+	} {
+		if _, err := Combine(malformed); err == nil {
+			t.Errorf("Combine accepted shares with %s", name)
+		}
+	}
+}
+
+func TestSplitRejectsInvalidParameters(t *testing.T) {
+	secret := randomSecret(t)
+	for _, test := range []struct{ parts, threshold int }{
+		{1, 1},
+		{3, 1},
+		{3, 0},
+		{2, 3},
+		{256, 2},
+		{-1, 2},
+	} {
+		if _, err := Split(secret, test.parts, test.threshold); err == nil {
+			t.Errorf("Split accepted %d shares with threshold %d", test.parts, test.threshold)
+		}
+	}
+
+	if _, err := Split(nil, 3, 2); err == nil {
+		t.Error("Split accepted an empty secret")
+	}
+}
@@ -0,0 +1,129 @@
+package format
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"gcipher/internal/server/api"
+	"net/http"
+	"strings"
+)
+
+// keyUsageNames lists the key usage bits in the order of RFC 5280
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "keyCertSign"},
+	{x509.KeyUsageCRLSign, "cRLSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+// WriteCertificate writes the certificate in one of the PEM, DER, Chain or PKCS7 formats.
+// The JSON formats are wrapped in the response envelope and therefore written by the caller.
+func WriteCertificate(w http.ResponseWriter, code int, format string, cert *x509.Certificate, chain []*x509.Certificate) error {
+	filename := fmt.Sprintf("%x", cert.SerialNumber)
+
+	switch format {
+	case PEM:
+		write(w, code, "application/x-pem-file", filename+".pem", encodePEM(cert))
+	case DER:
+		write(w, code, "application/pkix-cert", filename+".cer", cert.Raw)
+	case Chain:
+		bundle := encodePEM(cert)
+		for _, caCert := range chain {
+			bundle = append(bundle, encodePEM(caCert)...)
+		}
+		write(w, code, "application/pem-certificate-chain", filename+".pem", bundle)
+	case PKCS7:
+		p7, err := EncodePKCS7(append([]*x509.Certificate{cert}, chain...))
+		if err != nil {
+			return err
+		}
+		write(w, code, "application/pkcs7-mime; smime-type=certs-only", filename+".p7c", p7)
+	default:
+		return fmt.Errorf("unsupported certificate format: %s", format)
+	}
+
+	return nil
+}
+
+// DecodeCertificate returns the decoded view of a certificate.
+func DecodeCertificate(cert *x509.Certificate) api.CertificateDetails {
+	details := api.CertificateDetails{
+		SerialNumber:       fmt.Sprintf("%x", cert.SerialNumber),
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DNSNames:           cert.DNSNames,
+		EmailAddresses:     cert.EmailAddresses,
+		IsCA:               cert.IsCA,
+		PublicKeyAlgorithm: cert.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		Fingerprints:       fingerprints(cert.Raw),
+	}
+
+	for _, ip := range cert.IPAddresses {
+		details.IPAddresses = append(details.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		details.URIs = append(details.URIs, uri.String())
+	}
+	for _, ku := range keyUsageNames {
+		if cert.KeyUsage&ku.usage != 0 {
+			details.KeyUsage = append(details.KeyUsage, ku.name)
+		}
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		name, ok := extKeyUsageNames[eku]
+		if !ok {
+			name = fmt.Sprintf("unknown(%d)", eku)
+		}
+		details.ExtKeyUsage = append(details.ExtKeyUsage, name)
+	}
+
+	return details
+}
+
+func encodePEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// fingerprints returns the colon separated SHA-1 and SHA-256 digests of the DER encoding,
+// as printed by "openssl x509 -fingerprint".
+func fingerprints(der []byte) api.Fingerprints {
+	sha1Sum := sha1.Sum(der)
+	sha256Sum := sha256.Sum256(der)
+	return api.Fingerprints{
+		SHA1:   colonHex(sha1Sum[:]),
+		SHA256: colonHex(sha256Sum[:]),
+	}
+}
+
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[i] = strings.ToUpper(hex.EncodeToString(b[i : i+1]))
+	}
+	return strings.Join(parts, ":")
+}
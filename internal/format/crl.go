@@ -0,0 +1,49 @@
+package format
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"gcipher/internal/server/api"
+	"net/http"
+)
+
+// WriteCRL writes the DER encoded CRL in the DER or PEM format. The Decoded format is
+// wrapped in the response envelope and therefore written by the caller.
+func WriteCRL(w http.ResponseWriter, format string, der []byte) error {
+	switch format {
+	case DER:
+		write(w, http.StatusOK, "application/pkix-crl", "crl.crl", der)
+	case PEM:
+		write(w, http.StatusOK, "application/x-pem-file", "crl.pem", pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}))
+	default:
+		return fmt.Errorf("unsupported CRL format: %s", format)
+	}
+	return nil
+}
+
+// DecodeCRL returns the decoded view of a CRL.
+func DecodeCRL(crl *x509.RevocationList) api.CRLDetails {
+	details := api.CRLDetails{
+		Issuer:              crl.Issuer.String(),
+		ThisUpdate:          crl.ThisUpdate,
+		NextUpdate:          crl.NextUpdate,
+		SignatureAlgorithm:  crl.SignatureAlgorithm.String(),
+		RevokedCertificates: make([]api.RevokedCertDetail, 0, len(crl.RevokedCertificateEntries)),
+		Fingerprints:        fingerprints(crl.Raw),
+	}
+
+	if crl.Number != nil {
+		details.Number = fmt.Sprintf("%x", crl.Number)
+	}
+
+	for _, entry := range crl.RevokedCertificateEntries {
+		details.RevokedCertificates = append(details.RevokedCertificates, api.RevokedCertDetail{
+			SerialNumber:   fmt.Sprintf("%x", entry.SerialNumber),
+			RevocationTime: entry.RevocationTime,
+			ReasonCode:     entry.ReasonCode,
+		})
+	}
+
+	return details
+}
@@ -0,0 +1,144 @@
+// Package format encodes certificates and CRLs in the representations offered by the API
+// and negotiates the representation with the client.
+package format
+
+import (
+	"gcipher/internal/server/api"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported representations
+const (
+	JSON    = "json"    // Response envelope carrying the PEM encoding
+	Decoded = "decoded" // Response envelope carrying the decoded fields
+	PEM     = "pem"
+	DER     = "der"
+	Chain   = "chain" // PEM bundle of the certificate followed by the CA chain
+	PKCS7   = "pkcs7" // Degenerate PKCS#7 SignedData containing the certificate and the CA chain
+)
+
+// Offer is a representation a handler can produce. Offers with an empty media type can
+// only be selected using the format parameter.
+type Offer struct {
+	Format    string
+	MediaType string
+}
+
+// CertificateOffers are the representations of a certificate, the first one is the default
+var CertificateOffers = []Offer{
+	{Format: JSON, MediaType: "application/json"},
+	{Format: Decoded},
+	{Format: PEM, MediaType: "application/x-pem-file"},
+	{Format: DER, MediaType: "application/pkix-cert"},
+	{Format: Chain, MediaType: "application/pem-certificate-chain"},
+	{Format: PKCS7, MediaType: "application/pkcs7-mime"},
+	{Format: PKCS7, MediaType: "application/x-pkcs7-certificates"},
+}
+
+// CRLOffers are the representations of a CRL, the first one is the default
+var CRLOffers = []Offer{
+	{Format: DER, MediaType: "application/pkix-crl"},
+	{Format: PEM, MediaType: "application/x-pem-file"},
+	{Format: Decoded, MediaType: "application/json"},
+}
+
+// Negotiate selects the representation of the response. An explicit format query parameter
+// takes precedence over the Accept header, which may use */* and type/* wildcards; without
+// either the first offer is used.
+func Negotiate(r *http.Request, offers []Offer) (string, error) {
+	if requested := r.URL.Query().Get("format"); requested != "" {
+		for _, offer := range offers {
+			if offer.Format == requested {
+				return offer.Format, nil
+			}
+		}
+		return "", api.NewStatusError(http.StatusBadRequest, "Unsupported format: "+requested, nil)
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0].Format, nil
+	}
+
+	accepted, refused := parseAccept(accept)
+	for _, mediaType := range accepted {
+		for _, offer := range offers {
+			if offer.MediaType == "" || refused[offer.MediaType] {
+				continue
+			}
+			if matches(mediaType, offer.MediaType) {
+				return offer.Format, nil
+			}
+		}
+	}
+
+	return "", api.NewStatusError(http.StatusNotAcceptable, "None of the accepted media types can be produced", nil)
+}
+
+// matches reports whether an accepted media type, which may be */* or a type/* wildcard,
+// covers the media type of an offer.
+func matches(accepted, mediaType string) bool {
+	if accepted == "*/*" || accepted == mediaType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(accepted, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return false
+}
+
+// parseAccept returns the media types of an Accept header ordered by their quality and
+// the media types explicitly refused with a quality of 0.
+func parseAccept(header string) ([]string, map[string]bool) {
+	type entry struct {
+		mediaType string
+		quality   float64
+	}
+
+	var entries []entry
+	refused := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.TrimSpace(key) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality <= 0 {
+			refused[mediaType] = true
+			continue
+		}
+
+		entries = append(entries, entry{mediaType: mediaType, quality: quality})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].quality > entries[j].quality
+	})
+
+	mediaTypes := make([]string, 0, len(entries))
+	for _, e := range entries {
+		mediaTypes = append(mediaTypes, e.mediaType)
+	}
+	return mediaTypes, refused
+}
+
+// write sends an encoded body with the given content type as attachment.
+func write(w http.ResponseWriter, code int, contentType, filename string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.WriteHeader(code)
+	w.Write(body)
+}
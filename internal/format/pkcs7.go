@@ -0,0 +1,88 @@
+package format
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      asn1.RawValue
+}
+
+// EncodePKCS7 returns a certs-only PKCS#7 structure (RFC 2315), a SignedData without content
+// and signers, as produced by "openssl crl2pkcs7 -nocrl".
+func EncodePKCS7(certs []*x509.Certificate) ([]byte, error) {
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: []byte{}}
+
+	signed, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      contentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      emptySet,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signed},
+	})
+}
+
+// signedDataCerts is a SignedData with optional certificates and CRLs, only the certificates are used
+type signedDataCerts struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// DecodePKCS7 returns the certificates of a DER encoded PKCS#7 SignedData structure, such as
+// .p7b/.p7c files. Signatures are not verified.
+func DecodePKCS7(der []byte) ([]*x509.Certificate, error) {
+	var info contentInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 content info: %v", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after PKCS#7 content info")
+	}
+
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unsupported PKCS#7 content type %v", info.ContentType)
+	}
+
+	var signed signedDataCerts
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &signed); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signed data: %v", err)
+	}
+
+	if len(signed.Certificates.Bytes) == 0 {
+		return nil, nil
+	}
+	return x509.ParseCertificates(signed.Certificates.Bytes)
+}
@@ -0,0 +1,90 @@
+package grpcserver
+
+import (
+	"context"
+	"gcipher/internal/db/models"
+	"gcipher/internal/logging"
+	"gcipher/internal/user"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type userKey struct{}
+
+// userFromContext returns the user authenticated by the interceptors.
+func userFromContext(ctx context.Context) *models.User {
+	authUser, _ := ctx.Value(userKey{}).(*models.User)
+	return authUser
+}
+
+func unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func streamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticate identifies the caller by API token or, failing that, by verified client certificate.
+func authenticate(ctx context.Context, method string) (context.Context, error) {
+	var requestID string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(strings.ToLower(logging.RequestIDHeader)); len(values) > 0 {
+		requestID = values[0]
+	}
+	ctx = logging.NewContext(ctx, requestID)
+
+	authUser, err := authenticateCaller(ctx, md)
+	if err != nil {
+		slog.WarnContext(ctx, "gRPC authentication failed", "method", method, "error", err)
+		return nil, status.Error(codes.Unauthenticated, "Unauthenticated")
+	}
+
+	logging.SetUsername(ctx, authUser.Username)
+	slog.InfoContext(ctx, "gRPC call", "method", method)
+
+	return context.WithValue(ctx, userKey{}, authUser), nil
+}
+
+func authenticateCaller(ctx context.Context, md metadata.MD) (*models.User, error) {
+	if values := md.Get("authorization"); len(values) > 0 {
+		token, ok := strings.CutPrefix(values[0], "Bearer ")
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "unsupported authorization scheme")
+		}
+		return user.AuthenticateToken(token)
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			return user.AuthenticateCertificate(tlsInfo.State.VerifiedChains[0][0])
+		}
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "missing credentials")
+}
+
+// authenticatedStream replaces the context of a stream with the authenticated one.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,92 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"gcipher/internal/config"
+	pb "gcipher/pkg/pb/gcipher/v1"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Server is a running gRPC server
+type Server struct {
+	srv *grpc.Server
+}
+
+// Start serves the gRPC API on the configured port in the background.
+// If a TLS certificate is configured, clients may authenticate using certificates issued by the CA.
+func Start(cfg *config.Config) (*Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryAuthInterceptor),
+		grpc.ChainStreamInterceptor(streamAuthInterceptor),
+	}
+
+	if cfg.GRPCTLSCertPath != "" && cfg.GRPCTLSKeyPath != "" {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else {
+		slog.Warn("gRPC server is running without TLS, only API tokens can be used for authentication")
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+	if err != nil {
+		return nil, err
+	}
+
+	srv := grpc.NewServer(opts...)
+	pb.RegisterCertificateServiceServer(srv, &certificateService{})
+
+	go func() {
+		slog.Info("gRPC server listening", "addr", listener.Addr().String())
+		if err := srv.Serve(listener); err != nil {
+			slog.Error("gRPC server error", "error", err)
+		}
+	}()
+
+	return &Server{srv: srv}, nil
+}
+
+// Shutdown stops accepting new calls and waits for pending ones. Calls still running
+// when ctx is done, such as revocation watches, are cancelled.
+func (s *Server) Shutdown(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.srv.Stop()
+	}
+}
+
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	serverCert, err := tls.LoadX509KeyPair(cfg.GRPCTLSCertPath, cfg.GRPCTLSKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gRPC TLS key pair: %v", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cfg.CACert)
+	if cfg.IntermediateCert != nil {
+		clientCAs.AddCert(cfg.IntermediateCert)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
@@ -0,0 +1,209 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"gcipher/internal/certificate"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	ocsp "gcipher/internal/oscp"
+	"gcipher/internal/server/api"
+	pb "gcipher/pkg/pb/gcipher/v1"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// certificateService implements the gRPC CertificateService on top of the certificate package.
+type certificateService struct {
+	pb.UnimplementedCertificateServiceServer
+}
+
+func (s *certificateService) IssueCertificate(ctx context.Context, req *pb.IssueCertificateRequest) (*pb.Certificate, error) {
+	data := api.RequestData{
+		Applicant: req.GetApplicant(),
+		CSR:       base64.StdEncoding.EncodeToString(req.GetCsr()),
+		Lifetime:  int(req.GetLifetime()),
+	}
+	if req.GetType() == pb.CertificateType_CERTIFICATE_TYPE_CLIENT {
+		data.Type = "client"
+	}
+
+	cert, pending, err := certificate.SubmitCertificateRequest(ctx, userFromContext(ctx), data)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if pending != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "Certificate request %s awaits approval", pending.ID.Hex())
+	}
+	return toProto(cert), nil
+}
+
+func (s *certificateService) GetCertificate(ctx context.Context, req *pb.GetCertificateRequest) (*pb.Certificate, error) {
+	cert, err := certificate.RetrieveCertificate(ctx, userFromContext(ctx), req.GetSerialNumber())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(cert), nil
+}
+
+func (s *certificateService) RevokeCertificate(ctx context.Context, req *pb.RevokeCertificateRequest) (*pb.Certificate, error) {
+	cert, err := certificate.RevokeCertificate(ctx, userFromContext(ctx), req.GetSerialNumber())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(cert), nil
+}
+
+func (s *certificateService) ListCertificates(req *pb.ListCertificatesRequest, stream pb.CertificateService_ListCertificatesServer) error {
+	ctx := stream.Context()
+
+	var state string
+	switch req.GetState() {
+	case pb.CertificateState_CERTIFICATE_STATE_VALID:
+		state = "valid"
+	case pb.CertificateState_CERTIFICATE_STATE_REVOKED:
+		state = "revoked"
+	}
+
+	certificates, err := certificate.ListCertificates(ctx, userFromContext(ctx), state)
+	if err != nil {
+		return toStatus(err)
+	}
+
+	for i := range certificates {
+		if !strings.HasPrefix(certificates[i].SerialNumber, req.GetSerialNumberPrefix()) {
+			continue
+		}
+		if err := stream.Send(toProto(&certificates[i])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *certificateService) GetCRL(ctx context.Context, req *pb.GetCRLRequest) (*pb.CRL, error) {
+	crl, err := ocsp.CurrentCRL()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to retrieve CRL", "error", err)
+		return nil, status.Error(codes.Unavailable, "Failed to retrieve CRL")
+	}
+
+	revocationList, err := x509.ParseRevocationList(crl.CRLBytes)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to parse CRL", "error", err)
+		return nil, status.Error(codes.Internal, "Failed to parse CRL")
+	}
+
+	return &pb.CRL{
+		Der:        crl.CRLBytes,
+		ThisUpdate: timestamppb.New(revocationList.ThisUpdate),
+		NextUpdate: timestamppb.New(revocationList.NextUpdate),
+	}, nil
+}
+
+// WatchRevocations streams the revocations of the caller's certificates, admins receive the
+// revocations of all users.
+func (s *certificateService) WatchRevocations(req *pb.WatchRevocationsRequest, stream pb.CertificateService_WatchRevocationsServer) error {
+	ctx := stream.Context()
+	caller := userFromContext(ctx)
+	visible := func(username string) bool {
+		return caller.IsAdmin() || username == caller.Username
+	}
+
+	// Subscribe before replaying so no revocation falls in between
+	events, cancel := certificate.SubscribeRevocations()
+	defer cancel()
+
+	if req.GetSince() != nil {
+		since := req.GetSince().AsTime()
+
+		revoked, err := repositories.GetCertificateRepository().GetRevokedCertificates()
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to retrieve revoked certificates", "error", err)
+			return status.Error(codes.Internal, "Failed to retrieve revoked certificates")
+		}
+
+		for _, cert := range revoked {
+			if cert.RevokedAt == nil || !cert.RevokedAt.After(since) || !visible(cert.Username) {
+				continue
+			}
+			event := &pb.RevocationEvent{
+				SerialNumber: cert.SerialNumber,
+				Username:     cert.Username,
+				RevokedAt:    timestamppb.New(*cert.RevokedAt),
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if !visible(event.Username) {
+				continue
+			}
+			err := stream.Send(&pb.RevocationEvent{
+				SerialNumber: event.SerialNumber,
+				Username:     event.Username,
+				RevokedAt:    timestamppb.New(event.RevokedAt),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toProto(cert *models.Certificate) *pb.Certificate {
+	result := &pb.Certificate{
+		SerialNumber:   cert.SerialNumber,
+		CertificatePem: string(cert.CertificatePEM),
+	}
+	if cert.RevokedAt != nil {
+		result.RevokedAt = timestamppb.New(*cert.RevokedAt)
+	}
+	return result
+}
+
+// toStatus converts an error returned by the shared operations to a gRPC status.
+func toStatus(err error) error {
+	var statusErr *api.StatusError
+	if !errors.As(err, &statusErr) {
+		return status.Error(codes.Internal, "Internal server error")
+	}
+
+	var code codes.Code
+	switch statusErr.Code {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	default:
+		code = codes.Internal
+	}
+
+	return status.Error(code, statusErr.Message)
+}
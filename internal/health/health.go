@@ -0,0 +1,239 @@
+package health
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db"
+	ocsp "gcipher/internal/oscp"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// CheckTimeout bounds the time a single readiness check may take
+const CheckTimeout = 2 * time.Second
+
+// CAKeyCheckInterval is the time the result of the CA key check is reused. Every check signs
+// with the CA key, which may be an HSM operation, so probes mustn't trigger one each.
+const CAKeyCheckInterval = 5 * time.Minute
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check is the result of a single readiness check
+type Check struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the body returned by the health endpoints
+type Report struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+type checkFunc func(ctx context.Context) error
+
+var readinessChecks = map[string]checkFunc{
+	"database":       checkDatabase,
+	"ca_key":         checkCAKey,
+	"ca_certificate": checkCACertificate,
+	"crl":            checkCRL,
+}
+
+// HandleHealthz reports whether the process is alive. It doesn't touch any dependency.
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// HandleReadyz runs all readiness checks and reports their individual results.
+// The endpoint answers 503 if any of the checks fails.
+func HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := Report{Status: StatusOK, Checks: make(map[string]Check, len(readinessChecks))}
+
+	for name, check := range readinessChecks {
+		ctx, cancel := context.WithTimeout(r.Context(), CheckTimeout)
+		start := time.Now()
+		err := runCheck(ctx, check)
+		cancel()
+
+		result := Check{Status: StatusOK, Duration: time.Since(start).String()}
+		if err != nil {
+			slog.WarnContext(r.Context(), "Readiness check failed", "check", name, "error", err)
+			result.Status = StatusFail
+			result.Error = err.Error()
+			report.Status = StatusFail
+		}
+		report.Checks[name] = result
+	}
+
+	code := http.StatusOK
+	if report.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	writeReport(w, code, report)
+}
+
+// runCheck runs a check and gives up once the context is done, even if the check itself
+// doesn't honor it.
+func runCheck(ctx context.Context, check checkFunc) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- check(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("check didn't finish in time: %v", ctx.Err())
+	}
+}
+
+func writeReport(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
+
+func checkDatabase(ctx context.Context) error {
+	client, err := db.GetDBClient()
+	if err != nil {
+		return err
+	}
+	return client.Ping(ctx, readpref.Primary())
+}
+
+// caKeyCheck caches the result of the last test signature with the CA key. A new signature
+// is made once the result is older than CAKeyCheckInterval or the CA key was reloaded, and
+// concurrent probes wait for the same signature.
+var caKeyCheck struct {
+	mu        sync.Mutex
+	cert      *x509.Certificate
+	signer    crypto.Signer
+	checkedAt time.Time
+	err       error
+	running   chan struct{}
+}
+
+// checkCAKey reports whether the CA key can sign and matches the CA certificate.
+func checkCAKey(ctx context.Context) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	signer, ok := cfg.CAKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("CA key of type %T cannot sign", cfg.CAKey)
+	}
+
+	caKeyCheck.mu.Lock()
+	if caKeyCheck.cert == cfg.CACert && caKeyCheck.signer == signer && time.Since(caKeyCheck.checkedAt) < CAKeyCheckInterval {
+		err := caKeyCheck.err
+		caKeyCheck.mu.Unlock()
+		return err
+	}
+	if caKeyCheck.running == nil {
+		caKeyCheck.running = make(chan struct{})
+		go testCAKey(cfg.CACert, signer, caKeyCheck.running)
+	}
+	running := caKeyCheck.running
+	caKeyCheck.mu.Unlock()
+
+	select {
+	case <-running:
+		caKeyCheck.mu.Lock()
+		defer caKeyCheck.mu.Unlock()
+		return caKeyCheck.err
+	case <-ctx.Done():
+		return fmt.Errorf("test signature didn't finish in time: %v", ctx.Err())
+	}
+}
+
+// testCAKey makes a test signature, records the result and closes done.
+func testCAKey(cert *x509.Certificate, signer crypto.Signer, done chan struct{}) {
+	err := testSignature(cert, signer)
+
+	caKeyCheck.mu.Lock()
+	defer caKeyCheck.mu.Unlock()
+	caKeyCheck.cert, caKeyCheck.signer = cert, signer
+	caKeyCheck.checkedAt, caKeyCheck.err = time.Now(), err
+	caKeyCheck.running = nil
+	close(done)
+}
+
+// testSignature creates a test signature with the CA key and verifies it against the CA certificate.
+func testSignature(cert *x509.Certificate, signer crypto.Signer) error {
+	var algorithm x509.SignatureAlgorithm
+	switch cert.PublicKeyAlgorithm {
+	case x509.RSA:
+		algorithm = x509.SHA256WithRSA
+	case x509.ECDSA:
+		algorithm = x509.ECDSAWithSHA256
+	default:
+		return fmt.Errorf("unsupported CA public key algorithm: %v", cert.PublicKeyAlgorithm)
+	}
+
+	message := make([]byte, 32)
+	if _, err := rand.Read(message); err != nil {
+		return err
+	}
+	digest := sha256.Sum256(message)
+
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("test signature failed: %v", err)
+	}
+
+	if err := cert.CheckSignature(algorithm, message, signature); err != nil {
+		return fmt.Errorf("CA key does not match CA certificate: %v", err)
+	}
+	return nil
+}
+
+func checkCACertificate(ctx context.Context) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if now.Before(cfg.CACert.NotBefore) {
+		return fmt.Errorf("CA certificate is not valid before %s", cfg.CACert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cfg.CACert.NotAfter) {
+		return fmt.Errorf("CA certificate expired at %s", cfg.CACert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func checkCRL(ctx context.Context) error {
+	crl, err := ocsp.CurrentCRL()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve latest CRL: %v", err)
+	}
+
+	revocationList, err := x509.ParseRevocationList(crl.CRLBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse latest CRL: %v", err)
+	}
+
+	if time.Now().After(revocationList.NextUpdate) {
+		return fmt.Errorf("CRL is past its NextUpdate at %s", revocationList.NextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"gcipher/internal/config"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Supported values for the log_output configuration option
+const (
+	OutputStdout  = "stdout"
+	OutputFile    = "file"
+	OutputMongoDB = "mongodb"
+)
+
+// redactedKeys lists attribute keys whose values must never end up in a log sink.
+var redactedKeys = []string{"password", "passphrase", "secret", "token", "authorization"}
+
+// Setup replaces the default slog logger with one built from the configuration.
+// The sink is used when the mongodb output is enabled and may be nil otherwise.
+func Setup(cfg *config.Config, sink io.Writer) error {
+	level, err := parseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}
+
+	var handlers []slog.Handler
+	for _, output := range strings.Split(cfg.LogOutput, ",") {
+		switch strings.TrimSpace(output) {
+		case "", OutputStdout:
+			handlers = append(handlers, newHandler(os.Stdout, cfg.LogFormat, opts))
+		case OutputFile:
+			file, err := NewRotatingFile(cfg.LogFilePath, cfg.LogFileMaxSize, cfg.LogFileMaxBackups)
+			if err != nil {
+				return fmt.Errorf("failed to open log file: %v", err)
+			}
+			handlers = append(handlers, newHandler(file, cfg.LogFormat, opts))
+		case OutputMongoDB:
+			if sink == nil {
+				return fmt.Errorf("mongodb log output requested but no sink is available")
+			}
+			// Records stored in MongoDB are always JSON so they can be decoded into documents
+			handlers = append(handlers, slog.NewJSONHandler(sink, opts))
+		default:
+			return fmt.Errorf("unsupported log output: %s", output)
+		}
+	}
+
+	slog.SetDefault(slog.New(&contextHandler{handler: fanout(handlers)}))
+	return nil
+}
+
+func newHandler(w io.Writer, format string, opts *slog.HandlerOptions) slog.Handler {
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+func parseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unsupported log level: %s", level)
+	}
+}
+
+// redact replaces the value of any attribute that looks like it carries a secret.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, k := range redactedKeys {
+		if strings.Contains(key, k) {
+			return slog.String(a.Key, "[REDACTED]")
+		}
+	}
+	return a
+}
+
+// contextHandler adds the request-scoped fields stored in the context to every record.
+type contextHandler struct {
+	handler slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if fields := fieldsFromContext(ctx); fields != nil {
+		record.AddAttrs(slog.String("request_id", fields.requestID))
+		if username := fields.getUsername(); username != "" {
+			record.AddAttrs(slog.String("username", username))
+		}
+	}
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{handler: h.handler.WithGroup(name)}
+}
+
+// multiHandler dispatches every record to all of its handlers.
+type multiHandler []slog.Handler
+
+func fanout(handlers []slog.Handler) slog.Handler {
+	if len(handlers) == 1 {
+		return handlers[0]
+	}
+	return multiHandler(handlers)
+}
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+	for _, h := range m {
+		if !h.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, record.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, 0, len(m))
+	for _, h := range m {
+		handlers = append(handlers, h.WithAttrs(attrs))
+	}
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, 0, len(m))
+	for _, h := range m {
+		handlers = append(handlers, h.WithGroup(name))
+	}
+	return handlers
+}
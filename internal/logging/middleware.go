@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader is the header used to propagate request IDs
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey struct{}
+
+// requestFields holds the request-scoped values attached to log records.
+// The username is only known after authentication, so it is set later on.
+type requestFields struct {
+	requestID string
+
+	mu       sync.Mutex
+	username string
+}
+
+func (f *requestFields) getUsername() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.username
+}
+
+func fieldsFromContext(ctx context.Context) *requestFields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(contextKey{}).(*requestFields)
+	return fields
+}
+
+// NewContext returns a context carrying the request-scoped logging fields for a new request.
+// An empty requestID is replaced by a random one.
+func NewContext(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	return context.WithValue(ctx, contextKey{}, &requestFields{requestID: requestID})
+}
+
+// SetUsername records the authenticated user for all subsequent log records of the request.
+func SetUsername(ctx context.Context, username string) {
+	if fields := fieldsFromContext(ctx); fields != nil {
+		fields.mu.Lock()
+		fields.username = username
+		fields.mu.Unlock()
+	}
+}
+
+// RequestID returns the ID assigned to the request by the middleware, if any.
+func RequestID(ctx context.Context) string {
+	if fields := fieldsFromContext(ctx); fields != nil {
+		return fields.requestID
+	}
+	return ""
+}
+
+// Middleware assigns a request ID to every request and logs its outcome.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := NewContext(r.Context(), r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, RequestID(ctx))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		slog.InfoContext(ctx, "Request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
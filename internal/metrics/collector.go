@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"crypto/x509"
+	"gcipher/internal/db/models"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ExpiryWindows are the windows for which certificates nearing expiry are reported
+var ExpiryWindows = map[string]time.Duration{
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// CertificateSource counts the certificates on every scrape. The counts are taken from the
+// stored expiry dates, certificates aren't parsed.
+type CertificateSource interface {
+	CountExpiring(from, to time.Time) (int, error)
+}
+
+// CRLSource provides the CRL of the signing CA generation inspected on every scrape
+type CRLSource interface {
+	CurrentCRL() (*models.CRL, error)
+}
+
+// StateCollector reports gauges derived from the stored certificates and CRLs.
+// The values are computed when Prometheus scrapes the endpoint.
+type StateCollector struct {
+	certs CertificateSource
+	crls  CRLSource
+
+	expiringDesc   *prometheus.Desc
+	crlAgeDesc     *prometheus.Desc
+	crlNextUpdDesc *prometheus.Desc
+}
+
+func NewStateCollector(certs CertificateSource, crls CRLSource) *StateCollector {
+	return &StateCollector{
+		certs: certs,
+		crls:  crls,
+		expiringDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "certificates_expiring"),
+			"Number of valid certificates expiring within the given window.",
+			[]string{"within"}, nil,
+		),
+		crlAgeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "crl_age_seconds"),
+			"Seconds since the ThisUpdate time of the CRL of the signing CA generation.",
+			nil, nil,
+		),
+		crlNextUpdDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "crl_next_update_seconds"),
+			"Seconds until the NextUpdate time of the CRL of the signing CA generation, negative if overdue.",
+			nil, nil,
+		),
+	}
+}
+
+// RegisterStateCollector registers a StateCollector with the default registry.
+func RegisterStateCollector(certs CertificateSource, crls CRLSource) {
+	prometheus.MustRegister(NewStateCollector(certs, crls))
+}
+
+func (c *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.expiringDesc
+	ch <- c.crlAgeDesc
+	ch <- c.crlNextUpdDesc
+}
+
+func (c *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+
+	for window, d := range ExpiryWindows {
+		expiring, err := c.certs.CountExpiring(now, now.Add(d))
+		if err != nil {
+			slog.Error("Failed to collect certificate metrics", "error", err)
+			break
+		}
+		ch <- prometheus.MustNewConstMetric(c.expiringDesc, prometheus.GaugeValue, float64(expiring), window)
+	}
+
+	crl, err := c.crls.CurrentCRL()
+	if err != nil {
+		// No CRL has been generated for the signing CA generation yet
+		return
+	}
+
+	revocationList, err := x509.ParseRevocationList(crl.CRLBytes)
+	if err != nil {
+		slog.Error("Failed to parse current CRL", "error", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.crlAgeDesc, prometheus.GaugeValue, now.Sub(revocationList.ThisUpdate).Seconds())
+	ch <- prometheus.MustNewConstMetric(c.crlNextUpdDesc, prometheus.GaugeValue, revocationList.NextUpdate.Sub(now).Seconds())
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "gcipher"
+
+var (
+	// CertificatesIssued counts issued certificates by profile and owner
+	CertificatesIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "certificates_issued_total",
+		Help:      "Number of certificates issued.",
+	}, []string{"profile", "user"})
+
+	// CertificatesRevoked counts revoked certificates by profile and owner
+	CertificatesRevoked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "certificates_revoked_total",
+		Help:      "Number of certificates revoked.",
+	}, []string{"profile", "user"})
+
+	// AuthFailures counts failed authentication attempts by credential profile (password, token
+	// or certificate) and user. Unknown usernames are reported as "unknown" to keep the label
+	// cardinality bounded.
+	AuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Number of failed authentication attempts.",
+	}, []string{"profile", "user"})
+
+	// RateLimited counts requests rejected by a rate limit by scope (ip, user or token)
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Number of requests rejected by a rate limit.",
+	}, []string{"scope"})
+
+	// SigningDuration observes the time spent creating signatures with the CA key
+	SigningDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "signing_duration_seconds",
+		Help:      "Time spent signing certificates and CRLs.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// DBCommandDuration observes the latency of MongoDB commands
+	DBCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_command_duration_seconds",
+		Help:      "Latency of MongoDB commands.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command", "outcome"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests handled.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
@@ -2,25 +2,34 @@ package ocsp
 
 import (
 	"crypto"
-	"crypto/ecdsa"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/pem"
+	"encoding/asn1"
+	"encoding/hex"
 	"fmt"
 	"gcipher/internal/config"
 	"gcipher/internal/db/models"
 	"gcipher/internal/db/repositories"
+	"gcipher/internal/format"
+	"gcipher/internal/metrics"
 	"gcipher/internal/server/api"
+	"gcipher/internal/util"
+	"log/slog"
 	"math/big"
 	"net/http"
+	"strings"
 	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // CRLUpdateInterval is the interval at which the CRL should be generated/updated
 const CRLUpdateInterval = 24 * time.Hour // Generate/update CRL every 24 hours
 
+// oidInvalidityDate identifies the invalidity date CRL entry extension (RFC 5280, section 5.3.2)
+var oidInvalidityDate = asn1.ObjectIdentifier{2, 5, 29, 24}
+
 func StartCRLUpdater() {
 	// Start a goroutine to periodically generate/update the CRL
 	go func() {
@@ -31,91 +40,274 @@ func StartCRLUpdater() {
 	}()
 }
 
+// HandleCRL serves the CRL of the current CA generation, or of the generation given by the
+// keyid path value. It is DER encoded by default, PEM and a decoded JSON view are available
+// using the format parameter or the Accept header.
 func HandleCRL(w http.ResponseWriter, r *http.Request) {
-	crl, err := repositories.GetCRLRepository().FindLatest()
+	outputFormat, err := format.Negotiate(r, format.CRLOffers)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	var crl *models.CRL
+	if keyID := r.PathValue("keyid"); keyID != "" {
+		crl, err = repositories.GetCRLRepository().FindByIssuer(strings.ToLower(keyID))
+	} else {
+		crl, err = CurrentCRL()
+	}
+	if err == mongo.ErrNoDocuments {
+		api.EncodeErrorResponse(w, http.StatusNotFound, "No CRL published for this CA key")
+		return
+	}
 	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to retrieve CRL", "error", err)
 		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve CRL")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/pkix-crl")
-	w.Header().Set("Content-Disposition", "attachment; filename=crl.crl")
+	if outputFormat == format.Decoded {
+		revocationList, err := x509.ParseRevocationList(crl.CRLBytes)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to parse CRL", "error", err)
+			api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to parse CRL")
+			return
+		}
+		api.EncodeResponse(w, format.DecodeCRL(revocationList))
+		return
+	}
+
+	format.WriteCRL(w, outputFormat, crl.CRLBytes)
+}
+
+// CurrentCRL returns the latest CRL of the CA generation that signs new certificates.
+func CurrentCRL() (*models.CRL, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return repositories.GetCRLRepository().FindByIssuer(util.KeyID(cfg.CACert))
+}
+
+// CurrentCRLSource provides the CRL of the signing CA generation to the metrics collector.
+type CurrentCRLSource struct{}
+
+func (CurrentCRLSource) CurrentCRL() (*models.CRL, error) {
+	return CurrentCRL()
+}
+
+// HandleCAGenerations lists the generations of the signing CA and whether a CRL is published
+// for them.
+func HandleCAGenerations(w http.ResponseWriter, r *http.Request) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get config", "error", err)
+		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to list CA generations")
+		return
+	}
+
+	crlRepo := repositories.GetCRLRepository()
+	generations := []api.CAGenerationDetails{}
+	for _, generation := range cfg.CAGenerations {
+		keyID := util.KeyID(generation.Cert)
+		_, err := crlRepo.FindByIssuer(keyID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			slog.ErrorContext(r.Context(), "Failed to retrieve CRL", "keyid", keyID, "error", err)
+			api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to list CA generations")
+			return
+		}
 
-	// Encode CRL bytes to PEM format
-	pemBlock := &pem.Block{
-		Type:  "X509 CRL",
-		Bytes: crl.CRLBytes,
+		generations = append(generations, api.CAGenerationDetails{
+			KeyID:        keyID,
+			Subject:      generation.Cert.Subject.String(),
+			SerialNumber: fmt.Sprintf("%x", generation.Cert.SerialNumber),
+			NotBefore:    generation.Cert.NotBefore,
+			NotAfter:     generation.Cert.NotAfter,
+			Current:      generation.Cert.Equal(cfg.CACert),
+			CRLPublished: err == nil,
+		})
 	}
-	pem.Encode(w, pemBlock)
+
+	api.EncodeResponse(w, generations)
 }
 
+// updateCRL publishes a CRL for every CA generation that is either the current one or still
+// has certificates that haven't expired. Each CRL lists the revoked certificates signed by its
+// generation. Revoked certificates of other issuers, e.g. imported from another CA, are left
+// out, a CRL signed by the wrong CA would not revoke them.
 func updateCRL() {
 	cfg, err := config.GetConfig()
 	if err != nil {
-		fmt.Println("Failed to get config:", err)
+		slog.Error("Failed to get config", "error", err)
 		return
 	}
 
 	certRepo := repositories.GetCertificateRepository()
+	if err := attributeCertificates(certRepo); err != nil {
+		slog.Error("Failed to record issuing CA generations", "error", err)
+	}
+
 	revokedCerts, err := certRepo.GetRevokedCertificates()
 	if err != nil {
-		fmt.Println("Failed to get revoked certificates:", err)
+		slog.Error("Failed to get revoked certificates", "error", err)
 		return
 	}
 
-	var crlBytes []byte
+	current := util.KeyID(cfg.CACert)
+	generations := map[string]config.CAGeneration{}
+	for _, generation := range cfg.CAGenerations {
+		generations[util.KeyID(generation.Cert)] = generation
+	}
 
-	switch key := cfg.CAKey.(type) {
-	case *rsa.PrivateKey:
-		// Generate CRL using RSA private key
-		crlBytes, err = generateCRL(cfg.CACert, key, revokedCerts)
-		if err != nil {
-			fmt.Println("Failed to generate CRL:", err)
-			return
+	revokedByIssuer := map[string][]models.Certificate{}
+	foreign := 0
+	for _, cert := range revokedCerts {
+		if _, ok := generations[cert.IssuerKeyID]; !ok {
+			foreign++
+			continue
 		}
+		revokedByIssuer[cert.IssuerKeyID] = append(revokedByIssuer[cert.IssuerKeyID], cert)
+	}
+	if foreign > 0 {
+		slog.Warn("Revoked certificates of unknown issuers aren't published on a CRL", "count", foreign)
+	}
 
-	case *ecdsa.PrivateKey:
-		// Generate CRL using EC private key
-		crlBytes, err = generateCRL(cfg.CACert, key, revokedCerts)
-		if err != nil {
-			fmt.Println("Failed to generate CRL:", err)
-			return
+	now := time.Now()
+	for keyID, generation := range generations {
+		if keyID != current {
+			if now.After(generation.Cert.NotAfter) {
+				continue
+			}
+			latest, err := certRepo.LatestNotAfterByIssuer(keyID)
+			if err != nil {
+				slog.Error("Failed to look up certificates of CA generation", "keyid", keyID, "error", err)
+				continue
+			}
+			if !latest.After(now) {
+				continue
+			}
 		}
 
-	default:
-		// Handle unsupported key type
-		fmt.Println("Unsupported private key type")
+		publishCRL(keyID, generation, cfg.CAGenerations, revokedByIssuer[keyID])
+	}
+}
+
+func publishCRL(keyID string, generation config.CAGeneration, generations []config.CAGeneration, revokedCerts []models.Certificate) {
+	// Keys on a PKCS#11 token are only known as crypto.Signer
+	key, ok := generation.Key.(crypto.Signer)
+	if !ok {
+		slog.Error("Unsupported private key type", "keyid", keyID, "type", fmt.Sprintf("%T", generation.Key))
+		return
+	}
+
+	crlBytes, err := generateCRL(generations, generation.Cert, key, revokedCerts)
+	if err != nil {
+		slog.Error("Failed to generate CRL", "keyid", keyID, "error", err)
 		return
 	}
 
-	crl := models.NewCRL(cfg.CACert.Issuer.SerialNumber, crlBytes)
+	crl := models.NewCRL(keyID, crlBytes)
 	err = repositories.GetCRLRepository().InsertOrUpdate(*crl)
 	if err != nil {
-		fmt.Println("Failed to insert/update CRL:", err)
+		slog.Error("Failed to insert/update CRL", "keyid", keyID, "error", err)
 		return
 	}
 }
 
-func generateCRL(cert *x509.Certificate, key crypto.Signer, revokedCerts []models.Certificate) ([]byte, error) {
+// attributeCertificates records the issuing CA generation of certificates stored before it
+// was tracked, using the authority key identifier of the certificate.
+func attributeCertificates(certRepo *repositories.CertificateRepository) error {
+	certs, err := certRepo.FindWithoutIssuerKeyID()
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range certs {
+		if err := certRepo.SetIssuerKeyID(cert.SerialNumber, util.AuthorityKeyID(cert.CertificatePEM)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func generateCRL(generations []config.CAGeneration, cert *x509.Certificate, key crypto.Signer, revokedCerts []models.Certificate) ([]byte, error) {
+	number, err := nextCRLNumber(generations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the CRL number: %v", err)
+	}
+
+	// The signature algorithm is left to x509, which derives it from the key. The algorithm of
+	// the CA certificate is the one its issuer signed with, e.g. RSA for an ECDSA intermediate.
 	template := x509.RevocationList{
-		SignatureAlgorithm:  cert.SignatureAlgorithm,
-		RevokedCertificates: []pkix.RevokedCertificate{},
-		ThisUpdate:          time.Now(),
-		NextUpdate:          time.Now().Add(CRLUpdateInterval),
+		Number:                    number,
+		RevokedCertificateEntries: []x509.RevocationListEntry{},
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(CRLUpdateInterval),
 	}
 
 	for _, cert := range revokedCerts {
 		serialNumber, _ := new(big.Int).SetString(cert.SerialNumber, 16)
-		template.RevokedCertificates = append(template.RevokedCertificates, pkix.RevokedCertificate{
+		entry := x509.RevocationListEntry{
 			SerialNumber:   serialNumber,
-			RevocationTime: time.Now(),
-		})
+			RevocationTime: *cert.RevokedAt,
+			ReasonCode:     cert.RevocationReason,
+		}
+		if cert.InvalidityDate != nil {
+			value, err := asn1.MarshalWithParams(cert.InvalidityDate.UTC(), "generalized")
+			if err != nil {
+				return nil, err
+			}
+			entry.ExtraExtensions = []pkix.Extension{{Id: oidInvalidityDate, Value: value}}
+		}
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, entry)
 	}
 
+	signingStart := time.Now()
 	crlBytes, err := x509.CreateRevocationList(rand.Reader, &template, cert, key)
+	metrics.SigningDuration.WithLabelValues("crl").Observe(time.Since(signingStart).Seconds())
 	if err != nil {
 		return nil, err
 	}
 
 	return crlBytes, nil
 }
+
+// nextCRLNumber returns the number following the highest one of the CRLs of the signing CA
+// generations. The generations share the CA name, so their CRL numbers must increase
+// monotonically together (RFC 5280, section 5.2.3). CRLs stored before generations were
+// tracked are recognized by their authority key identifier, CRLs of offline roots and other
+// CAs are ignored. Only the very first CRL gets number 1, any other failure is returned so
+// no CRL with a reused number is published.
+func nextCRLNumber(generations []config.CAGeneration) (*big.Int, error) {
+	keyIDs := map[string]bool{}
+	for _, generation := range generations {
+		keyIDs[util.KeyID(generation.Cert)] = true
+	}
+
+	stored, err := repositories.GetCRLRepository().FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	highest := new(big.Int)
+	for _, record := range stored {
+		crl, err := x509.ParseRevocationList(record.CRLBytes)
+		if !keyIDs[record.Issuer] {
+			// Not stored under a generation, only CRLs stored before generations were tracked count
+			if err != nil || !keyIDs[hex.EncodeToString(crl.AuthorityKeyId)] {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CRL of %s: %v", record.Issuer, err)
+		}
+		if crl.Number == nil {
+			return nil, fmt.Errorf("CRL of %s has no CRL number", record.Issuer)
+		}
+		if crl.Number.Cmp(highest) > 0 {
+			highest = crl.Number
+		}
+	}
+
+	return new(big.Int).Add(highest, big.NewInt(1)), nil
+}
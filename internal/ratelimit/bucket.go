@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket refilled continuously at the limiter's rate
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter hands out tokens of one bucket per key, e.g. per source IP
+type limiter struct {
+	rate  float64 // Tokens per second
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// newLimiter creates a limiter allowing perMinute requests per minute with bursts of up to
+// burst requests. It returns nil if perMinute is zero, nil limiters allow everything.
+func newLimiter(perMinute, burst int) *limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the bucket of key. If the bucket is empty it returns false and the
+// time until the next token is available.
+func (l *limiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key, now)
+	if b.tokens < 1 {
+		return false, l.wait(b)
+	}
+	b.tokens--
+	return true, 0
+}
+
+// remaining returns the number of tokens left in the bucket of key.
+func (l *limiter) remaining(key string, now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.refill(key, now).tokens)
+}
+
+// refill returns the bucket of key topped up for the time passed since its last use.
+// The caller must hold the lock.
+func (l *limiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+	return b
+}
+
+// wait returns the time until the bucket holds a token again
+func (l *limiter) wait(b *bucket) time.Duration {
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweepEvery drops the buckets that are full again at every interval until stop is closed.
+// Full buckets behave the same as missing ones.
+func (l *limiter) sweepEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			l.sweep(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sweep drops the buckets that are full again.
+func (l *limiter) sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package ratelimit limits the request rate of HTTP clients using token buckets per source IP,
+// per user and per API token. The buckets are kept in memory, so every server instance
+// enforces the limits on its own.
+package ratelimit
+
+import (
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/metrics"
+	"gcipher/internal/server/api"
+	"gcipher/internal/util"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scopes of the rate limits
+const (
+	ScopeIP    = "ip"
+	ScopeUser  = "user"
+	ScopeToken = "token"
+)
+
+// exemptPaths are never rate limited so probes and scrapes keep working under load
+var exemptPaths = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// sweepInterval is the interval at which buckets that are full again are dropped
+const sweepInterval = time.Minute
+
+var (
+	ipLimiter      *limiter
+	userLimiter    *limiter
+	tokenLimiter   *limiter
+	trustedProxies []netip.Prefix
+	stopSweeping   chan struct{}
+)
+
+// Setup configures the rate limits. Limits with a rate of zero are disabled.
+func Setup(cfg *config.Config) error {
+	trustedProxies = nil
+	for _, proxy := range cfg.TrustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %v", proxy, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trustedProxies = append(trustedProxies, prefix)
+	}
+
+	ipLimiter = newLimiter(cfg.RateLimitIP, cfg.RateLimitIPBurst)
+	userLimiter = newLimiter(cfg.RateLimitUser, cfg.RateLimitUserBurst)
+	tokenLimiter = newLimiter(cfg.RateLimitToken, cfg.RateLimitTokenBurst)
+
+	if stopSweeping != nil {
+		close(stopSweeping)
+	}
+	stopSweeping = make(chan struct{})
+	for _, l := range []*limiter{ipLimiter, userLimiter, tokenLimiter} {
+		if l != nil {
+			go l.sweepEvery(sweepInterval, stopSweeping)
+		}
+	}
+	return nil
+}
+
+// Middleware rejects requests exceeding a rate limit with 429 and a Retry-After header. Requests
+// are limited by source IP and, before authentication takes place, by the API token. The user
+// limit is charged by AllowUser when the password is verified.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		for _, key := range keysOf(r) {
+			if key.scope == ScopeUser {
+				continue
+			}
+
+			ok, retryAfter := key.limiter.allow(key.value, now)
+			if ok {
+				continue
+			}
+
+			metrics.RateLimited.WithLabelValues(key.scope).Inc()
+			slog.WarnContext(r.Context(), "Rate limit exceeded", "scope", key.scope, "ip", clientIP(r), "retry_after", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			api.EncodeErrorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AllowUser charges a login of username to the user rate limit. It is called before the password
+// is verified, so password guessing is throttled without spending a hash computation, whether
+// the credentials are sent using HTTP basic authentication or in the body of v1 requests.
+func AllowUser(username string) error {
+	ok, retryAfter := userLimiter.allow(username, time.Now())
+	if ok {
+		return nil
+	}
+
+	metrics.RateLimited.WithLabelValues(ScopeUser).Inc()
+	slog.Warn("Rate limit exceeded", "scope", ScopeUser, "username", username, "retry_after", retryAfter)
+	return &api.StatusError{Code: http.StatusTooManyRequests, Message: "Rate limit exceeded", RetryAfter: retryAfter}
+}
+
+// Usage returns the remaining requests of the rate limits applying to the request.
+func Usage(r *http.Request) []api.RateLimitUsage {
+	now := time.Now()
+	usage := []api.RateLimitUsage{}
+	for _, key := range keysOf(r) {
+		usage = append(usage, api.RateLimitUsage{
+			Scope:     key.scope,
+			PerMinute: int(math.Round(key.limiter.rate * 60)),
+			Burst:     int(key.limiter.burst),
+			Remaining: key.limiter.remaining(key.value, now),
+		})
+	}
+	return usage
+}
+
+// limitKey identifies the bucket of a limiter a request is charged to
+type limitKey struct {
+	scope   string
+	limiter *limiter
+	value   string
+}
+
+// keysOf returns the buckets of the enabled limiters applying to the request.
+func keysOf(r *http.Request) []limitKey {
+	var keys []limitKey
+	if ipLimiter != nil {
+		keys = append(keys, limitKey{ScopeIP, ipLimiter, clientIP(r)})
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		// Only the hash is kept in memory, like in the database
+		if tokenLimiter != nil {
+			keys = append(keys, limitKey{ScopeToken, tokenLimiter, util.HashToken(token)})
+		}
+	} else if username, _, ok := r.BasicAuth(); ok && userLimiter != nil {
+		keys = append(keys, limitKey{ScopeUser, userLimiter, username})
+	}
+
+	return keys
+}
+
+// clientIP returns the source IP of the request. Behind trusted proxies the address is taken
+// from the X-Forwarded-For header, skipping the trusted proxies from the right.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !isTrustedProxy(addr) {
+		return host
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if !isTrustedProxy(hop) {
+			return hop.String()
+		}
+	}
+	return host
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
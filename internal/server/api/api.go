@@ -6,11 +6,15 @@ import (
 )
 
 func EncodeResponse(w http.ResponseWriter, data interface{}) {
+	EncodeResponseWithStatus(w, http.StatusOK, data)
+}
+
+func EncodeResponseWithStatus(w http.ResponseWriter, code int, data interface{}) {
 	response := Response{
 		Success: true,
 		Data:    data,
 	}
-	encodeJSONResponse(w, response, http.StatusOK)
+	encodeJSONResponse(w, response, code)
 }
 
 func EncodeErrorResponse(w http.ResponseWriter, errorCode int, errorMessage string) {
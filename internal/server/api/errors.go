@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// StatusError is returned by operations shared between the HTTP and gRPC APIs. Code is the
+// HTTP status code that best describes the failure and Message is safe to return to clients.
+type StatusError struct {
+	Code    int
+	Message string
+	Err     error
+	// RetryAfter is sent as Retry-After header if set, e.g. with 429 responses
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+func NewStatusError(code int, message string, err error) *StatusError {
+	return &StatusError{Code: code, Message: message, Err: err}
+}
+
+// Capitalize upper-cases the first letter of an error string, so errors, which are lowercase,
+// can be returned to clients as messages.
+func Capitalize(message string) string {
+	r, size := utf8.DecodeRuneInString(message)
+	if size == 0 {
+		return message
+	}
+	return string(unicode.ToUpper(r)) + message[size:]
+}
+
+// EncodeError writes err as error response, using the status code of a StatusError.
+func EncodeError(w http.ResponseWriter, err error) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(statusErr.RetryAfter.Seconds()))))
+		}
+		EncodeErrorResponse(w, statusErr.Code, statusErr.Message)
+		return
+	}
+	EncodeErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+}
@@ -1,5 +1,10 @@
 package api
 
+import (
+	"log/slog"
+	"time"
+)
+
 type Response struct {
 	Success bool        `json:"success"`
 	Errors  []Error     `json:"errors,omitempty"`
@@ -23,13 +28,232 @@ type RequestData struct {
 	Type         string `json:"type,omitempty"`
 	State        string `json:"state,omitempty"`
 	SerialNumber string `json:"serialnumber,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+	// MaxPathLen and NameConstraints apply to subordinate CA requests (type "subca")
+	MaxPathLen      *int             `json:"max_path_len,omitempty"`
+	NameConstraints *NameConstraints `json:"name_constraints,omitempty"`
+}
+
+// NameConstraints restrict the names a subordinate CA can issue for. IP ranges are given in
+// CIDR notation.
+type NameConstraints struct {
+	PermittedDNSDomains     []string `json:"permitted_dns_domains,omitempty"`
+	ExcludedDNSDomains      []string `json:"excluded_dns_domains,omitempty"`
+	PermittedIPRanges       []string `json:"permitted_ip_ranges,omitempty"`
+	ExcludedIPRanges        []string `json:"excluded_ip_ranges,omitempty"`
+	PermittedEmailAddresses []string `json:"permitted_email_addresses,omitempty"`
+	ExcludedEmailAddresses  []string `json:"excluded_email_addresses,omitempty"`
+}
+
+type KeyGenerationRequestData struct {
+	Applicant      string   `json:"applicant,omitempty"`
+	CommonName     string   `json:"common_name"`
+	Organization   string   `json:"organization,omitempty"`
+	DNSNames       []string `json:"dns_names,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
+	IPAddresses    []string `json:"ip_addresses,omitempty"`
+	Lifetime       int      `json:"lifetime,omitempty"`
+	Type           string   `json:"type,omitempty"`
+	KeyType        string   `json:"key_type,omitempty"`
+	KeySize        int      `json:"key_size,omitempty"`
+	Password       string   `json:"password"`
+	PersistKey     bool     `json:"persist_key,omitempty"`
+	Encoding       string   `json:"encoding,omitempty"`
+	Escrow         bool     `json:"escrow,omitempty"`
 }
 
 type CertificateResponseData struct {
-	CertificatePEM string `json:"cert"`
+	CertificatePEM string     `json:"cert"`
+	SerialNumber   string     `json:"serialnumber,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
+
+// SSHCertificateRequestData requests an OpenSSH certificate for a public key in authorized_keys
+// format. Lifetime is in hours, user certificates get the default extensions if Extensions is nil.
+type SSHCertificateRequestData struct {
+	PublicKey       string            `json:"public_key"`
+	Type            string            `json:"type,omitempty"`
+	Principals      []string          `json:"principals,omitempty"`
+	Lifetime        int               `json:"lifetime,omitempty"`
+	CriticalOptions map[string]string `json:"critical_options,omitempty"`
+	Extensions      []string          `json:"extensions,omitempty"`
+}
+
+type SSHCertificateResponseData struct {
+	SerialNumber string     `json:"serialnumber"`
+	Type         string     `json:"type"`
+	KeyID        string     `json:"key_id"`
+	Principals   []string   `json:"principals"`
+	ValidAfter   time.Time  `json:"valid_after"`
+	ValidBefore  time.Time  `json:"valid_before"`
+	Certificate  string     `json:"certificate"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// VerificationResult is the verdict on a certificate, it is valid if every check passed
+type VerificationResult struct {
+	Valid        bool      `json:"valid"`
+	SerialNumber string    `json:"serialnumber"`
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	// Chain lists the subjects of the CAs from the issuer up to the trust anchor
+	Chain  []string            `json:"chain,omitempty"`
+	Checks []VerificationCheck `json:"checks"`
+}
+
+// VerificationCheck is the outcome of one check, Reasons explain why it failed
+type VerificationCheck struct {
+	Check   string   `json:"check"`
+	Passed  bool     `json:"passed"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// AddCheck records a check, it passed if it has no reasons
+func (r *VerificationResult) AddCheck(check VerificationCheck) {
+	check.Passed = len(check.Reasons) == 0
+	r.Valid = r.Valid && check.Passed
+	r.Checks = append(r.Checks, check)
 }
 
 type Auth struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
+
+// LogValue implements slog.LogValuer so credentials never end up in log records.
+func (a Auth) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("username", a.Username),
+		slog.String("password", "[REDACTED]"),
+	)
+}
+
+type IssuanceRequestResponseData struct {
+	ID           string           `json:"request_id"`
+	Username     string           `json:"username"`
+	Applicant    string           `json:"applicant,omitempty"`
+	Type         string           `json:"type,omitempty"`
+	Lifetime     int              `json:"lifetime,omitempty"`
+	Reasons      []string         `json:"reasons"`
+	Status       string           `json:"status"`
+	SerialNumber string           `json:"serialnumber,omitempty"`
+	Events       []AuditEventData `json:"events"`
+	CreatedAt    time.Time        `json:"created_at"`
+	ExpiresAt    time.Time        `json:"expires_at"`
+}
+
+type DecisionData struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+type KeyRecoveryRequestData struct {
+	SerialNumber string `json:"serialnumber"`
+	Reason       string `json:"reason"`
+	Password     string `json:"password"`
+}
+
+type KeyRecoveryApprovalData struct {
+	Comment string `json:"comment,omitempty"`
+	Share   string `json:"share,omitempty"`
+}
+
+type KeyRecoveryCompletionData struct {
+	Password string `json:"password"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type KeyRecoveryResponseData struct {
+	ID                string           `json:"id"`
+	SerialNumber      string           `json:"serialnumber"`
+	Requester         string           `json:"requester"`
+	Reason            string           `json:"reason"`
+	Status            string           `json:"status"`
+	Approvals         []string         `json:"approvals"`
+	RequiredApprovals int              `json:"required_approvals"`
+	Events            []AuditEventData `json:"events"`
+	CreatedAt         time.Time        `json:"created_at"`
+}
+
+type AuditEventData struct {
+	Action   string    `json:"action"`
+	Username string    `json:"username"`
+	Comment  string    `json:"comment,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// CertificateDetails is the decoded view of a certificate
+type CertificateDetails struct {
+	SerialNumber       string       `json:"serialnumber"`
+	Subject            string       `json:"subject"`
+	Issuer             string       `json:"issuer"`
+	NotBefore          time.Time    `json:"not_before"`
+	NotAfter           time.Time    `json:"not_after"`
+	DNSNames           []string     `json:"dns_names,omitempty"`
+	EmailAddresses     []string     `json:"email_addresses,omitempty"`
+	IPAddresses        []string     `json:"ip_addresses,omitempty"`
+	URIs               []string     `json:"uris,omitempty"`
+	KeyUsage           []string     `json:"key_usage,omitempty"`
+	ExtKeyUsage        []string     `json:"ext_key_usage,omitempty"`
+	IsCA               bool         `json:"is_ca"`
+	PublicKeyAlgorithm string       `json:"public_key_algorithm"`
+	SignatureAlgorithm string       `json:"signature_algorithm"`
+	Fingerprints       Fingerprints `json:"fingerprints"`
+	RevokedAt          *time.Time   `json:"revoked_at,omitempty"`
+}
+
+// CRLDetails is the decoded view of a certificate revocation list
+type CRLDetails struct {
+	Issuer              string              `json:"issuer"`
+	Number              string              `json:"number,omitempty"`
+	ThisUpdate          time.Time           `json:"this_update"`
+	NextUpdate          time.Time           `json:"next_update"`
+	SignatureAlgorithm  string              `json:"signature_algorithm"`
+	RevokedCertificates []RevokedCertDetail `json:"revoked_certificates"`
+	Fingerprints        Fingerprints        `json:"fingerprints"`
+}
+
+// CAGenerationDetails describes a generation of the signing CA
+type CAGenerationDetails struct {
+	KeyID        string    `json:"key_id"`
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serialnumber"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	Current      bool      `json:"current"`
+	CRLPublished bool      `json:"crl_published"`
+}
+
+type RevokedCertDetail struct {
+	SerialNumber   string    `json:"serialnumber"`
+	RevocationTime time.Time `json:"revocation_time"`
+	ReasonCode     int       `json:"reason_code,omitempty"`
+}
+
+type Fingerprints struct {
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+}
+
+// UsageData reports the caller's consumption of rate limits and issuance quotas
+type UsageData struct {
+	Username   string           `json:"username"`
+	RateLimits []RateLimitUsage `json:"rate_limits"`
+	Quotas     []QuotaUsage     `json:"quotas"`
+}
+
+type RateLimitUsage struct {
+	Scope     string `json:"scope"`
+	PerMinute int    `json:"per_minute"`
+	Burst     int    `json:"burst"`
+	Remaining int    `json:"remaining"`
+}
+
+type QuotaUsage struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+	Used  int    `json:"used"`
+	// ResetsAt is set for quotas counted over a time window, once the quota is used up
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
@@ -0,0 +1,18 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// Spec is the OpenAPI 3 document describing the HTTP API. Keep it in sync with the routes
+// registered by the server.
+//
+//go:embed openapi.yaml
+var Spec []byte
+
+// HandleSpec serves the OpenAPI document.
+func HandleSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(Spec)
+}
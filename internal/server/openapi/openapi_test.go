@@ -0,0 +1,87 @@
+package openapi_test
+
+import (
+	"bytes"
+	"gcipher/internal/server"
+	"gcipher/internal/server/openapi"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// document is the part of the OpenAPI document checked against the router
+type document struct {
+	OpenAPI string                            `yaml:"openapi"`
+	Paths   map[string]map[string]interface{} `yaml:"paths"`
+}
+
+// operations maps the operation keys of a path item to HTTP methods, other keys such as
+// parameters are skipped
+var operations = map[string]string{
+	"get":    http.MethodGet,
+	"post":   http.MethodPost,
+	"put":    http.MethodPut,
+	"patch":  http.MethodPatch,
+	"delete": http.MethodDelete,
+}
+
+var pathParameter = regexp.MustCompile(`\{[^}]+\}`)
+
+func TestSpecMatchesRouter(t *testing.T) {
+	var doc document
+	if err := yaml.Unmarshal(openapi.Spec, &doc); err != nil {
+		t.Fatalf("failed to parse OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+	if len(doc.Paths) == 0 {
+		t.Fatal("OpenAPI document doesn't describe any path")
+	}
+
+	mux := server.NewRouter()
+	for path, item := range doc.Paths {
+		for key := range item {
+			method, ok := operations[key]
+			if !ok {
+				continue
+			}
+
+			req := httptest.NewRequest(method, pathParameter.ReplaceAllString(path, "x"), nil)
+			if _, pattern := mux.Handler(req); pattern == "" {
+				t.Errorf("%s %s is documented but not routed", method, path)
+			}
+		}
+	}
+}
+
+func TestSpecIsServed(t *testing.T) {
+	srv := httptest.NewServer(server.NewRouter())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/yaml" {
+		t.Errorf("expected Content-Type application/yaml, got %q", contentType)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, openapi.Spec) {
+		t.Error("served document differs from the embedded one")
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"gcipher/internal/certificate"
+	"gcipher/internal/escrow"
+	"gcipher/internal/health"
+	"gcipher/internal/metrics"
+	ocsp "gcipher/internal/oscp"
+	"gcipher/internal/server/openapi"
+	"gcipher/internal/sshca"
+	"gcipher/internal/tsa"
+	"net/http"
+)
+
+// NewRouter registers all routes on a method-aware mux. Requests using a method that
+// isn't registered for a path are answered with 405 and an Allow header by the mux.
+func NewRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// v1 API, credentials are passed in the request body
+	mux.HandleFunc("POST /api/v1/certificate/request", certificate.HandleCertificateRequest)
+	mux.HandleFunc("POST /api/v1/certificate/retrieve", certificate.HandleCertificateRetrieval)
+	mux.HandleFunc("POST /api/v1/certificate/revoke", certificate.HandleRevokeCertificate)
+	mux.HandleFunc("POST /api/v1/certificate/list", certificate.HandleCertificateList)
+	mux.HandleFunc("POST /api/v1/certificate/status", certificate.HandleCertificateRequestStatus)
+
+	// v2 API, credentials are passed using HTTP basic authentication
+	mux.HandleFunc("POST /api/v2/certificates", certificate.HandleCreateCertificateV2)
+	mux.HandleFunc("GET /api/v2/certificates", certificate.HandleListCertificatesV2)
+	mux.HandleFunc("GET /api/v2/certificates/{serial}", certificate.HandleGetCertificateV2)
+	mux.HandleFunc("DELETE /api/v2/certificates/{serial}", certificate.HandleRevokeCertificateV2)
+	mux.HandleFunc("POST /api/v2/certificates/pkcs12", certificate.HandleGenerateCertificateV2)
+	mux.HandleFunc("GET /api/v2/certificates/{serial}/pkcs12", certificate.HandleGetPKCS12V2)
+
+	mux.HandleFunc("GET /api/v2/certificate-requests", certificate.HandleListIssuanceRequestsV2)
+	mux.HandleFunc("GET /api/v2/certificate-requests/{id}", certificate.HandleGetIssuanceRequestV2)
+	mux.HandleFunc("POST /api/v2/certificate-requests/{id}/approve", certificate.HandleApproveIssuanceRequestV2)
+	mux.HandleFunc("POST /api/v2/certificate-requests/{id}/reject", certificate.HandleRejectIssuanceRequestV2)
+
+	mux.HandleFunc("GET /api/v2/usage", certificate.HandleUsageV2)
+
+	mux.HandleFunc("POST /api/v2/escrow/recoveries", escrow.HandleRequestRecovery)
+	mux.HandleFunc("GET /api/v2/escrow/recoveries", escrow.HandleListRecoveries)
+	mux.HandleFunc("GET /api/v2/escrow/recoveries/{id}", escrow.HandleGetRecovery)
+	mux.HandleFunc("POST /api/v2/escrow/recoveries/{id}/approve", escrow.HandleApproveRecovery)
+	mux.HandleFunc("POST /api/v2/escrow/recoveries/{id}/reject", escrow.HandleRejectRecovery)
+	mux.HandleFunc("POST /api/v2/escrow/recoveries/{id}/key", escrow.HandleCompleteRecovery)
+
+	mux.HandleFunc("POST /api/v2/ssh/certificates", sshca.HandleCreateCertificate)
+	mux.HandleFunc("GET /api/v2/ssh/certificates", sshca.HandleListCertificates)
+	mux.HandleFunc("GET /api/v2/ssh/certificates/{serial}", sshca.HandleGetCertificate)
+	mux.HandleFunc("DELETE /api/v2/ssh/certificates/{serial}", sshca.HandleRevokeCertificate)
+
+	mux.HandleFunc("GET /public/ca/intermediate/crl", ocsp.HandleCRL)
+	mux.HandleFunc("GET /public/ca/intermediate/crl/{keyid}", ocsp.HandleCRL)
+	mux.HandleFunc("GET /public/ca/intermediate/generations", ocsp.HandleCAGenerations)
+	mux.HandleFunc("POST /public/certificates/verify", certificate.HandleVerifyCertificate)
+	mux.HandleFunc("GET /public/ssh/ca", sshca.HandleCAPublicKey)
+	mux.HandleFunc("GET /public/ssh/krl", sshca.HandleKRL)
+	mux.HandleFunc("POST /public/tsa", tsa.HandleTimestamp)
+
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.HandleFunc("GET /healthz", health.HandleHealthz)
+	mux.HandleFunc("GET /readyz", health.HandleReadyz)
+	mux.HandleFunc("GET /api/openapi.yaml", openapi.HandleSpec)
+
+	return mux
+}
@@ -6,8 +6,12 @@ import (
 	"gcipher/internal/certificate"
 	"gcipher/internal/config"
 	"gcipher/internal/db/repositories"
+	"gcipher/internal/grpcserver"
+	"gcipher/internal/logging"
+	"gcipher/internal/metrics"
 	ocsp "gcipher/internal/oscp"
-	"log"
+	"gcipher/internal/ratelimit"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -19,45 +23,76 @@ import (
 func StartServer() {
 	cfg, err := config.GetConfig()
 	if err != nil {
-		fmt.Printf("Failed to load configuration: %v\n", err)
+		slog.Error("Failed to load configuration", "error", err)
 		return
 	}
 
 	// Initialize repositories
 	if err := repositories.InitializeRepositories(); err != nil {
-		log.Fatal("Failed to initialize repositories:", err)
+		slog.Error("Failed to initialize repositories", "error", err)
+		os.Exit(1)
 	}
 
-	// Create a new server mux
-	mux := http.NewServeMux()
+	// Initialize logging now that the MongoDB sink is available
+	if err := logging.Setup(cfg, repositories.GetLogRepository()); err != nil {
+		slog.Error("Failed to initialize logging", "error", err)
+		os.Exit(1)
+	}
+
+	// Certificates are looked up by the canonical form of their serial number
+	if err := certificate.CanonicalizeSerialNumbers(); err != nil {
+		slog.Error("Failed to canonicalize certificate serial numbers", "error", err)
+	}
+
+	// Keep the CRL up to date, readiness depends on it
+	ocsp.StartCRLUpdater()
+
+	// Expire certificate requests nobody approved in time
+	certificate.StartRequestExpiry()
+
+	if err := ratelimit.Setup(cfg); err != nil {
+		slog.Error("Failed to configure rate limits", "error", err)
+		os.Exit(1)
+	}
+
+	mux := NewRouter()
 
-	mux.HandleFunc("/api/v1/certificate/request", certificate.HandleCertificateRequest)
-	mux.HandleFunc("/api/v1/certificate/retrieve", certificate.HandleCertificateRetrieval)
-	mux.HandleFunc("/api/v1/certificate/revoke", certificate.HandleRevokeCertificate)
-	mux.HandleFunc("/api/v1/certificate/list", certificate.HandleCertificateList)
-	mux.HandleFunc("/public/ca/intermediate/crl", ocsp.HandleCRL)
+	metrics.RegisterStateCollector(repositories.GetCertificateRepository(), ocsp.CurrentCRLSource{})
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: mux,
+		Handler: logging.Middleware(ratelimit.Middleware(metrics.Middleware(mux))),
 	}
 
 	go func() {
+		slog.Info("Server listening", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("Server error: %v\n", err)
+			slog.Error("Server error", "error", err)
 		}
 	}()
 
+	var grpcSrv *grpcserver.Server
+	if cfg.GRPCPort > 0 {
+		grpcSrv, err = grpcserver.Start(cfg)
+		if err != nil {
+			slog.Error("Failed to start gRPC server", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	fmt.Println("Shutting down server...")
+	slog.Info("Shutting down server...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		fmt.Printf("Server shutdown error: %v\n", err)
+		slog.Error("Server shutdown error", "error", err)
+	}
+	if grpcSrv != nil {
+		grpcSrv.Shutdown(ctx)
 	}
-	fmt.Println("Server gracefully stopped")
+	slog.Info("Server gracefully stopped")
 }
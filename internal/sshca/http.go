@@ -0,0 +1,131 @@
+package sshca
+
+import (
+	"encoding/json"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/server/api"
+	"gcipher/internal/user"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HandleCreateCertificate handles POST /api/v2/ssh/certificates.
+func HandleCreateCertificate(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	var data api.SSHCertificateRequestData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	cert, err := IssueCertificate(r.Context(), authUser, data)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	serialNumber := strconv.FormatUint(cert.SerialNumber, 10)
+	w.Header().Set("Location", "/api/v2/ssh/certificates/"+serialNumber)
+	api.EncodeResponseWithStatus(w, http.StatusCreated, newResponseData(cert))
+}
+
+// HandleGetCertificate handles GET /api/v2/ssh/certificates/{serial}.
+func HandleGetCertificate(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	cert, err := RetrieveCertificate(r.Context(), authUser, r.PathValue("serial"))
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	api.EncodeResponse(w, newResponseData(cert))
+}
+
+// HandleRevokeCertificate handles DELETE /api/v2/ssh/certificates/{serial}.
+func HandleRevokeCertificate(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	cert, err := RevokeCertificate(r.Context(), authUser, r.PathValue("serial"))
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	api.EncodeResponse(w, newResponseData(cert))
+}
+
+// HandleListCertificates handles GET /api/v2/ssh/certificates?state=... and lists the caller's
+// SSH certificates.
+func HandleListCertificates(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := user.RequireAuthentication(w, r)
+	if !ok {
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", "valid", "revoked":
+	default:
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid state parameter")
+		return
+	}
+
+	certs, err := ListCertificates(r.Context(), authUser, state)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	certList := make([]api.SSHCertificateResponseData, 0, len(certs))
+	for i := range certs {
+		certList = append(certList, newResponseData(&certs[i]))
+	}
+
+	api.EncodeResponse(w, certList)
+}
+
+// HandleCAPublicKey handles GET /public/ssh/ca and serves the public key of the SSH CA in
+// authorized_keys format, for sshd's TrustedUserCAKeys and @cert-authority lines in known_hosts.
+func HandleCAPublicKey(w http.ResponseWriter, r *http.Request) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		api.EncodeError(w, api.NewStatusError(http.StatusInternalServerError, "Couldn't read config", err))
+		return
+	}
+
+	caSigner, err := signer(cfg)
+	if err != nil {
+		api.EncodeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(ssh.MarshalAuthorizedKey(caSigner.PublicKey()))
+}
+
+func newResponseData(cert *models.SSHCertificate) api.SSHCertificateResponseData {
+	return api.SSHCertificateResponseData{
+		SerialNumber: strconv.FormatUint(cert.SerialNumber, 10),
+		Type:         cert.Type,
+		KeyID:        cert.KeyID,
+		Principals:   cert.Principals,
+		ValidAfter:   cert.ValidAfter,
+		ValidBefore:  cert.ValidBefore,
+		Certificate:  cert.Certificate,
+		RevokedAt:    cert.RevokedAt,
+	}
+}
@@ -0,0 +1,99 @@
+package sshca
+
+import (
+	"bytes"
+	"encoding/binary"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/server/api"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KRL format constants, see PROTOCOL.krl in the OpenSSH sources
+const (
+	krlMagic                 = 0x5353484b524c0a00 // "SSHKRL\n\0"
+	krlFormatVersion         = 1
+	krlSectionCertificates   = 1
+	krlSectionCertSerialList = 0x20
+)
+
+// HandleKRL serves the OpenSSH key revocation list of the SSH CA for sshd's RevokedKeys. Unlike
+// the CRL it is generated on request, it lists the revoked certificates that haven't expired.
+func HandleKRL(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	revoked, err := repositories.GetSSHCertificateRepository().FindRevoked(now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to retrieve revoked SSH certificates", "error", err)
+		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to generate KRL")
+		return
+	}
+
+	krl, err := generateKRL(revoked, now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to generate KRL", "error", err)
+		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to generate KRL")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="gcipher.krl"`)
+	w.Write(krl)
+}
+
+// generateKRL encodes a KRL with a serial number list per CA key. The generation time is used
+// as KRL version, so the version increases with every KRL.
+func generateKRL(revoked []models.SSHCertificate, now time.Time) ([]byte, error) {
+	var caKeys []string
+	serials := map[string][]uint64{}
+	for _, cert := range revoked {
+		if _, ok := serials[cert.CAPublicKey]; !ok {
+			caKeys = append(caKeys, cert.CAPublicKey)
+		}
+		serials[cert.CAPublicKey] = append(serials[cert.CAPublicKey], cert.SerialNumber)
+	}
+
+	var krl bytes.Buffer
+	binary.Write(&krl, binary.BigEndian, uint64(krlMagic))
+	binary.Write(&krl, binary.BigEndian, uint32(krlFormatVersion))
+	binary.Write(&krl, binary.BigEndian, uint64(now.Unix())) // krl_version
+	binary.Write(&krl, binary.BigEndian, uint64(now.Unix())) // generated_date
+	binary.Write(&krl, binary.BigEndian, uint64(0))          // flags
+	writeString(&krl, nil)                                   // reserved
+	writeString(&krl, []byte("gcipher SSH CA"))              // comment
+
+	for _, caKey := range caKeys {
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(caKey))
+		if err != nil {
+			return nil, err
+		}
+
+		list := serials[caKey]
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		var serialList bytes.Buffer
+		for _, serial := range list {
+			binary.Write(&serialList, binary.BigEndian, serial)
+		}
+
+		var section bytes.Buffer
+		writeString(&section, publicKey.Marshal()) // ca_key
+		writeString(&section, nil)                 // reserved
+		section.WriteByte(krlSectionCertSerialList)
+		writeString(&section, serialList.Bytes())
+
+		krl.WriteByte(krlSectionCertificates)
+		writeString(&krl, section.Bytes())
+	}
+
+	return krl.Bytes(), nil
+}
+
+// writeString writes an SSH wire format string, a uint32 length followed by the bytes.
+func writeString(buf *bytes.Buffer, s []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.Write(s)
+}
@@ -0,0 +1,390 @@
+package sshca
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/metrics"
+	"gcipher/internal/server/api"
+	"gcipher/internal/user"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// clockSkew backdates certificates so hosts with a slightly late clock accept them right away
+const clockSkew = 5 * time.Minute
+
+// defaultExtensions are granted to user certificates that don't request extensions, the same
+// ones ssh-keygen grants by default
+var defaultExtensions = []string{
+	"permit-X11-forwarding",
+	"permit-agent-forwarding",
+	"permit-port-forwarding",
+	"permit-pty",
+	"permit-user-rc",
+}
+
+// userExtensions are the extensions user certificates can request
+var userExtensions = map[string]bool{
+	"permit-X11-forwarding":   true,
+	"permit-agent-forwarding": true,
+	"permit-port-forwarding":  true,
+	"permit-pty":              true,
+	"permit-user-rc":          true,
+	"no-touch-required":       true,
+}
+
+// IssueCertificate signs the public key in data into a user or host certificate for the owner.
+// Non-admins only get user certificates for their own username, and host certificates only if
+// name ownership is enforced, their principals are subject to the owner's name rules.
+func IssueCertificate(ctx context.Context, owner *models.User, data api.SSHCertificateRequestData) (*models.SSHCertificate, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Couldn't read config", err)
+	}
+
+	caSigner, err := signer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := parsePublicKey(cfg, data.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certType := data.Type
+	if certType == "" {
+		certType = models.SSHCertificateUser
+	}
+
+	var sshType uint32
+	var principals []string
+	var lifetimeMax int
+	switch certType {
+	case models.SSHCertificateUser:
+		sshType, lifetimeMax = ssh.UserCert, cfg.SSHUserLifetimeMax
+		principals, err = userPrincipals(owner, data.Principals)
+	case models.SSHCertificateHost:
+		sshType, lifetimeMax = ssh.HostCert, cfg.SSHHostLifetimeMax
+		principals, err = hostPrincipals(cfg, owner, data.Principals)
+	default:
+		return nil, api.NewStatusError(http.StatusBadRequest, "Invalid type, expected user or host", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := permissionsFor(certType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime := data.Lifetime
+	if lifetime < 1 {
+		lifetime = lifetimeMax
+	}
+	if lifetime > lifetimeMax {
+		return nil, api.NewStatusError(http.StatusBadRequest,
+			fmt.Sprintf("Requested lifetime exceeds the maximum of %d hours for %s certificates", lifetimeMax, certType), nil)
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Failed to generate serial number", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	validAfter := now.Add(-clockSkew)
+	validBefore := now.Add(time.Duration(lifetime) * time.Hour)
+
+	cert := &ssh.Certificate{
+		Key:             publicKey,
+		Serial:          serialNumber,
+		CertType:        sshType,
+		KeyId:           owner.Username,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(validAfter.Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+		Permissions:     permissions,
+	}
+
+	signingStart := time.Now()
+	err = cert.SignCert(rand.Reader, caSigner)
+	metrics.SigningDuration.WithLabelValues("ssh-certificate").Observe(time.Since(signingStart).Seconds())
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to sign SSH certificate", "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Failed to create certificate", err)
+	}
+
+	record := models.SSHCertificate{
+		SerialNumber:         serialNumber,
+		Type:                 certType,
+		KeyID:                cert.KeyId,
+		Principals:           principals,
+		Certificate:          strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert))),
+		CAPublicKey:          strings.TrimSpace(string(ssh.MarshalAuthorizedKey(caSigner.PublicKey()))),
+		PublicKeyFingerprint: ssh.FingerprintSHA256(publicKey),
+		Username:             owner.Username,
+		IssuedAt:             now,
+		ValidAfter:           validAfter,
+		ValidBefore:          validBefore,
+	}
+	if err := repositories.GetSSHCertificateRepository().Insert(record); err != nil {
+		slog.ErrorContext(ctx, "Failed to store SSH certificate", "serialnumber", serialNumber, "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+
+	metrics.CertificatesIssued.WithLabelValues("ssh-"+certType, owner.Username).Inc()
+	slog.InfoContext(ctx, "SSH certificate issued", "serialnumber", serialNumber, "type", certType, "principals", principals)
+
+	return &record, nil
+}
+
+// RetrieveCertificate returns the SSH certificate with the given serial number if it belongs to the owner.
+func RetrieveCertificate(ctx context.Context, owner *models.User, serialNumber string) (*models.SSHCertificate, error) {
+	serial, err := strconv.ParseUint(serialNumber, 10, 64)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Invalid serial number, expected a decimal number", err)
+	}
+
+	cert, err := repositories.GetSSHCertificateRepository().FindBySerialNumberAndUsername(serial, owner.Username)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusNotFound, "Certificate not found", err)
+	}
+
+	return cert, nil
+}
+
+// RevokeCertificate revokes the SSH certificate with the given serial number. Owners can revoke
+// their own certificates, admins any certificate. It is listed in the KRL until it expires.
+func RevokeCertificate(ctx context.Context, caller *models.User, serialNumber string) (*models.SSHCertificate, error) {
+	var cert *models.SSHCertificate
+	var err error
+	if caller.IsAdmin() {
+		cert, err = retrieveAnyCertificate(serialNumber)
+	} else {
+		cert, err = RetrieveCertificate(ctx, caller, serialNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cert.RevokedAt != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Certificate already revoked", nil)
+	}
+
+	now := time.Now().UTC()
+	if err := repositories.GetSSHCertificateRepository().Revoke(cert.SerialNumber, now); err != nil {
+		slog.ErrorContext(ctx, "Failed to revoke SSH certificate", "serialnumber", cert.SerialNumber, "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+	cert.RevokedAt = &now
+
+	metrics.CertificatesRevoked.WithLabelValues("ssh-"+cert.Type, cert.Username).Inc()
+	slog.InfoContext(ctx, "SSH certificate revoked", "serialnumber", cert.SerialNumber, "owner", cert.Username)
+
+	return cert, nil
+}
+
+// retrieveAnyCertificate returns the SSH certificate with the given serial number regardless of
+// its owner.
+func retrieveAnyCertificate(serialNumber string) (*models.SSHCertificate, error) {
+	serial, err := strconv.ParseUint(serialNumber, 10, 64)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Invalid serial number, expected a decimal number", err)
+	}
+
+	cert, err := repositories.GetSSHCertificateRepository().FindBySerialNumber(serial)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusNotFound, "Certificate not found", err)
+	}
+
+	return cert, nil
+}
+
+// ListCertificates returns the owner's SSH certificates matching the state filter ("valid",
+// "revoked" or empty for all).
+func ListCertificates(ctx context.Context, owner *models.User, state string) ([]models.SSHCertificate, error) {
+	certs, err := repositories.GetSSHCertificateRepository().FindByStateAndUsername(state, owner.Username)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to retrieve SSH certificates", "error", err)
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Failed to retrieve certificates", err)
+	}
+	return certs, nil
+}
+
+// signer returns the SSH CA key as signer, RSA keys sign with rsa-sha2-512.
+func signer(cfg *config.Config) (ssh.Signer, error) {
+	if cfg.SSHCAKey == nil {
+		return nil, api.NewStatusError(http.StatusServiceUnavailable, "SSH CA is not configured", nil)
+	}
+
+	caSigner, err := ssh.NewSignerFromSigner(cfg.SSHCAKey)
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusInternalServerError, "Unsupported SSH CA key", err)
+	}
+	return caSigner, nil
+}
+
+// parsePublicKey parses a public key in authorized_keys format. Certificates, DSA keys and RSA
+// keys below the minimum CSR key size are refused.
+func parsePublicKey(cfg *config.Config, authorizedKey string) (ssh.PublicKey, error) {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Invalid public key, expected authorized_keys format", err)
+	}
+
+	if _, ok := publicKey.(*ssh.Certificate); ok {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Public key is a certificate", nil)
+	}
+	if publicKey.Type() == ssh.KeyAlgoDSA {
+		return nil, api.NewStatusError(http.StatusBadRequest, "DSA keys are not supported", nil)
+	}
+	if cryptoKey, ok := publicKey.(ssh.CryptoPublicKey); ok {
+		if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok && rsaKey.N.BitLen() < cfg.CSRMinRSAKeySize {
+			return nil, api.NewStatusError(http.StatusBadRequest,
+				fmt.Sprintf("RSA keys must have at least %d bits", cfg.CSRMinRSAKeySize), nil)
+		}
+	}
+
+	return publicKey, nil
+}
+
+// userPrincipals returns the principals of a user certificate, the owner's username by default.
+// Only admins can request other principals.
+func userPrincipals(owner *models.User, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return []string{owner.Username}, nil
+	}
+
+	for _, principal := range requested {
+		if err := checkPrincipal(principal); err != nil {
+			return nil, err
+		}
+		if principal != owner.Username && !owner.IsAdmin() {
+			return nil, api.NewStatusError(http.StatusForbidden, "Only admins can request user certificates for other principals", nil)
+		}
+	}
+	return requested, nil
+}
+
+// hostPrincipals checks the host names and addresses of a host certificate against the owner's
+// name rules if name ownership is enforced. Without name rules only admins can vouch for hosts.
+func hostPrincipals(cfg *config.Config, owner *models.User, requested []string) ([]string, error) {
+	if !cfg.EnforceNameOwnership && !owner.IsAdmin() {
+		return nil, api.NewStatusError(http.StatusForbidden, "Only admins can request host certificates unless name ownership is enforced", nil)
+	}
+	if len(requested) == 0 {
+		return nil, api.NewStatusError(http.StatusBadRequest, "Host certificates require principals", nil)
+	}
+
+	var dnsNames []string
+	var ipAddresses []net.IP
+	for _, principal := range requested {
+		if err := checkPrincipal(principal); err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(principal); ip != nil {
+			ipAddresses = append(ipAddresses, ip)
+		} else {
+			dnsNames = append(dnsNames, principal)
+		}
+	}
+
+	if cfg.EnforceNameOwnership {
+		if err := user.AuthorizeNames(owner, dnsNames, ipAddresses, nil, nil); err != nil {
+			return nil, api.NewStatusError(http.StatusForbidden, api.Capitalize(err.Error()), nil)
+		}
+	}
+	return requested, nil
+}
+
+func checkPrincipal(principal string) error {
+	if principal == "" || len(principal) > 255 || strings.ContainsAny(principal, " \t\r\n,") {
+		return api.NewStatusError(http.StatusBadRequest, fmt.Sprintf("Invalid principal %q", principal), nil)
+	}
+	return nil
+}
+
+// permissionsFor validates the requested critical options and extensions. Host certificates
+// have neither.
+func permissionsFor(certType string, data api.SSHCertificateRequestData) (ssh.Permissions, error) {
+	if certType == models.SSHCertificateHost {
+		if len(data.CriticalOptions) > 0 || len(data.Extensions) > 0 {
+			return ssh.Permissions{}, api.NewStatusError(http.StatusBadRequest, "Host certificates don't support critical options or extensions", nil)
+		}
+		return ssh.Permissions{}, nil
+	}
+
+	options := map[string]string{}
+	for name, value := range data.CriticalOptions {
+		switch name {
+		case "force-command":
+			if value == "" {
+				return ssh.Permissions{}, api.NewStatusError(http.StatusBadRequest, "force-command requires a command", nil)
+			}
+		case "source-address":
+			if err := checkSourceAddress(value); err != nil {
+				return ssh.Permissions{}, err
+			}
+		case "verify-required":
+			value = ""
+		default:
+			return ssh.Permissions{}, api.NewStatusError(http.StatusBadRequest, fmt.Sprintf("Unsupported critical option %s", name), nil)
+		}
+		options[name] = value
+	}
+
+	requested := data.Extensions
+	if requested == nil {
+		requested = defaultExtensions
+	}
+	extensions := map[string]string{}
+	for _, name := range requested {
+		if !userExtensions[name] {
+			return ssh.Permissions{}, api.NewStatusError(http.StatusBadRequest, fmt.Sprintf("Unsupported extension %s", name), nil)
+		}
+		extensions[name] = ""
+	}
+
+	return ssh.Permissions{CriticalOptions: options, Extensions: extensions}, nil
+}
+
+// checkSourceAddress checks a comma separated list of addresses and CIDRs.
+func checkSourceAddress(value string) error {
+	for _, address := range strings.Split(value, ",") {
+		if net.ParseIP(address) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(address); err != nil {
+			return api.NewStatusError(http.StatusBadRequest, fmt.Sprintf("Invalid source-address %q", address), nil)
+		}
+	}
+	return nil
+}
+
+// newSerialNumber returns a random non-zero serial number below 2^63, so it fits the int64
+// MongoDB stores it as.
+func newSerialNumber() (uint64, error) {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		if serial := binary.BigEndian.Uint64(b[:]) >> 1; serial != 0 {
+			return serial, nil
+		}
+	}
+}
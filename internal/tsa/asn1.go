@@ -0,0 +1,181 @@
+package tsa
+
+import (
+	"crypto"
+	_ "crypto/sha512" // SHA-384 and SHA-512 message imprints
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Object identifiers of RFC 3161, RFC 5652 and RFC 5035
+var (
+	oidSignedData                    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo                       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttributeContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSHA256                        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384                        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512                        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSHA256WithRSA                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA256               = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// hashAlgorithms are the message imprint algorithms the TSA accepts
+var hashAlgorithms = map[string]crypto.Hash{
+	oidSHA256.String(): crypto.SHA256,
+	oidSHA384.String(): crypto.SHA384,
+	oidSHA512.String(): crypto.SHA512,
+}
+
+// PKIStatus values
+const (
+	statusGranted                = 0
+	statusGrantedWithMods        = 1
+	statusRejection              = 2
+	statusWaiting                = 3
+	statusRevocationWarning      = 4
+	statusRevocationNotification = 5
+)
+
+// PKIFailureInfo bits
+const (
+	failBadAlg              = 0
+	failBadRequest          = 2
+	failBadDataFormat       = 5
+	failTimeNotAvailable    = 14
+	failUnacceptedPolicy    = 15
+	failUnacceptedExtension = 16
+	failSystemFailure       = 25
+)
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint asn1.RawValue
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type pkiStatusInfo struct {
+	Status int
+	// StatusString is a sequence of UTF8Strings, see freeText
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// tstInfo is the signed content of a timestamp token. GenTime is kept raw, encoding/asn1 neither
+// writes nor reliably reads GeneralizedTime with fractional seconds.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint asn1.RawValue
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// contentInfo keeps the [0] EXPLICIT tag of the content in the raw value, encoding/asn1 applies
+// explicit tags to raw values neither when marshaling nor when unmarshaling.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	// Certificates and CRLs are IMPLICIT SETs, kept raw
+	Certificates asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs         asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos  []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version         int
+	SID             issuerAndSerialNumber
+	DigestAlgorithm pkix.AlgorithmIdentifier
+	// SignedAttrs is an IMPLICIT SET, the signature covers it re-tagged as SET
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// essCertIDv2 omits the hash algorithm, the default is SHA-256
+type essCertIDv2 struct {
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+}
+
+// generalizedTime encodes a time as GeneralizedTime in UTC with second precision.
+func generalizedTime(t time.Time) asn1.RawValue {
+	return asn1.RawValue{Tag: asn1.TagGeneralizedTime, Bytes: []byte(t.UTC().Format("20060102150405Z"))}
+}
+
+// parseGeneralizedTime parses a GeneralizedTime, with or without fractional seconds.
+func parseGeneralizedTime(value asn1.RawValue) (time.Time, error) {
+	if value.Class != asn1.ClassUniversal || value.Tag != asn1.TagGeneralizedTime {
+		return time.Time{}, fmt.Errorf("genTime is not a GeneralizedTime")
+	}
+	return time.Parse("20060102150405.999999999Z", string(value.Bytes))
+}
+
+// freeText encodes PKIFreeText, a sequence of UTF8Strings.
+func freeText(text string) []asn1.RawValue {
+	return []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(text)}}
+}
+
+// contextTagged wraps DER encoded elements in a constructed context specific tag, for IMPLICIT
+// SETs and EXPLICIT tags.
+func contextTagged(tag int, elements [][]byte) asn1.RawValue {
+	var content []byte
+	for _, element := range elements {
+		content = append(content, element...)
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: content}
+}
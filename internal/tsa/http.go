@@ -0,0 +1,50 @@
+package tsa
+
+import (
+	"gcipher/internal/config"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/server/api"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+)
+
+// maxRequestSize limits timestamp requests, a request with a SHA-512 imprint is about 100 bytes
+const maxRequestSize = 1 << 12
+
+// HandleTimestamp handles POST /public/tsa, the RFC 3161 HTTP transport. The body is a DER
+// encoded TimeStampReq, the response a TimeStampResp. Requests the TSA refuses are answered with
+// 200 and a rejection in the response, as the protocol expects.
+func HandleTimestamp(w http.ResponseWriter, r *http.Request) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		api.EncodeError(w, api.NewStatusError(http.StatusInternalServerError, "Couldn't read config", err))
+		return
+	}
+	if cfg.TSACert == nil {
+		api.EncodeErrorResponse(w, http.StatusServiceUnavailable, "Timestamping authority is not configured")
+		return
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/timestamp-query" {
+		api.EncodeErrorResponse(w, http.StatusUnsupportedMediaType, "Content-Type must be application/timestamp-query")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		api.EncodeErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	resp, err := Timestamp(cfg, repositories.GetCounterRepository(), body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode timestamp response", "error", err)
+		api.EncodeErrorResponse(w, http.StatusInternalServerError, "Failed to encode timestamp response")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp)
+}
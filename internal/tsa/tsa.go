@@ -0,0 +1,222 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/db/repositories"
+	"gcipher/internal/metrics"
+	"log/slog"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// serialCounter is the name of the counter timestamp token serial numbers are drawn from
+const serialCounter = "tsa_serial"
+
+// requestError is a request the TSA refuses, it is answered with a rejection carrying the
+// failure info bit.
+type requestError struct {
+	failInfo int
+	msg      string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+func rejectRequest(failInfo int, format string, args ...interface{}) error {
+	return &requestError{failInfo: failInfo, msg: fmt.Sprintf(format, args...)}
+}
+
+// Timestamp answers a DER encoded TimeStampReq with a DER encoded TimeStampResp. Requests the TSA
+// refuses are answered with a rejection, the error is only set if no response could be encoded.
+func Timestamp(cfg *config.Config, counterRepo *repositories.CounterRepository, req []byte) ([]byte, error) {
+	token, err := timestamp(cfg, counterRepo, req, time.Now())
+	if err != nil {
+		return rejection(err)
+	}
+
+	return asn1.Marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: statusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+// rejection encodes a TimeStampResp refusing the request. Errors that aren't request errors are
+// logged and reported as system failures without details.
+func rejection(err error) ([]byte, error) {
+	reqErr, ok := err.(*requestError)
+	if !ok {
+		slog.Error("Failed to issue timestamp", "error", err)
+		reqErr = &requestError{failInfo: failSystemFailure, msg: "The request couldn't be processed"}
+	}
+
+	failInfo := asn1.BitString{Bytes: make([]byte, reqErr.failInfo/8+1), BitLength: reqErr.failInfo + 1}
+	failInfo.Bytes[reqErr.failInfo/8] = 0x80 >> (reqErr.failInfo % 8)
+
+	return asn1.Marshal(timeStampResp{Status: pkiStatusInfo{
+		Status:       statusRejection,
+		StatusString: freeText(reqErr.msg),
+		FailInfo:     failInfo,
+	}})
+}
+
+// timestamp checks the request and returns the DER encoded timestamp token for it.
+func timestamp(cfg *config.Config, counterRepo *repositories.CounterRepository, der []byte, now time.Time) ([]byte, error) {
+	var req timeStampReq
+	if rest, err := asn1.Unmarshal(der, &req); err != nil || len(rest) > 0 {
+		return nil, rejectRequest(failBadDataFormat, "Malformed timestamp request")
+	}
+	if req.Version != 1 {
+		return nil, rejectRequest(failBadRequest, "Unsupported request version %d", req.Version)
+	}
+
+	var imprint messageImprint
+	if _, err := asn1.Unmarshal(req.MessageImprint.FullBytes, &imprint); err != nil {
+		return nil, rejectRequest(failBadDataFormat, "Malformed message imprint")
+	}
+	hash, ok := hashAlgorithms[imprint.HashAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, rejectRequest(failBadAlg, "Unsupported hash algorithm %s, use SHA-256, SHA-384 or SHA-512", imprint.HashAlgorithm.Algorithm)
+	}
+	if len(imprint.HashedMessage) != hash.Size() {
+		return nil, rejectRequest(failBadDataFormat, "Message imprint has the wrong length for %s", hash)
+	}
+
+	if req.ReqPolicy != nil && !req.ReqPolicy.Equal(cfg.TSAPolicyID) {
+		return nil, rejectRequest(failUnacceptedPolicy, "Unsupported policy %s", req.ReqPolicy)
+	}
+	if len(req.Extensions) > 0 {
+		return nil, rejectRequest(failUnacceptedExtension, "Request extensions are not supported")
+	}
+
+	serial, err := counterRepo.Next(serialCounter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate serial number: %v", err)
+	}
+
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         cfg.TSAPolicyID,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(serial),
+		GenTime:        generalizedTime(now),
+		Accuracy:       accuracy{Seconds: cfg.TSAAccuracy},
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signingStart := time.Now()
+	token, err := signToken(cfg, info, req.CertReq)
+	if err != nil {
+		return nil, err
+	}
+	metrics.SigningDuration.WithLabelValues("timestamp").Observe(time.Since(signingStart).Seconds())
+	return token, nil
+}
+
+// signToken wraps the TSTInfo in CMS SignedData signed by the TSA. The signed attributes carry
+// the signing certificate, so relying parties can't be misled by a substituted certificate, the
+// certificates themselves are only included if the client asked for them.
+func signToken(cfg *config.Config, info []byte, certReq bool) ([]byte, error) {
+	signatureAlgorithm, err := signatureAlgorithmOf(cfg.TSAKey)
+	if err != nil {
+		return nil, err
+	}
+
+	infoDigest := sha256.Sum256(info)
+	certHash := sha256.Sum256(cfg.TSACert.Raw)
+	var signedAttrs [][]byte
+	for _, attr := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidAttributeContentType, oidTSTInfo},
+		{oidAttributeMessageDigest, infoDigest[:]},
+		{oidAttributeSigningCertificateV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}}},
+	} {
+		der, err := encodeAttribute(attr.oid, attr.value)
+		if err != nil {
+			return nil, err
+		}
+		signedAttrs = append(signedAttrs, der)
+	}
+	// DER requires the elements of a SET OF in ascending order of their encodings
+	sort.Slice(signedAttrs, func(i, j int) bool { return bytes.Compare(signedAttrs[i], signedAttrs[j]) < 0 })
+
+	// The signature covers the DER encoding of the attributes as SET OF, not the implicit tag
+	signedAttrsSet, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(signedAttrs, nil)})
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(signedAttrsSet)
+	signature, err := cfg.TSAKey.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign timestamp token: %v", err)
+	}
+
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: info},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: cfg.TSACert.RawIssuer},
+				SerialNumber: cfg.TSACert.SerialNumber,
+			},
+			DigestAlgorithm:    sha256Algorithm,
+			SignedAttrs:        contextTagged(0, signedAttrs),
+			SignatureAlgorithm: signatureAlgorithm,
+			Signature:          signature,
+		}},
+	}
+	if certReq {
+		certs := [][]byte{cfg.TSACert.Raw}
+		for _, ca := range cfg.CAChain() {
+			certs = append(certs, ca.Raw)
+		}
+		sd.Certificates = contextTagged(0, certs)
+	}
+
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     contextTagged(0, [][]byte{content}),
+	})
+}
+
+func signatureAlgorithmOf(key crypto.Signer) (pkix.AlgorithmIdentifier, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported TSA key type %T", key.Public())
+	}
+}
+
+// encodeAttribute encodes a single valued attribute.
+func encodeAttribute(oid asn1.ObjectIdentifier, value interface{}) ([]byte, error) {
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(attribute{Type: oid, Values: []asn1.RawValue{{FullBytes: der}}})
+}
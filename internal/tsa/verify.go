@@ -0,0 +1,286 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"gcipher/internal/util"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var statusNames = map[int]string{
+	statusGranted:                "granted",
+	statusGrantedWithMods:        "grantedWithMods",
+	statusRejection:              "rejection",
+	statusWaiting:                "waiting",
+	statusRevocationWarning:      "revocationWarning",
+	statusRevocationNotification: "revocationNotification",
+}
+
+var failureNames = map[int]string{
+	failBadAlg:              "badAlg",
+	failBadRequest:          "badRequest",
+	failBadDataFormat:       "badDataFormat",
+	failTimeNotAvailable:    "timeNotAvailable",
+	failUnacceptedPolicy:    "unacceptedPolicy",
+	failUnacceptedExtension: "unacceptedExtension",
+	failSystemFailure:       "systemFailure",
+}
+
+// Token is a verified timestamp token
+type Token struct {
+	SerialNumber  *big.Int
+	GenTime       time.Time
+	Accuracy      time.Duration
+	Policy        asn1.ObjectIdentifier
+	Nonce         *big.Int
+	HashAlgorithm crypto.Hash
+	HashedMessage []byte
+	// Signer is the TSA certificate, Chain the CA certificates it was verified with
+	Signer *x509.Certificate
+	Chain  []*x509.Certificate
+}
+
+// Matches reports whether the token was issued for the data read from r.
+func (token *Token) Matches(r io.Reader) (bool, error) {
+	h := token.HashAlgorithm.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return false, err
+	}
+	return bytes.Equal(h.Sum(nil), token.HashedMessage), nil
+}
+
+// ParseResponse returns the timestamp token of a DER encoded TimeStampResp. If no token was
+// granted the error carries the status, status text and failure info of the response.
+func ParseResponse(der []byte) ([]byte, error) {
+	var resp timeStampResp
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed timestamp response")
+	}
+
+	status := resp.Status
+	if status.Status == statusGranted || status.Status == statusGrantedWithMods {
+		if len(resp.TimeStampToken.FullBytes) == 0 {
+			return nil, fmt.Errorf("timestamp response has no token")
+		}
+		return resp.TimeStampToken.FullBytes, nil
+	}
+
+	details := []string{statusNames[status.Status]}
+	for _, text := range status.StatusString {
+		details = append(details, string(text.Bytes))
+	}
+	for bit := 0; bit < status.FailInfo.BitLength; bit++ {
+		if status.FailInfo.At(bit) == 0 {
+			continue
+		}
+		if name, ok := failureNames[bit]; ok {
+			details = append(details, name)
+		} else {
+			details = append(details, fmt.Sprintf("failure %d", bit))
+		}
+	}
+	return nil, fmt.Errorf("timestamp was not granted: %s", strings.Join(details, ", "))
+}
+
+// VerifyToken verifies a DER encoded timestamp token. It checks the CMS signature and signed
+// attributes, and builds the chain of the TSA certificate for timestamping as of the time of the
+// timestamp. The certificates are used in addition to the ones in the token to find the TSA
+// certificate and intermediates. Revocation is left to the caller.
+func VerifyToken(der []byte, roots, intermediates *x509.CertPool, certs []*x509.Certificate) (*Token, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed timestamp token")
+	}
+	if !ci.ContentType.Equal(oidSignedData) || ci.Content.Class != asn1.ClassContextSpecific || ci.Content.Tag != 0 {
+		return nil, fmt.Errorf("timestamp token is not CMS signed data")
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("malformed signed data: %v", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) || len(sd.EncapContentInfo.EContent) == 0 {
+		return nil, fmt.Errorf("signed data doesn't contain a TSTInfo")
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("timestamp token must have exactly one signer, found %d", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+
+	if len(sd.Certificates.Bytes) > 0 {
+		embedded, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("malformed certificates in timestamp token: %v", err)
+		}
+		certs = append(embedded, certs...)
+	}
+	signer := findSigner(certs, si.SID)
+	if signer == nil {
+		return nil, fmt.Errorf("TSA certificate not found, it isn't included in the token")
+	}
+
+	hash, ok := hashAlgorithms[si.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", si.DigestAlgorithm.Algorithm)
+	}
+	if err := checkSignedAttributes(si, hash, sd.EncapContentInfo.EContent, signer); err != nil {
+		return nil, err
+	}
+	if err := checkSignature(si, hash, signer); err != nil {
+		return nil, err
+	}
+
+	token, err := parseTSTInfo(sd.EncapContentInfo.EContent)
+	if err != nil {
+		return nil, err
+	}
+	token.Signer = signer
+
+	if !util.HasCriticalExtKeyUsage(signer) {
+		return nil, fmt.Errorf("TSA certificate %s doesn't have a critical extended key usage", signer.Subject)
+	}
+	if intermediates == nil {
+		intermediates = x509.NewCertPool()
+	}
+	for _, cert := range certs {
+		intermediates.AddCert(cert)
+	}
+	chains, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   token.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("TSA certificate is not trusted: %v", err)
+	}
+	token.Chain = chains[0][1:]
+
+	return token, nil
+}
+
+func findSigner(certs []*x509.Certificate, sid issuerAndSerialNumber) *x509.Certificate {
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, sid.Issuer.FullBytes) && cert.SerialNumber.Cmp(sid.SerialNumber) == 0 {
+			return cert
+		}
+	}
+	return nil
+}
+
+// checkSignedAttributes checks that the signed attributes bind the signature to the TSTInfo and
+// to the TSA certificate.
+func checkSignedAttributes(si signerInfo, hash crypto.Hash, content []byte, signer *x509.Certificate) error {
+	attrs := map[string][]byte{}
+	for rest := si.SignedAttrs.Bytes; len(rest) > 0; {
+		var attr attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return fmt.Errorf("malformed signed attributes: %v", err)
+		}
+		if len(attr.Values) != 1 {
+			return fmt.Errorf("signed attribute %s must have exactly one value", attr.Type)
+		}
+		attrs[attr.Type.String()] = attr.Values[0].FullBytes
+	}
+
+	var contentType asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(attrs[oidAttributeContentType.String()], &contentType); err != nil || !contentType.Equal(oidTSTInfo) {
+		return fmt.Errorf("content type attribute is missing or wrong")
+	}
+
+	var messageDigest []byte
+	if _, err := asn1.Unmarshal(attrs[oidAttributeMessageDigest.String()], &messageDigest); err != nil {
+		return fmt.Errorf("message digest attribute is missing")
+	}
+	h := hash.New()
+	h.Write(content)
+	if !bytes.Equal(h.Sum(nil), messageDigest) {
+		return fmt.Errorf("message digest doesn't match the TSTInfo")
+	}
+
+	var signingCert signingCertificateV2
+	if _, err := asn1.Unmarshal(attrs[oidAttributeSigningCertificateV2.String()], &signingCert); err != nil || len(signingCert.Certs) == 0 {
+		return fmt.Errorf("signing certificate attribute is missing")
+	}
+	certHashAlgorithm := crypto.SHA256
+	var ok bool
+	if algorithm := signingCert.Certs[0].HashAlgorithm.Algorithm; len(algorithm) > 0 {
+		if certHashAlgorithm, ok = hashAlgorithms[algorithm.String()]; !ok {
+			return fmt.Errorf("unsupported signing certificate hash algorithm %s", algorithm)
+		}
+	}
+	h = certHashAlgorithm.New()
+	h.Write(signer.Raw)
+	if !bytes.Equal(h.Sum(nil), signingCert.Certs[0].CertHash) {
+		return fmt.Errorf("signing certificate attribute doesn't match the TSA certificate")
+	}
+
+	return nil
+}
+
+// checkSignature verifies the signature over the signed attributes, which are signed as SET OF
+// rather than with their implicit tag.
+func checkSignature(si signerInfo, hash crypto.Hash, signer *x509.Certificate) error {
+	signedAttrs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(signedAttrs)
+	digest := h.Sum(nil)
+
+	switch publicKey := signer.PublicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(publicKey, hash, digest, si.Signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(publicKey, digest, si.Signature) {
+			err = fmt.Errorf("ECDSA verification failure")
+		}
+	default:
+		err = fmt.Errorf("unsupported key type %T", publicKey)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid timestamp token signature: %v", err)
+	}
+	return nil
+}
+
+func parseTSTInfo(der []byte) (*Token, error) {
+	var info tstInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed TSTInfo")
+	}
+
+	var imprint messageImprint
+	if _, err := asn1.Unmarshal(info.MessageImprint.FullBytes, &imprint); err != nil {
+		return nil, fmt.Errorf("malformed message imprint")
+	}
+	hash, ok := hashAlgorithms[imprint.HashAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported message imprint algorithm %s", imprint.HashAlgorithm.Algorithm)
+	}
+
+	genTime, err := parseGeneralizedTime(info.GenTime)
+	if err != nil {
+		return nil, fmt.Errorf("malformed genTime: %v", err)
+	}
+
+	return &Token{
+		SerialNumber:  info.SerialNumber,
+		GenTime:       genTime,
+		Accuracy:      time.Duration(info.Accuracy.Seconds)*time.Second + time.Duration(info.Accuracy.Millis)*time.Millisecond + time.Duration(info.Accuracy.Micros)*time.Microsecond,
+		Policy:        info.Policy,
+		Nonce:         info.Nonce,
+		HashAlgorithm: hash,
+		HashedMessage: imprint.HashedMessage,
+	}, nil
+}
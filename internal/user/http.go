@@ -0,0 +1,52 @@
+package user
+
+import (
+	"errors"
+	"gcipher/internal/db/models"
+	"gcipher/internal/logging"
+	"gcipher/internal/server/api"
+	"log/slog"
+	"net/http"
+)
+
+// RequireAuthentication authenticates the request using an API token or HTTP basic authentication.
+// If authentication fails, the error response is written and false is returned.
+func RequireAuthentication(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	authUser, err := AuthenticateRequest(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Authentication failed", "error", err)
+		w.Header().Set("WWW-Authenticate", `Basic realm="gcipher"`)
+		EncodeAuthenticationError(w, err)
+		return nil, false
+	}
+
+	logging.SetUsername(r.Context(), authUser.Username)
+	return authUser, true
+}
+
+// EncodeAuthenticationError writes the response of a failed authentication, 429 if the user
+// rate limit is exceeded and 401 otherwise.
+func EncodeAuthenticationError(w http.ResponseWriter, err error) {
+	var statusErr *api.StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusTooManyRequests {
+		api.EncodeError(w, err)
+		return
+	}
+	api.EncodeErrorResponse(w, http.StatusUnauthorized, "Unauthenticated")
+}
+
+// RequireAdmin is like RequireAuthentication but additionally requires the admin role.
+func RequireAdmin(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	authUser, ok := RequireAuthentication(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if !authUser.IsAdmin() {
+		slog.WarnContext(r.Context(), "Access denied, admin role required")
+		api.EncodeErrorResponse(w, http.StatusForbidden, "Access denied")
+		return nil, false
+	}
+
+	return authUser, true
+}
@@ -0,0 +1,133 @@
+package user
+
+import (
+	"fmt"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// ParseNameRule validates a name rule and returns it in its normalized form.
+func ParseNameRule(ruleType, pattern string) (models.NameRule, error) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	rule := models.NameRule{Type: ruleType, Pattern: pattern}
+
+	switch ruleType {
+	case models.NameRuleDNS:
+		name := strings.TrimPrefix(pattern, "*.")
+		if name == "" || strings.Contains(name, "*") || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+			return rule, fmt.Errorf("invalid DNS pattern %q, expected a name or a wildcard suffix like *.example.com", pattern)
+		}
+	case models.NameRuleIP:
+		if prefix, err := netip.ParsePrefix(pattern); err == nil {
+			rule.Pattern = prefix.Masked().String()
+		} else if addr, err := netip.ParseAddr(pattern); err == nil {
+			rule.Pattern = netip.PrefixFrom(addr, addr.BitLen()).String()
+		} else {
+			return rule, fmt.Errorf("invalid IP pattern %q, expected an address or CIDR", pattern)
+		}
+	case models.NameRuleEmail:
+		domain := pattern
+		if local, d, ok := strings.Cut(pattern, "@"); ok {
+			if local == "" {
+				return rule, fmt.Errorf("invalid email pattern %q, expected an address or a domain", pattern)
+			}
+			domain = d
+		}
+		if domain == "" || strings.ContainsAny(domain, "@*") {
+			return rule, fmt.Errorf("invalid email pattern %q, expected an address or a domain", pattern)
+		}
+	default:
+		return rule, fmt.Errorf("unknown rule type %q, expected dns, ip or email", ruleType)
+	}
+
+	return rule, nil
+}
+
+// NameRulesOf returns the name rules of the user including those of the user's groups.
+func NameRulesOf(user *models.User) ([]models.NameRule, error) {
+	rules := append([]models.NameRule{}, user.NameRules...)
+
+	groups, err := repositories.GetGroupRepository().FindByNames(user.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load groups: %v", err)
+	}
+	for _, group := range groups {
+		rules = append(rules, group.NameRules...)
+	}
+
+	return rules, nil
+}
+
+// AuthorizeNames checks that the name rules of the user or the user's groups cover every
+// requested name. URIs can't be covered by rules and are always refused.
+func AuthorizeNames(user *models.User, dnsNames []string, ipAddresses []net.IP, emailAddresses []string, uris []*url.URL) error {
+	rules, err := NameRulesOf(user)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range dnsNames {
+		if !matchesAny(rules, models.NameRuleDNS, name, matchDNS) {
+			return fmt.Errorf("not authorized to issue for DNS name %q", name)
+		}
+	}
+	for _, ip := range ipAddresses {
+		if !matchesAny(rules, models.NameRuleIP, ip.String(), matchIP) {
+			return fmt.Errorf("not authorized to issue for IP address %s", ip)
+		}
+	}
+	for _, email := range emailAddresses {
+		if !matchesAny(rules, models.NameRuleEmail, email, matchEmail) {
+			return fmt.Errorf("not authorized to issue for email address %q", email)
+		}
+	}
+	if len(uris) > 0 {
+		return fmt.Errorf("not authorized to issue for URI %q", uris[0].String())
+	}
+
+	return nil
+}
+
+func matchesAny(rules []models.NameRule, ruleType, name string, match func(pattern, name string) bool) bool {
+	name = strings.ToLower(name)
+	for _, rule := range rules {
+		if rule.Type == ruleType && match(rule.Pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDNS matches exact names, "*.example.com" covers all names below example.com
+// including wildcard names, but not example.com itself.
+func matchDNS(pattern, name string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(name, "."+suffix)
+	}
+	return pattern == name
+}
+
+func matchIP(pattern, name string) bool {
+	prefix, err := netip.ParsePrefix(pattern)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(name)
+	if err != nil {
+		return false
+	}
+	return prefix.Contains(addr.Unmap())
+}
+
+// matchEmail matches exact addresses, a bare domain covers every address of that domain.
+func matchEmail(pattern, name string) bool {
+	if strings.Contains(pattern, "@") {
+		return pattern == name
+	}
+	_, domain, ok := strings.Cut(name, "@")
+	return ok && domain == pattern
+}
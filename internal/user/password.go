@@ -0,0 +1,118 @@
+package user
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gcipher/internal/config"
+	"gcipher/internal/server/api"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrBreachedPassword is returned for passwords found in the breached password list
+var ErrBreachedPassword = errors.New("password appears in a list of breached passwords")
+
+// ErrBreachedListUnavailable is returned if the breached password list can't be read
+var ErrBreachedListUnavailable = errors.New("failed to check breached password list")
+
+// CheckPasswordPolicy checks a new password against the password policy: it must be at least
+// minLength characters long, contain three of lowercase, uppercase, digits and symbols, must
+// not match the username and must not appear in the breached password list. Login passwords
+// use password_min_length, passphrases protecting private keys keygen_min_password_length;
+// the username is empty for passphrases that don't belong to a user. Errors other than
+// ErrBreachedListUnavailable are meant to be shown to the user.
+func CheckPasswordPolicy(cfg *config.Config, username, password string, minLength int) error {
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("password must be at least %d characters long", minLength)
+	}
+
+	if characterClasses(password) < 3 {
+		return errors.New("password must contain at least three of lowercase, uppercase, digits and symbols")
+	}
+
+	if username != "" && strings.EqualFold(password, username) {
+		return errors.New("password must not match the username")
+	}
+
+	if cfg.PasswordBreachedListFile != "" {
+		breached, err := isBreached(cfg.PasswordBreachedListFile, password)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrBreachedListUnavailable, err)
+		}
+		if breached {
+			return ErrBreachedPassword
+		}
+	}
+
+	return nil
+}
+
+// PasswordPolicyError converts an error of CheckPasswordPolicy into a status error for the
+// HTTP response.
+func PasswordPolicyError(err error) error {
+	if errors.Is(err, ErrBreachedListUnavailable) {
+		return api.NewStatusError(http.StatusInternalServerError, "Internal server error", err)
+	}
+	return api.NewStatusError(http.StatusBadRequest, api.Capitalize(err.Error()), nil)
+}
+
+// characterClasses counts the classes of lowercase, uppercase, digits and other characters
+// the password contains.
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
+
+// isBreached scans the breached password list for the password. The list holds one entry per
+// line, either the plain password or its hex encoded SHA-1 hash optionally followed by
+// ":count", as in the Have I Been Pwned downloads. The file is read on every check since
+// these lists don't fit in memory, passwords only change rarely.
+func isBreached(path, password string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	sum := sha1.Sum([]byte(password))
+	passwordHash := hex.EncodeToString(sum[:])
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == password {
+			return true, nil
+		}
+
+		hash, _, _ := strings.Cut(entry, ":")
+		if len(hash) == sha1.Size*2 && strings.EqualFold(hash, passwordHash) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -1,23 +1,169 @@
 package user
 
 import (
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"gcipher/internal/config"
 	"gcipher/internal/db/models"
 	"gcipher/internal/db/repositories"
+	"gcipher/internal/metrics"
+	"gcipher/internal/ratelimit"
 	"gcipher/internal/util"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
 )
 
+var (
+	// ErrAccountLocked is returned while an account is locked after too many failed logins
+	ErrAccountLocked = errors.New("account temporarily locked")
+	// ErrAccountDisabled is returned for accounts disabled by an administrator
+	ErrAccountDisabled = errors.New("account disabled")
+)
+
+// Credential profiles of the auth failure metric
+const (
+	profilePassword    = "password"
+	profileToken       = "token"
+	profileCertificate = "certificate"
+)
+
+// Authenticate verifies the password of username. Logins are charged to the user rate limit,
+// if it is exceeded a StatusError with code 429 is returned.
 func Authenticate(username, password string) (*models.User, error) {
-	user, err := repositories.GetUserRepository().FindByUsername(username)
+	cfg, err := config.GetConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	if err := ratelimit.AllowUser(username); err != nil {
+		return nil, err
+	}
+
+	userRepo := repositories.GetUserRepository()
+	user, err := userRepo.FindByUsername(username)
+	if err != nil {
+		metrics.AuthFailures.WithLabelValues(profilePassword, "unknown").Inc()
+		return nil, err
+	}
+
+	// Disabled and locked accounts are refused without spending a hash computation
+	if user.Disabled {
+		metrics.AuthFailures.WithLabelValues(profilePassword, username).Inc()
+		return nil, ErrAccountDisabled
+	}
+	if user.IsLocked(time.Now()) {
+		metrics.AuthFailures.WithLabelValues(profilePassword, username).Inc()
+		return nil, ErrAccountLocked
+	}
+
 	// Hash the provided password and compare it with the stored hash
-	ok, err := util.ComparePasswordAndHash(user.Password, password)
+	ok, err := util.ComparePasswordAndHash(password, user.Password)
 	if !ok || err != nil {
+		metrics.AuthFailures.WithLabelValues(profilePassword, username).Inc()
+
+		if threshold := *cfg.LockoutThreshold; threshold > 0 {
+			lockUntil := time.Now().Add(time.Duration(cfg.LockoutDuration) * time.Minute)
+			locked, err := userRepo.RecordFailedLogin(username, threshold, lockUntil)
+			if err != nil {
+				slog.Error("Failed to record failed login", "username", username, "error", err)
+			} else if locked {
+				slog.Warn("Account locked after too many failed logins", "username", username, "locked_until", lockUntil)
+			}
+		}
 		return nil, errors.New("invalid password")
 	}
 
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		if err := userRepo.ResetFailedLogins(username); err != nil {
+			slog.Error("Failed to reset failed logins", "username", username, "error", err)
+		}
+	}
+
+	// Upgrade hashes created with outdated Argon2 parameters while the password is at hand
+	if util.NeedsRehash(user.Password) {
+		if hashedPassword, err := util.GenerateFromPassword(password); err != nil {
+			slog.Error("Failed to rehash password", "username", username, "error", err)
+		} else if err := userRepo.UpdatePassword(username, hashedPassword); err != nil {
+			slog.Error("Failed to store rehashed password", "username", username, "error", err)
+		} else {
+			user.Password = hashedPassword
+			slog.Info("Password rehashed with current parameters", "username", username)
+		}
+	}
+
+	return user, nil
+}
+
+// AuthenticateRequest authenticates a request carrying either an API token
+// ("Authorization: Bearer <token>") or HTTP basic authentication credentials.
+func AuthenticateRequest(r *http.Request) (*models.User, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return AuthenticateToken(token)
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, errors.New("missing authentication credentials")
+	}
+
+	return Authenticate(username, password)
+}
+
+// AuthenticateToken authenticates the owner of an API token.
+func AuthenticateToken(token string) (*models.User, error) {
+	apiToken, err := repositories.GetAPITokenRepository().FindByTokenHash(util.HashToken(token))
+	if err != nil {
+		metrics.AuthFailures.WithLabelValues(profileToken, "unknown").Inc()
+		return nil, errors.New("invalid token")
+	}
+
+	user, err := repositories.GetUserRepository().FindByUsername(apiToken.Username)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		metrics.AuthFailures.WithLabelValues(profileToken, user.Username).Inc()
+		return nil, ErrAccountDisabled
+	}
+
 	return user, nil
 }
+
+// AuthenticateCertificate authenticates the user named by the common name of a client certificate.
+// The certificate chain must have been verified against the CA already; this checks that gcipher
+// issued the certificate to the user it names and that it hasn't been revoked.
+func AuthenticateCertificate(cert *x509.Certificate) (*models.User, error) {
+	username := cert.Subject.CommonName
+
+	stored, err := repositories.GetCertificateRepository().FindBySerialNumber(fmt.Sprintf("%x", cert.SerialNumber))
+	if err != nil {
+		metrics.AuthFailures.WithLabelValues(profileCertificate, "unknown").Inc()
+		return nil, fmt.Errorf("client certificate not found: %v", err)
+	}
+
+	// The CN alone doesn't identify the user, anyone can request a certificate with any CN
+	issued, err := util.ParseCertificateFromBytes(stored.CertificatePEM)
+	if err != nil || !issued.Equal(cert) || stored.Username != username {
+		metrics.AuthFailures.WithLabelValues(profileCertificate, "unknown").Inc()
+		return nil, errors.New("client certificate wasn't issued to the user it names")
+	}
+	if stored.RevokedAt != nil {
+		metrics.AuthFailures.WithLabelValues(profileCertificate, username).Inc()
+		return nil, errors.New("client certificate has been revoked")
+	}
+
+	authUser, err := repositories.GetUserRepository().FindByUsername(username)
+	if err != nil {
+		metrics.AuthFailures.WithLabelValues(profileCertificate, "unknown").Inc()
+		return nil, err
+	}
+	if authUser.Disabled {
+		metrics.AuthFailures.WithLabelValues(profileCertificate, username).Inc()
+		return nil, ErrAccountDisabled
+	}
+
+	return authUser, nil
+}
@@ -2,7 +2,10 @@ package util
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"os"
@@ -13,6 +16,9 @@ import (
 	"github.com/youmark/pkcs8"
 )
 
+// oidExtKeyUsage identifies the extended key usage extension
+var oidExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
 // ParseCertificate parses the CA certificate from a file and returns the x509.Certificate object
 func ParseCertificate(certPath string) (*x509.Certificate, error) {
 	certBytes, err := os.ReadFile(certPath)
@@ -91,7 +97,12 @@ func ParseKeyFromBytes(der []byte, passphrase []byte) (interface{}, error) {
 	case "RSA PRIVATE KEY":
 		return x509.ParsePKCS1PrivateKey(block.Bytes)
 	case "PRIVATE KEY":
-		key, _, err := pkcs8.ParsePrivateKey(der, passphrase)
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("encrypted private key requires a passphrase")
+		}
+		key, _, err := pkcs8.ParsePrivateKey(block.Bytes, passphrase)
 		return key, err
 	case "EC PRIVATE KEY":
 		return x509.ParseECPrivateKey(block.Bytes)
@@ -99,3 +110,59 @@ func ParseKeyFromBytes(der []byte, passphrase []byte) (interface{}, error) {
 		return nil, fmt.Errorf("unsupported private key type: %s", block.Type)
 	}
 }
+
+// keyEncryptionOpts are the PBES2 parameters of encrypted key files, readable by OpenSSL
+var keyEncryptionOpts = &pkcs8.Opts{
+	Cipher: pkcs8.AES256CBC,
+	KDFOpts: pkcs8.PBKDF2Opts{
+		SaltSize:       16,
+		IterationCount: 600000,
+		HMACHash:       crypto.SHA256,
+	},
+}
+
+// MarshalEncryptedKey encodes a private key as a passphrase protected PKCS#8 PEM block that
+// ParseKeyFromBytes reads back.
+func MarshalEncryptedKey(key interface{}, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+
+	der, err := pkcs8.MarshalPrivateKey(key, passphrase, keyEncryptionOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt private key: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
+
+// KeyID identifies a CA key by the hex encoded subject key identifier of its certificate. The
+// cross-signed certificates of a key share it.
+func KeyID(cert *x509.Certificate) string {
+	return hex.EncodeToString(cert.SubjectKeyId)
+}
+
+// AuthorityKeyID returns the hex encoded authority key identifier of a PEM certificate, or an
+// empty string if it can't be read.
+func AuthorityKeyID(certPEM []byte) string {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return ""
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(cert.AuthorityKeyId)
+}
+
+// HasCriticalExtKeyUsage reports whether the certificate has an extended key usage extension
+// marked critical, as RFC 3161 requires for TSA certificates.
+func HasCriticalExtKeyUsage(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) {
+			return ext.Critical
+		}
+	}
+	return false
+}
@@ -2,8 +2,10 @@ package util
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -19,14 +21,18 @@ type params struct {
 	keyLength   uint32
 }
 
+// hashParams are the Argon2 parameters of new password hashes. Stored hashes using other
+// parameters are upgraded on the next successful login, see NeedsRehash.
+var hashParams = params{
+	memory:      64 * 1024,
+	iterations:  3,
+	parallelism: 2,
+	saltLength:  16,
+	keyLength:   32,
+}
+
 func GenerateFromPassword(password string) (encodedHash string, err error) {
-	p := &params{
-		memory:      64 * 1024,
-		iterations:  3,
-		parallelism: 2,
-		saltLength:  16,
-		keyLength:   32,
-	}
+	p := &hashParams
 
 	salt := make([]byte, p.saltLength)
 	_, err = rand.Read(salt)
@@ -66,6 +72,16 @@ func ComparePasswordAndHash(password, encodedHash string) (match bool, err error
 	return false, nil
 }
 
+// NeedsRehash reports whether a password hash was created with other parameters than
+// GenerateFromPassword currently uses.
+func NeedsRehash(encodedHash string) bool {
+	p, _, _, err := decodeHash(encodedHash)
+	if err != nil {
+		return true
+	}
+	return *p != hashParams
+}
+
 func decodeHash(encodedHash string) (p *params, salt, hash []byte, err error) {
 	vals := strings.Split(encodedHash, "$")
 	if len(vals) != 6 {
@@ -101,3 +117,21 @@ func decodeHash(encodedHash string) (p *params, salt, hash []byte, err error) {
 
 	return p, salt, hash, nil
 }
+
+// GenerateToken returns a new random API token and the hash under which it is stored.
+func GenerateToken() (token string, tokenHash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash of an API token. Tokens carry enough
+// entropy that a fast hash is sufficient, which allows looking them up by hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
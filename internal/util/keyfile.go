@@ -0,0 +1,33 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ParseSymmetricKey reads a 256-bit key stored hex or base64 encoded in a file
+func ParseSymmetricKey(keyPath string) ([]byte, error) {
+	content, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %v", err)
+	}
+
+	encoded := strings.TrimSpace(string(content))
+
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key must be hex or base64 encoded")
+		}
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes long, got %d", len(key))
+	}
+
+	return key, nil
+}
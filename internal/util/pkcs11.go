@@ -0,0 +1,70 @@
+//go:build cgo
+
+package util
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/ThalesIgnite/crypto11"
+)
+
+// PKCS11Token is a session with the token of a PKCS#11 module
+type PKCS11Token struct {
+	ctx *crypto11.Context
+}
+
+// OpenPKCS11 opens a session with the token of a PKCS#11 module. The session must stay open for
+// as long as keys found through it are used.
+func OpenPKCS11(module, tokenLabel, pin string) (*PKCS11Token, error) {
+	if module == "" || tokenLabel == "" {
+		return nil, fmt.Errorf("pkcs11_module and pkcs11_token_label are required")
+	}
+
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:       module,
+		TokenLabel: tokenLabel,
+		Pin:        pin,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PKCS#11 token %s: %v", tokenLabel, err)
+	}
+	return &PKCS11Token{ctx: ctx}, nil
+}
+
+// FindPKCS11Key returns the key pair with the given label from a PKCS#11 token.
+func FindPKCS11Key(token *PKCS11Token, label string) (crypto.Signer, error) {
+	key, err := token.ctx.FindKeyPair(nil, []byte(label))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find PKCS#11 key %s: %v", label, err)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("PKCS#11 key %s not found", label)
+	}
+	return key, nil
+}
+
+// GeneratePKCS11Key generates a key pair with the given label on a PKCS#11 token, an ECDSA key
+// if curve is set and an RSA key of the given size otherwise.
+func GeneratePKCS11Key(token *PKCS11Token, label string, curve elliptic.Curve, bits int) (crypto.Signer, error) {
+	// Labels identify the CA keys in the config, they must be unique on the token
+	existing, err := token.ctx.FindKeyPair(nil, []byte(label))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search PKCS#11 token: %v", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("PKCS#11 key %s already exists", label)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	if curve != nil {
+		return token.ctx.GenerateECDSAKeyPairWithLabel(id, []byte(label), curve)
+	}
+	return token.ctx.GenerateRSAKeyPairWithLabel(id, []byte(label), bits)
+}
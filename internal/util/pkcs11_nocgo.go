@@ -0,0 +1,28 @@
+//go:build !cgo
+
+package util
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"errors"
+)
+
+// errPKCS11Unsupported is returned by all PKCS#11 functions of builds without cgo, which the
+// PKCS#11 library requires
+var errPKCS11Unsupported = errors.New("PKCS#11 is not supported, gcipher was built without cgo")
+
+// PKCS11Token is a session with the token of a PKCS#11 module
+type PKCS11Token struct{}
+
+func OpenPKCS11(module, tokenLabel, pin string) (*PKCS11Token, error) {
+	return nil, errPKCS11Unsupported
+}
+
+func FindPKCS11Key(token *PKCS11Token, label string) (crypto.Signer, error) {
+	return nil, errPKCS11Unsupported
+}
+
+func GeneratePKCS11Key(token *PKCS11Token, label string, curve elliptic.Curve, bits int) (crypto.Signer, error) {
+	return nil, errPKCS11Unsupported
+}
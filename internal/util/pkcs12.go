@@ -0,0 +1,20 @@
+package util
+
+import (
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// PKCS12Encoder returns the PKCS#12 encoder for the requested encoding ("modern" or "legacy")
+func PKCS12Encoder(encoding string) (*pkcs12.Encoder, error) {
+	switch encoding {
+	case "", "modern":
+		return pkcs12.Modern, nil
+	case "legacy":
+		// For appliances that don't support AES encrypted bundles
+		return pkcs12.LegacyDES, nil
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#12 encoding: %s", encoding)
+	}
+}
@@ -0,0 +1,17 @@
+package util
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// CanonicalSerialNumber returns the form certificate serial numbers are stored and looked up in:
+// lowercase hex without leading zeros, as printed by fmt's %x verb for the parsed serial number.
+// It reports false if s isn't a hex number.
+func CanonicalSerialNumber(s string) (string, bool) {
+	serialNumber, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%x", serialNumber), true
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCanonicalSerialNumber(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"1a2b", "1a2b", true},
+		{"1A2B", "1a2b", true},
+		{"001a2b", "1a2b", true},
+		{"00AbCdEf", "abcdef", true},
+		{"0", "0", true},
+		{"", "", false},
+		{"xyz", "", false},
+		{"0x1a", "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := CanonicalSerialNumber(test.in)
+		if got != test.want || ok != test.ok {
+			t.Errorf("CanonicalSerialNumber(%q) = %q, %v, want %q, %v", test.in, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+// Certificates are looked up by the %x form of the serial number of a presented certificate,
+// e.g. for mTLS logins and chain verification, so the stored form must match it.
+func TestCanonicalSerialNumberMatchesIssuedCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, requested := range []string{"00C0FFEE", "c0ffee", "0c0ffee"} {
+		serialNumber, _ := new(big.Int).SetString(requested, 16)
+		template := x509.Certificate{
+			SerialNumber: serialNumber,
+			Subject:      pkix.Name{CommonName: "test", SerialNumber: requested},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, ok := CanonicalSerialNumber(requested)
+		if !ok {
+			t.Fatalf("CanonicalSerialNumber(%q) rejected the serial number", requested)
+		}
+		if lookup := fmt.Sprintf("%x", cert.SerialNumber); stored != lookup {
+			t.Errorf("serial number %q is stored as %q but looked up as %q", requested, stored, lookup)
+		}
+	}
+}
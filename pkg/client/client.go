@@ -0,0 +1,281 @@
+// Package client is a typed Go client for the gcipher HTTP API.
+//
+// It talks to the v2 REST resources, authenticating with HTTP basic authentication or an API token,
+// and to the public endpoints. The API is described by the OpenAPI document served
+// at /api/openapi.yaml.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client is a gcipher API client. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	token      string
+	httpClient *http.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to send requests, e.g. to configure TLS or timeouts.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken authenticates using an API token instead of the username and password.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New creates a client for the gcipher server at baseURL (e.g. "https://pki.example.com").
+func New(baseURL, username, password string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		username:   username,
+		password:   password,
+		httpClient: http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// RequestCertificate submits a certificate signing request and returns the issued certificate.
+// If the request needs approval, a *PendingApprovalError carrying the request ID is returned.
+func (c *Client) RequestCertificate(ctx context.Context, req CertificateRequest) (*Certificate, error) {
+	data := requestData{
+		Applicant: req.Applicant,
+		CSR:       req.CSR,
+		Lifetime:  req.Lifetime,
+		Type:      req.Type,
+	}
+
+	var raw json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "/api/v2/certificates", data, &raw); err != nil {
+		return nil, err
+	}
+
+	var pending CertificateRequestStatus
+	if err := json.Unmarshal(raw, &pending); err == nil && pending.RequestID != "" {
+		return nil, &PendingApprovalError{Request: pending}
+	}
+
+	var cert Certificate
+	if err := json.Unmarshal(raw, &cert); err != nil {
+		return nil, fmt.Errorf("gcipher: failed to decode response: %v", err)
+	}
+	return &cert, nil
+}
+
+// GetCertificateRequest returns the status of a certificate request awaiting approval.
+func (c *Client) GetCertificateRequest(ctx context.Context, requestID string) (*CertificateRequestStatus, error) {
+	var status CertificateRequestStatus
+	if err := c.do(ctx, http.MethodGet, "/api/v2/certificate-requests/"+url.PathEscape(requestID), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RetrieveCertificate returns the certificate with the given hexadecimal serial number.
+func (c *Client) RetrieveCertificate(ctx context.Context, serialNumber string) (*Certificate, error) {
+	var cert Certificate
+	if err := c.do(ctx, http.MethodGet, "/api/v2/certificates/"+url.PathEscape(serialNumber), nil, &cert); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// DownloadCertificate returns the certificate with the given hexadecimal serial number in one of
+// the encoded formats "pem", "der", "chain" (PEM bundle including the CA chain) or "pkcs7".
+func (c *Client) DownloadCertificate(ctx context.Context, serialNumber, format string) ([]byte, error) {
+	path := "/api/v2/certificates/" + url.PathEscape(serialNumber) + "?format=" + url.QueryEscape(format)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authenticate(req)
+
+	return c.doRaw(req)
+}
+
+// RevokeCertificate revokes the certificate with the given hexadecimal serial number.
+func (c *Client) RevokeCertificate(ctx context.Context, serialNumber string) (*Certificate, error) {
+	var cert Certificate
+	if err := c.do(ctx, http.MethodDelete, "/api/v2/certificates/"+url.PathEscape(serialNumber), nil, &cert); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// ListCertificates lists the caller's certificates. State is "valid", "revoked" or empty for all.
+func (c *Client) ListCertificates(ctx context.Context, state string) ([]Certificate, error) {
+	path := "/api/v2/certificates"
+	if state != "" {
+		path += "?state=" + url.QueryEscape(state)
+	}
+
+	var certs []Certificate
+	if err := c.do(ctx, http.MethodGet, path, nil, &certs); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// GenerateCertificate lets the server generate the keypair and returns the password protected
+// PKCS#12 bundle containing the key, the certificate and the CA chain.
+func (c *Client) GenerateCertificate(ctx context.Context, req KeyGenerationRequest) ([]byte, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v2/certificates/pkcs12", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	c.authenticate(httpReq)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return c.doRaw(httpReq)
+}
+
+// GetUsage returns the caller's remaining requests and issuance quotas.
+func (c *Client) GetUsage(ctx context.Context) (*Usage, error) {
+	var usage Usage
+	if err := c.do(ctx, http.MethodGet, "/api/v2/usage", nil, &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// FetchCRL downloads and parses the latest certificate revocation list.
+func (c *Client) FetchCRL(ctx context.Context) (*x509.RevocationList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/public/ca/intermediate/crl", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.doRaw(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The CRL is served DER encoded, older servers sent PEM
+	der := body
+	if block, _ := pem.Decode(body); block != nil {
+		der = block.Bytes
+	}
+
+	return x509.ParseRevocationList(der)
+}
+
+// do sends an authenticated JSON request and decodes the data of the response envelope into out.
+func (c *Client) do(ctx context.Context, method, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	c.authenticate(req)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp, respBody)
+	}
+
+	envelope := response{Data: out}
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return fmt.Errorf("gcipher: failed to decode response: %v", err)
+	}
+
+	if !envelope.Success {
+		return &APIError{StatusCode: resp.StatusCode, Errors: envelope.Errors}
+	}
+
+	return nil
+}
+
+// doRaw sends a request and returns the raw body of a successful response.
+func (c *Client) doRaw(req *http.Request) ([]byte, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, decodeError(resp, body)
+	}
+
+	return body, nil
+}
+
+func (c *Client) authenticate(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else {
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+func decodeError(resp *http.Response, body []byte) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var envelope response
+	if err := json.Unmarshal(body, &envelope); err == nil {
+		apiErr.Errors = envelope.Errors
+	}
+	return apiErr
+}
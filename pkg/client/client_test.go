@@ -0,0 +1,308 @@
+package client_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gcipher/internal/db/models"
+	"gcipher/internal/db/repositories"
+	ocsp "gcipher/internal/oscp"
+	"gcipher/internal/server"
+	"gcipher/internal/util"
+	"gcipher/pkg/client"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The tests run the client against the real handlers and need a MongoDB instance. Point
+// GCIPHER_TEST_DATABASE_URL to a disposable database, the tests write to its gcipher database.
+const databaseURLEnv = "GCIPHER_TEST_DATABASE_URL"
+
+const testPassword = "correct-Horse-battery-9"
+
+var (
+	srv      *httptest.Server
+	caCert   *x509.Certificate
+	username string
+)
+
+func TestMain(m *testing.M) {
+	databaseURL := os.Getenv(databaseURLEnv)
+	if databaseURL == "" {
+		fmt.Printf("%s not set, skipping client tests against the server\n", databaseURLEnv)
+		os.Exit(m.Run())
+	}
+
+	dir, err := os.MkdirTemp("", "gcipher-client-test")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := setUp(dir, databaseURL); err != nil {
+		fmt.Println("Failed to set up test server:", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	srv.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setUp writes a config with a fresh CA to dir, registers a test user and starts the server.
+func setUp(dir, databaseURL string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gcipher client test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	if caCert, err = x509.ParseCertificate(der); err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		"ca.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"ca.key": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		"config.yml": []byte(fmt.Sprintf("database_url: %q\nca_cert_path: ca.pem\nca_key_path: ca.key\ncertificate_lifetime_default: 30\n",
+			databaseURL)),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			return err
+		}
+	}
+
+	// The config file is looked up in the working directory
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+
+	if err := repositories.InitializeRepositories(); err != nil {
+		return err
+	}
+
+	hashedPassword, err := util.GenerateFromPassword(testPassword)
+	if err != nil {
+		return err
+	}
+	username = fmt.Sprintf("client-test-%d", time.Now().UnixNano())
+	if err := repositories.GetUserRepository().Insert(*models.NewUser(username, hashedPassword)); err != nil {
+		return err
+	}
+
+	ocsp.StartCRLUpdater()
+	srv = httptest.NewServer(server.NewRouter())
+	return nil
+}
+
+// newClient returns a client of the test user, skipping the test if no database is available.
+func newClient(t *testing.T) *client.Client {
+	t.Helper()
+	if srv == nil {
+		t.Skipf("%s not set", databaseURLEnv)
+	}
+	return client.New(srv.URL, username, testPassword)
+}
+
+// newCSR creates a DER encoded server CSR carrying a random serial number.
+func newCSR(t *testing.T, dnsName string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: dnsName, SerialNumber: fmt.Sprintf("%x", serial)},
+		DNSNames: []string{dnsName},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func requestCertificate(t *testing.T, c *client.Client, dnsName string) (*client.Certificate, *x509.Certificate) {
+	t.Helper()
+
+	cert, err := c.RequestCertificate(context.Background(), client.CertificateRequest{CSR: newCSR(t, dnsName), Type: "server"})
+	if err != nil {
+		t.Fatalf("RequestCertificate failed: %v", err)
+	}
+
+	parsed, err := cert.X509()
+	if err != nil {
+		t.Fatalf("issued certificate can't be parsed: %v", err)
+	}
+	if err := parsed.CheckSignatureFrom(caCert); err != nil {
+		t.Fatalf("issued certificate isn't signed by the CA: %v", err)
+	}
+	return cert, parsed
+}
+
+func TestRequestAndRetrieveCertificate(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+
+	cert, parsed := requestCertificate(t, c, "request.client-test.example")
+	if len(parsed.DNSNames) != 1 || parsed.DNSNames[0] != "request.client-test.example" {
+		t.Errorf("expected DNS name request.client-test.example, got %v", parsed.DNSNames)
+	}
+
+	serialNumber := fmt.Sprintf("%x", parsed.SerialNumber)
+	if cert.SerialNumber != "" && cert.SerialNumber != serialNumber {
+		t.Errorf("expected serial number %s, got %s", serialNumber, cert.SerialNumber)
+	}
+
+	retrieved, err := c.RetrieveCertificate(ctx, serialNumber)
+	if err != nil {
+		t.Fatalf("RetrieveCertificate failed: %v", err)
+	}
+	if retrieved.PEM != cert.PEM {
+		t.Error("retrieved certificate differs from the issued one")
+	}
+	if retrieved.RevokedAt != nil {
+		t.Error("new certificate is reported as revoked")
+	}
+}
+
+func TestRevokeAndListCertificates(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+
+	_, kept := requestCertificate(t, c, "kept.client-test.example")
+	_, revoked := requestCertificate(t, c, "revoked.client-test.example")
+	revokedSerial := fmt.Sprintf("%x", revoked.SerialNumber)
+
+	cert, err := c.RevokeCertificate(ctx, revokedSerial)
+	if err != nil {
+		t.Fatalf("RevokeCertificate failed: %v", err)
+	}
+	if cert.RevokedAt == nil {
+		t.Error("revoked certificate has no revocation time")
+	}
+
+	var apiErr *client.APIError
+	if _, err := c.RevokeCertificate(ctx, revokedSerial); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 revoking twice, got %v", err)
+	}
+
+	for state, want := range map[string]*x509.Certificate{"valid": kept, "revoked": revoked} {
+		certs, err := c.ListCertificates(ctx, state)
+		if err != nil {
+			t.Fatalf("ListCertificates(%s) failed: %v", state, err)
+		}
+		if !containsSerial(t, certs, want.SerialNumber) {
+			t.Errorf("%s certificates don't include %x", state, want.SerialNumber)
+		}
+	}
+
+	valid, err := c.ListCertificates(ctx, "valid")
+	if err != nil {
+		t.Fatalf("ListCertificates failed: %v", err)
+	}
+	if containsSerial(t, valid, revoked.SerialNumber) {
+		t.Error("valid certificates include the revoked one")
+	}
+}
+
+func containsSerial(t *testing.T, certs []client.Certificate, serial *big.Int) bool {
+	t.Helper()
+	for _, cert := range certs {
+		parsed, err := cert.X509()
+		if err != nil {
+			t.Fatalf("listed certificate can't be parsed: %v", err)
+		}
+		if parsed.SerialNumber.Cmp(serial) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFetchCRL(t *testing.T) {
+	c := newClient(t)
+
+	// The CRL updater publishes the first CRL in the background
+	var crl *x509.RevocationList
+	var err error
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if crl, err = c.FetchCRL(context.Background()); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("FetchCRL failed: %v", err)
+	}
+
+	if err := crl.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("CRL isn't signed by the CA: %v", err)
+	}
+	if crl.NextUpdate.Before(time.Now()) {
+		t.Errorf("CRL is outdated, next update was %s", crl.NextUpdate)
+	}
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	newClient(t)
+	c := client.New(srv.URL, username, "wrong-password")
+
+	_, err := c.ListCertificates(context.Background(), "")
+
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", apiErr.StatusCode)
+	}
+	if len(apiErr.Errors) == 0 {
+		t.Error("error response carries no error details")
+	}
+}
+
+func TestUnknownCertificate(t *testing.T) {
+	c := newClient(t)
+
+	_, err := c.RetrieveCertificate(context.Background(), "ffffffffffffffffffffffff")
+
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CertificateRequest holds the parameters of a certificate signing request
+type CertificateRequest struct {
+	// CSR is the DER encoded certificate signing request
+	CSR       []byte
+	Applicant string
+	// Type is the certificate profile, either "client" or "server"
+	Type string
+	// Lifetime in days, the server default is used if < 1
+	Lifetime int
+}
+
+// KeyGenerationRequest holds the parameters of a certificate whose key is generated by the server
+type KeyGenerationRequest struct {
+	Applicant      string   `json:"applicant,omitempty"`
+	CommonName     string   `json:"common_name"`
+	Organization   string   `json:"organization,omitempty"`
+	DNSNames       []string `json:"dns_names,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
+	IPAddresses    []string `json:"ip_addresses,omitempty"`
+	Lifetime       int      `json:"lifetime,omitempty"`
+	Type           string   `json:"type,omitempty"`
+	// KeyType is "rsa" or "ecdsa", the server picks one based on Type if empty
+	KeyType string `json:"key_type,omitempty"`
+	KeySize int    `json:"key_size,omitempty"`
+	// Password protects the returned PKCS#12 bundle
+	Password   string `json:"password"`
+	PersistKey bool   `json:"persist_key,omitempty"`
+	// Encoding is "modern" (default) or "legacy"
+	Encoding string `json:"encoding,omitempty"`
+	// Escrow stores the key for later recovery, the server must have key escrow enabled
+	Escrow bool `json:"escrow,omitempty"`
+}
+
+// Certificate is a certificate as returned by the API
+type Certificate struct {
+	PEM          string     `json:"cert"`
+	SerialNumber string     `json:"serialnumber,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// X509 parses the PEM encoded certificate.
+func (c *Certificate) X509() (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(c.PEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// CertificateRequestStatus is a certificate request awaiting the approval of an operator
+type CertificateRequestStatus struct {
+	RequestID string   `json:"request_id"`
+	Status    string   `json:"status"`
+	Reasons   []string `json:"reasons"`
+	// SerialNumber is set once the request has been approved and the certificate issued
+	SerialNumber string    `json:"serialnumber,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// PendingApprovalError is returned by RequestCertificate when the certificate needs the approval
+// of an operator. Poll GetCertificateRequest with the request ID for the outcome.
+type PendingApprovalError struct {
+	Request CertificateRequestStatus
+}
+
+func (e *PendingApprovalError) Error() string {
+	return fmt.Sprintf("gcipher: certificate request %s awaits approval: %s", e.Request.RequestID, strings.Join(e.Request.Reasons, "; "))
+}
+
+// Usage reports the caller's remaining requests and issuance quotas
+type Usage struct {
+	Username   string           `json:"username"`
+	RateLimits []RateLimitUsage `json:"rate_limits"`
+	Quotas     []QuotaUsage     `json:"quotas"`
+}
+
+// RateLimitUsage is the state of a rate limit, scope is "ip", "user" or "token"
+type RateLimitUsage struct {
+	Scope     string `json:"scope"`
+	PerMinute int    `json:"per_minute"`
+	Burst     int    `json:"burst"`
+	Remaining int    `json:"remaining"`
+}
+
+// QuotaUsage is the state of an issuance quota, name is "certificates_per_day" or "active_certificates"
+type QuotaUsage struct {
+	Name     string     `json:"name"`
+	Limit    int        `json:"limit"`
+	Used     int        `json:"used"`
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+// ErrorDetail is a single error reported by the API
+type ErrorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIError is returned when the API answers with a non-successful status code
+type APIError struct {
+	StatusCode int
+	Errors     []ErrorDetail
+	// RetryAfter is set when a rate limit or quota is exceeded (status 429)
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("gcipher: request failed with status %d", e.StatusCode)
+	}
+
+	messages := make([]string, 0, len(e.Errors))
+	for _, detail := range e.Errors {
+		messages = append(messages, detail.Message)
+	}
+	return fmt.Sprintf("gcipher: request failed with status %d: %s", e.StatusCode, strings.Join(messages, "; "))
+}
+
+// requestData mirrors the data object accepted by the API
+type requestData struct {
+	Applicant string `json:"applicant,omitempty"`
+	CSR       []byte `json:"csr,omitempty"`
+	Lifetime  int    `json:"lifetime,omitempty"`
+	Type      string `json:"type,omitempty"`
+}
+
+// response mirrors the envelope returned by the API
+type response struct {
+	Success bool          `json:"success"`
+	Errors  []ErrorDetail `json:"errors,omitempty"`
+	Data    interface{}   `json:"data,omitempty"`
+}
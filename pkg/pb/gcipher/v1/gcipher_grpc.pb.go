@@ -0,0 +1,349 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.3
+// source: gcipher/v1/gcipher.proto
+
+package gcipherv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	CertificateService_IssueCertificate_FullMethodName  = "/gcipher.v1.CertificateService/IssueCertificate"
+	CertificateService_GetCertificate_FullMethodName    = "/gcipher.v1.CertificateService/GetCertificate"
+	CertificateService_RevokeCertificate_FullMethodName = "/gcipher.v1.CertificateService/RevokeCertificate"
+	CertificateService_ListCertificates_FullMethodName  = "/gcipher.v1.CertificateService/ListCertificates"
+	CertificateService_GetCRL_FullMethodName            = "/gcipher.v1.CertificateService/GetCRL"
+	CertificateService_WatchRevocations_FullMethodName  = "/gcipher.v1.CertificateService/WatchRevocations"
+)
+
+// CertificateServiceClient is the client API for CertificateService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CertificateServiceClient interface {
+	IssueCertificate(ctx context.Context, in *IssueCertificateRequest, opts ...grpc.CallOption) (*Certificate, error)
+	GetCertificate(ctx context.Context, in *GetCertificateRequest, opts ...grpc.CallOption) (*Certificate, error)
+	RevokeCertificate(ctx context.Context, in *RevokeCertificateRequest, opts ...grpc.CallOption) (*Certificate, error)
+	ListCertificates(ctx context.Context, in *ListCertificatesRequest, opts ...grpc.CallOption) (CertificateService_ListCertificatesClient, error)
+	GetCRL(ctx context.Context, in *GetCRLRequest, opts ...grpc.CallOption) (*CRL, error)
+	WatchRevocations(ctx context.Context, in *WatchRevocationsRequest, opts ...grpc.CallOption) (CertificateService_WatchRevocationsClient, error)
+}
+
+type certificateServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCertificateServiceClient(cc grpc.ClientConnInterface) CertificateServiceClient {
+	return &certificateServiceClient{cc}
+}
+
+func (c *certificateServiceClient) IssueCertificate(ctx context.Context, in *IssueCertificateRequest, opts ...grpc.CallOption) (*Certificate, error) {
+	out := new(Certificate)
+	err := c.cc.Invoke(ctx, CertificateService_IssueCertificate_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certificateServiceClient) GetCertificate(ctx context.Context, in *GetCertificateRequest, opts ...grpc.CallOption) (*Certificate, error) {
+	out := new(Certificate)
+	err := c.cc.Invoke(ctx, CertificateService_GetCertificate_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certificateServiceClient) RevokeCertificate(ctx context.Context, in *RevokeCertificateRequest, opts ...grpc.CallOption) (*Certificate, error) {
+	out := new(Certificate)
+	err := c.cc.Invoke(ctx, CertificateService_RevokeCertificate_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certificateServiceClient) ListCertificates(ctx context.Context, in *ListCertificatesRequest, opts ...grpc.CallOption) (CertificateService_ListCertificatesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CertificateService_ServiceDesc.Streams[0], CertificateService_ListCertificates_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certificateServiceListCertificatesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CertificateService_ListCertificatesClient interface {
+	Recv() (*Certificate, error)
+	grpc.ClientStream
+}
+
+type certificateServiceListCertificatesClient struct {
+	grpc.ClientStream
+}
+
+func (x *certificateServiceListCertificatesClient) Recv() (*Certificate, error) {
+	m := new(Certificate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *certificateServiceClient) GetCRL(ctx context.Context, in *GetCRLRequest, opts ...grpc.CallOption) (*CRL, error) {
+	out := new(CRL)
+	err := c.cc.Invoke(ctx, CertificateService_GetCRL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certificateServiceClient) WatchRevocations(ctx context.Context, in *WatchRevocationsRequest, opts ...grpc.CallOption) (CertificateService_WatchRevocationsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CertificateService_ServiceDesc.Streams[1], CertificateService_WatchRevocations_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certificateServiceWatchRevocationsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CertificateService_WatchRevocationsClient interface {
+	Recv() (*RevocationEvent, error)
+	grpc.ClientStream
+}
+
+type certificateServiceWatchRevocationsClient struct {
+	grpc.ClientStream
+}
+
+func (x *certificateServiceWatchRevocationsClient) Recv() (*RevocationEvent, error) {
+	m := new(RevocationEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CertificateServiceServer is the server API for CertificateService service.
+// All implementations must embed UnimplementedCertificateServiceServer
+// for forward compatibility
+type CertificateServiceServer interface {
+	IssueCertificate(context.Context, *IssueCertificateRequest) (*Certificate, error)
+	GetCertificate(context.Context, *GetCertificateRequest) (*Certificate, error)
+	RevokeCertificate(context.Context, *RevokeCertificateRequest) (*Certificate, error)
+	ListCertificates(*ListCertificatesRequest, CertificateService_ListCertificatesServer) error
+	GetCRL(context.Context, *GetCRLRequest) (*CRL, error)
+	WatchRevocations(*WatchRevocationsRequest, CertificateService_WatchRevocationsServer) error
+	mustEmbedUnimplementedCertificateServiceServer()
+}
+
+// UnimplementedCertificateServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCertificateServiceServer struct {
+}
+
+func (UnimplementedCertificateServiceServer) IssueCertificate(context.Context, *IssueCertificateRequest) (*Certificate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IssueCertificate not implemented")
+}
+func (UnimplementedCertificateServiceServer) GetCertificate(context.Context, *GetCertificateRequest) (*Certificate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCertificate not implemented")
+}
+func (UnimplementedCertificateServiceServer) RevokeCertificate(context.Context, *RevokeCertificateRequest) (*Certificate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeCertificate not implemented")
+}
+func (UnimplementedCertificateServiceServer) ListCertificates(*ListCertificatesRequest, CertificateService_ListCertificatesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListCertificates not implemented")
+}
+func (UnimplementedCertificateServiceServer) GetCRL(context.Context, *GetCRLRequest) (*CRL, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCRL not implemented")
+}
+func (UnimplementedCertificateServiceServer) WatchRevocations(*WatchRevocationsRequest, CertificateService_WatchRevocationsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRevocations not implemented")
+}
+func (UnimplementedCertificateServiceServer) mustEmbedUnimplementedCertificateServiceServer() {}
+
+// UnsafeCertificateServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CertificateServiceServer will
+// result in compilation errors.
+type UnsafeCertificateServiceServer interface {
+	mustEmbedUnimplementedCertificateServiceServer()
+}
+
+func RegisterCertificateServiceServer(s grpc.ServiceRegistrar, srv CertificateServiceServer) {
+	s.RegisterService(&CertificateService_ServiceDesc, srv)
+}
+
+func _CertificateService_IssueCertificate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IssueCertificateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertificateServiceServer).IssueCertificate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CertificateService_IssueCertificate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertificateServiceServer).IssueCertificate(ctx, req.(*IssueCertificateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CertificateService_GetCertificate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCertificateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertificateServiceServer).GetCertificate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CertificateService_GetCertificate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertificateServiceServer).GetCertificate(ctx, req.(*GetCertificateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CertificateService_RevokeCertificate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeCertificateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertificateServiceServer).RevokeCertificate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CertificateService_RevokeCertificate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertificateServiceServer).RevokeCertificate(ctx, req.(*RevokeCertificateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CertificateService_ListCertificates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListCertificatesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CertificateServiceServer).ListCertificates(m, &certificateServiceListCertificatesServer{stream})
+}
+
+type CertificateService_ListCertificatesServer interface {
+	Send(*Certificate) error
+	grpc.ServerStream
+}
+
+type certificateServiceListCertificatesServer struct {
+	grpc.ServerStream
+}
+
+func (x *certificateServiceListCertificatesServer) Send(m *Certificate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CertificateService_GetCRL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCRLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertificateServiceServer).GetCRL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CertificateService_GetCRL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertificateServiceServer).GetCRL(ctx, req.(*GetCRLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CertificateService_WatchRevocations_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRevocationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CertificateServiceServer).WatchRevocations(m, &certificateServiceWatchRevocationsServer{stream})
+}
+
+type CertificateService_WatchRevocationsServer interface {
+	Send(*RevocationEvent) error
+	grpc.ServerStream
+}
+
+type certificateServiceWatchRevocationsServer struct {
+	grpc.ServerStream
+}
+
+func (x *certificateServiceWatchRevocationsServer) Send(m *RevocationEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// CertificateService_ServiceDesc is the grpc.ServiceDesc for CertificateService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CertificateService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gcipher.v1.CertificateService",
+	HandlerType: (*CertificateServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "IssueCertificate",
+			Handler:    _CertificateService_IssueCertificate_Handler,
+		},
+		{
+			MethodName: "GetCertificate",
+			Handler:    _CertificateService_GetCertificate_Handler,
+		},
+		{
+			MethodName: "RevokeCertificate",
+			Handler:    _CertificateService_RevokeCertificate_Handler,
+		},
+		{
+			MethodName: "GetCRL",
+			Handler:    _CertificateService_GetCRL_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListCertificates",
+			Handler:       _CertificateService_ListCertificates_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchRevocations",
+			Handler:       _CertificateService_WatchRevocations_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gcipher/v1/gcipher.proto",
+}
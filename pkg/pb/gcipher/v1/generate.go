@@ -0,0 +1,5 @@
+// Package gcipherv1 contains the protobuf messages and gRPC stubs generated from
+// proto/gcipher/v1/gcipher.proto.
+package gcipherv1
+
+//go:generate protoc -I ../../../../proto --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative gcipher/v1/gcipher.proto